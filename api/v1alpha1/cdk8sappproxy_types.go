@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,6 +36,11 @@ type GitRepositorySpec struct {
 	// +kubebuilder:validation:optional
 	Reference string `json:"reference,omitempty"`
 
+	// Commit (optional) pins the checkout to this commit hash of Reference. Commits pushed to
+	// Reference afterwards are not deployed until Commit is updated.
+	// +kubebuilder:validation:optional
+	Commit string `json:"commit,omitempty"`
+
 	// Path (optional) is the path within the repository where the cdk8s application is located.
 	// Defaults to the root of the repository.
 	// +kubebuilder:validation:optional
@@ -55,15 +63,431 @@ type GitRepositorySpec struct {
 	KnownHostsKey string `json:"knownHostsKey,omitempty"`
 }
 
+// OCIRepositorySpec defines an OCI artifact holding pre-synthesized manifests, e.g. the dist
+// directory of an app pushed by CI.
+type OCIRepositorySpec struct {
+	// URL is the repository of the artifact, e.g. oci://ghcr.io/org/app-manifests.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^oci://`
+	URL string `json:"url"`
+
+	// Tag (optional) is the tag of the artifact. Defaults to latest.
+	// +kubebuilder:validation:Optional
+	Tag string `json:"tag,omitempty"`
+
+	// Digest (optional) pins the artifact to this manifest digest, e.g. sha256:3f1b...,
+	// taking precedence over Tag.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	Digest string `json:"digest,omitempty"`
+
+	// Path (optional) is the directory of the manifests within the artifact. Defaults to its root.
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+
+	// SecretRef (optional) names a Secret in the namespace of the Cdk8sAppProxy holding the
+	// registry credentials, either a kubernetes.io/dockerconfigjson Secret or username and
+	// password keys.
+	// +kubebuilder:validation:Optional
+	SecretRef string `json:"secretRef,omitempty"`
+
+	// Insecure (optional) pulls the artifact over plain HTTP.
+	// +kubebuilder:validation:Optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// NamespaceIsolation defines the guard rails created in a target namespace.
+type NamespaceIsolation struct {
+	// ResourceQuota (optional) limits the total resources of the namespace.
+	// +kubebuilder:validation:Optional
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+
+	// LimitRange (optional) sets default and maximum resources of the containers in the namespace.
+	// +kubebuilder:validation:Optional
+	LimitRange *corev1.LimitRangeSpec `json:"limitRange,omitempty"`
+
+	// NetworkPolicy (optional) restricts the traffic of the pods in the namespace.
+	// +kubebuilder:validation:Optional
+	NetworkPolicy *networkingv1.NetworkPolicySpec `json:"networkPolicy,omitempty"`
+}
+
+// TargetNamespaceSpec defines the namespace all namespaced resources of the app are applied to.
+type TargetNamespaceSpec struct {
+	// Name is the namespace created on the target clusters. Namespaced resources of the app are
+	// moved into it, Namespace resources of the app are not applied.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	NamespaceIsolation `json:",inline"`
+}
+
+// ValuesKind is the kind of object values are read from.
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type ValuesKind string
+
+const (
+	// ValuesKindConfigMap reads values from a ConfigMap.
+	ValuesKindConfigMap ValuesKind = "ConfigMap"
+
+	// ValuesKindSecret reads values from a Secret.
+	ValuesKindSecret ValuesKind = "Secret"
+)
+
+// ValuesReference references a ConfigMap or Secret in the namespace of the Cdk8sAppProxy to read values from.
+type ValuesReference struct {
+	// Kind of the referenced object.
+	// +kubebuilder:validation:Required
+	Kind ValuesKind `json:"kind"`
+
+	// Name of the referenced object.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Key (optional) selects a data entry holding a YAML or JSON object, which is merged into the
+	// values. Without a key, every data entry is merged in as a string value named after its key.
+	// +kubebuilder:validation:Optional
+	Key string `json:"key,omitempty"`
+
+	// Optional (optional) ignores the reference if the object or key does not exist.
+	// +kubebuilder:validation:Optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Renderer renders the resources of an app.
+// +kubebuilder:validation:Enum=cdk8s;yaml;kustomize;jsonnet;cue
+type Renderer string
+
+const (
+	// RendererCdk8s synthesizes a cdk8s app and reads the manifests from its dist directory.
+	RendererCdk8s Renderer = "cdk8s"
+
+	// RendererYAML reads the YAML and JSON manifests in the app path and its subdirectories.
+	RendererYAML Renderer = "yaml"
+
+	// RendererKustomize builds the kustomization in the app path.
+	RendererKustomize Renderer = "kustomize"
+
+	// RendererJsonnet evaluates main.jsonnet in the app path.
+	RendererJsonnet Renderer = "jsonnet"
+
+	// RendererCUE exports the CUE package in the app path.
+	RendererCUE Renderer = "cue"
+)
+
+// Language is the language of a cdk8s app.
+// +kubebuilder:validation:Enum=typescript;go;python;java
+type Language string
+
+const (
+	// LanguageTypeScript is a TypeScript app.
+	LanguageTypeScript Language = "typescript"
+
+	// LanguageGo is a Go app.
+	LanguageGo Language = "go"
+
+	// LanguagePython is a Python app.
+	LanguagePython Language = "python"
+
+	// LanguageJava is a Java app.
+	LanguageJava Language = "java"
+)
+
+// PackageManager installs the dependencies of a TypeScript app.
+// +kubebuilder:validation:Enum=npm;yarn;pnpm
+type PackageManager string
+
+const (
+	// PackageManagerNpm installs with npm.
+	PackageManagerNpm PackageManager = "npm"
+
+	// PackageManagerYarn installs with yarn.
+	PackageManagerYarn PackageManager = "yarn"
+
+	// PackageManagerPnpm installs with pnpm.
+	PackageManagerPnpm PackageManager = "pnpm"
+)
+
+// ToolchainSpec configures the tools used to synthesize the app.
+type ToolchainSpec struct {
+	// PackageManager (optional) installs the dependencies of a TypeScript app. Defaults to the
+	// package manager of the lockfile in the app path, or npm. Installs respect the lockfile.
+	// +kubebuilder:validation:Optional
+	PackageManager PackageManager `json:"packageManager,omitempty"`
+
+	// Cdk8sCLIVersion (optional) runs this version of cdk8s-cli through npx instead of the
+	// cdk8s binary of the controller image.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[0-9A-Za-z.+~^-]+$`
+	Cdk8sCLIVersion string `json:"cdk8sCLIVersion,omitempty"`
+}
+
+// RegistryKind is the kind of a package registry.
+// +kubebuilder:validation:Enum=npm;pypi;go
+type RegistryKind string
+
+const (
+	// RegistryKindNpm is an npm registry, also used by yarn and pnpm.
+	RegistryKindNpm RegistryKind = "npm"
+
+	// RegistryKindPyPI is a Python package index.
+	RegistryKindPyPI RegistryKind = "pypi"
+
+	// RegistryKindGo is a Go module proxy or the host of private Go modules.
+	RegistryKindGo RegistryKind = "go"
+)
+
+// RegistrySpec is a private package registry the dependencies of the app are installed from.
+type RegistrySpec struct {
+	// Kind of the registry.
+	// +kubebuilder:validation:Required
+	Kind RegistryKind `json:"kind"`
+
+	// URL (optional) of the registry, e.g. https://npm.example.com/ or
+	// https://pypi.example.com/simple. It replaces the default registry, or for npm only serves
+	// the Scope. For Go it is a module proxy used before the proxy of the controller. Required
+	// for npm and pypi.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url,omitempty"`
+
+	// Scope (optional) of the npm packages served by the registry, e.g. @example.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^@[a-z0-9][a-z0-9._~-]*$`
+	Scope string `json:"scope,omitempty"`
+
+	// Modules (optional) are the path patterns of private Go modules, e.g. github.com/example/*.
+	// They skip the checksum database, and without URL they are fetched directly from their hosts.
+	// +kubebuilder:validation:Optional
+	Modules []string `json:"modules,omitempty"`
+
+	// SecretRef (optional) is the name of a Secret in the namespace of the Cdk8sAppProxy holding
+	// the credentials of the registry: a token in the key token, or the keys username and password.
+	// +kubebuilder:validation:Optional
+	SecretRef string `json:"secretRef,omitempty"`
+}
+
+// SynthSpec configures how the cdk8s app is synthesized.
+type SynthSpec struct {
+	// Language (optional) of the app. Defaults to the language of cdk8s.yaml in the app path, or
+	// the language detected from the files in the app path.
+	// +kubebuilder:validation:Optional
+	Language Language `json:"language,omitempty"`
+
+	// Toolchain (optional) configures the tools used to synthesize the app.
+	// +kubebuilder:validation:Optional
+	Toolchain ToolchainSpec `json:"toolchain,omitempty"`
+
+	// PerCluster (optional) synthesizes the app once per selected cluster and applies each result
+	// only to its cluster. The name, namespace, labels, annotations, Kubernetes version, topology
+	// variables, pod and service CIDRs and control plane endpoint of the cluster are handed to the
+	// app as cdk8s context and environment variables.
+	// +kubebuilder:validation:Optional
+	PerCluster bool `json:"perCluster,omitempty"`
+
+	// Registries (optional) are private package registries the dependencies of the app are
+	// installed from. Their configuration and credentials are only handed to the synth run.
+	// +kubebuilder:validation:Optional
+	Registries []RegistrySpec `json:"registries,omitempty"`
+}
+
+// KustomizeSelector selects the resources a kustomize patch applies to.
+type KustomizeSelector struct {
+	// Group (optional) of the resources.
+	// +kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+
+	// Version (optional) of the resources.
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// Kind (optional) of the resources.
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name (optional) of the resources, a regular expression.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace (optional) of the resources, a regular expression.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// LabelSelector (optional) the labels of the resources match.
+	// +kubebuilder:validation:Optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// AnnotationSelector (optional) the annotations of the resources match.
+	// +kubebuilder:validation:Optional
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// KustomizePatch is a strategic merge or JSON 6902 patch of the synthesized resources.
+type KustomizePatch struct {
+	// Patch is the content of the patch. Strategic merge patches name the patched resource,
+	// JSON 6902 patches need a Target.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Patch string `json:"patch"`
+
+	// Target (optional) selects the resources the patch applies to.
+	// +kubebuilder:validation:Optional
+	Target *KustomizeSelector `json:"target,omitempty"`
+}
+
+// KustomizeImage overrides the name, tag or digest of container images.
+type KustomizeImage struct {
+	// Name of the image in the synthesized resources.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// NewName (optional) replaces the name of the image.
+	// +kubebuilder:validation:Optional
+	NewName string `json:"newName,omitempty"`
+
+	// NewTag (optional) replaces the tag of the image.
+	// +kubebuilder:validation:Optional
+	NewTag string `json:"newTag,omitempty"`
+
+	// Digest (optional) replaces the tag of the image with a digest.
+	// +kubebuilder:validation:Optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// KustomizeSpec is a kustomize overlay applied to the synthesized resources.
+type KustomizeSpec struct {
+	// Namespace (optional) sets the namespace of all namespaced resources.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Patches (optional) are applied to the synthesized resources.
+	// +kubebuilder:validation:Optional
+	Patches []KustomizePatch `json:"patches,omitempty"`
+
+	// Images (optional) override container images of the synthesized resources.
+	// +kubebuilder:validation:Optional
+	Images []KustomizeImage `json:"images,omitempty"`
+}
+
+// SourceSpec is an additional app of a Cdk8sAppProxy. It is synthesized independently and its
+// resources are applied together with the resources of the other apps of the Cdk8sAppProxy.
+type SourceSpec struct {
+	// Name identifies the source in the status and in errors.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// GitRepository specifies the Git repository of the app. Sources of the same repository,
+	// reference and commit share a clone.
+	// +kubebuilder:validation:Optional
+	GitRepository *GitRepositorySpec `json:"gitRepository,omitempty"`
+
+	// OCIRepository specifies an OCI artifact with the pre-synthesized manifests of the app, as
+	// alternative to GitRepository.
+	// +kubebuilder:validation:Optional
+	OCIRepository *OCIRepositorySpec `json:"ociRepository,omitempty"`
+
+	// Renderer (optional) renders the resources of the app. Defaults to cdk8s, or yaml for OCI artifacts.
+	// +kubebuilder:validation:Optional
+	Renderer Renderer `json:"renderer,omitempty"`
+
+	// Synth (optional) configures how the app is synthesized. Per-cluster synthesis is configured
+	// for all sources by spec.synth.perCluster.
+	// +kubebuilder:validation:Optional
+	Synth *SynthSpec `json:"synth,omitempty"`
+}
+
+// Cdk8sAppProxyFinalizer lets the controller delete the applied resources from the selected clusters
+// before a Cdk8sAppProxy is removed.
+const Cdk8sAppProxyFinalizer = "addons.cluster.x-k8s.io/cdk8sappproxy"
+
+// ChartAnnotation names the chart of a resource for spec.chartTargets. Apps may set it on their
+// resources, otherwise the renderer sets it if spec.chartTargets is given, e.g. to the name of
+// their manifest file.
+const ChartAnnotation = "addons.cluster.x-k8s.io/chart"
+
+// ChartTarget deploys the resources of matching charts to a subset of the selected clusters.
+type ChartTarget struct {
+	// Chart is a glob pattern matching the chart of resources, the value of their
+	// addons.cluster.x-k8s.io/chart annotation. It defaults to the name of their manifest file in
+	// dist, or in the app path for the yaml renderer, e.g. control-plane.k8s.yaml or *-crds.k8s.yaml.
+	// Kustomizations in dist are charts named after their directory, the kustomize renderer uses
+	// ".", and the jsonnet and cue renderers the top-level field holding the resource.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Chart string `json:"chart"`
+
+	// ClusterSelector selects the clusters, among the clusters of spec.clusterSelector, the resources
+	// of matching charts are deployed to.
+	// +kubebuilder:validation:Required
+	ClusterSelector metav1.LabelSelector `json:"clusterSelector"`
+}
+
 // Cdk8sAppProxySpec defines the desired state of Cdk8sAppProxy.
 type Cdk8sAppProxySpec struct {
 	// GitRepository specifies the Git repository for the cdk8s app.
 	// +kubebuilder:validation:Optional
 	GitRepository *GitRepositorySpec `json:"gitRepository,omitempty"`
 
+	// OCIRepository specifies an OCI artifact with the pre-synthesized manifests of the app,
+	// as alternative to GitRepository. Its manifests are rendered by the yaml or kustomize
+	// renderer, defaulting to yaml.
+	// +kubebuilder:validation:Optional
+	OCIRepository *OCIRepositorySpec `json:"ociRepository,omitempty"`
+
+	// Sources (optional) are additional apps, e.g. further paths of the repository or a shared app of
+	// another repository. Each app is synthesized independently, and the resources of all apps are
+	// applied in the given order after the app of GitRepository or OCIRepository, once all apps
+	// synthesized. GitRepository and OCIRepository may be omitted if Sources are given.
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=name
+	Sources []SourceSpec `json:"sources,omitempty"`
+
 	// ClusterSelector selects the clusters to deploy the cdk8s app to.
 	// +kubebuilder:validation:Required
 	ClusterSelector metav1.LabelSelector `json:"clusterSelector"`
+
+	// ChartTargets (optional) deploy individual charts of the app to a subset of the selected
+	// clusters. The first target matching the chart of a resource decides, resources of charts
+	// matching no target are deployed to all selected clusters.
+	// +kubebuilder:validation:Optional
+	ChartTargets []ChartTarget `json:"chartTargets,omitempty"`
+
+	// Sleep (optional) scales the Deployments, StatefulSets and ReplicaSets of the app to zero
+	// replicas on the target clusters. The generator sets it on idle previews.
+	// +kubebuilder:validation:Optional
+	Sleep bool `json:"sleep,omitempty"`
+
+	// TargetNamespace (optional) applies all namespaced resources of the app to this namespace,
+	// which is created on the target clusters along with its guard rails.
+	// +kubebuilder:validation:Optional
+	TargetNamespace *TargetNamespaceSpec `json:"targetNamespace,omitempty"`
+
+	// Renderer (optional) renders the resources of the app. Defaults to cdk8s.
+	// +kubebuilder:validation:Optional
+	Renderer Renderer `json:"renderer,omitempty"`
+
+	// Synth (optional) configures how the cdk8s app is synthesized.
+	// +kubebuilder:validation:Optional
+	Synth *SynthSpec `json:"synth,omitempty"`
+
+	// Values (optional) are free-form input values handed to the app as cdk8s context and
+	// environment variable. They are merged on top of the values read from ValuesFrom.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+
+	// ValuesFrom (optional) reads values from ConfigMaps and Secrets, merged in the given order.
+	// Changes to the referenced objects synthesize the app again.
+	// +kubebuilder:validation:Optional
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+
+	// Kustomize (optional) is an overlay applied to the synthesized resources, after a kustomization
+	// in the output of the app was built.
+	// +kubebuilder:validation:Optional
+	Kustomize *KustomizeSpec `json:"kustomize,omitempty"`
 }
 
 // Cdk8sAppProxyStatus defines the observed state of Cdk8sAppProxy.
@@ -72,6 +496,52 @@ type Cdk8sAppProxyStatus struct {
 	// +optional
 	// Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ValuesHash is the SHA-256 hash of the merged values the app was last synthesized with.
+	// +optional
+	ValuesHash string `json:"valuesHash,omitempty"`
+
+	// ArtifactDigest is the manifest digest of the OCI artifact the resources were last read from.
+	// +optional
+	ArtifactDigest string `json:"artifactDigest,omitempty"`
+
+	// Sources is the state of the apps of spec.sources.
+	// +optional
+	Sources []SourceStatus `json:"sources,omitempty"`
+
+	// Inventory lists the resources of all apps last applied to the selected clusters.
+	// +optional
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
+}
+
+// SourceStatus is the observed state of an app of spec.sources.
+type SourceStatus struct {
+	// Name of the source.
+	Name string `json:"name"`
+
+	// ArtifactDigest is the manifest digest of the OCI artifact the resources were last read from.
+	// +optional
+	ArtifactDigest string `json:"artifactDigest,omitempty"`
+
+	// Resources is the number of resources the app last rendered.
+	// +optional
+	Resources int32 `json:"resources,omitempty"`
+}
+
+// InventoryEntry references a resource applied by the Cdk8sAppProxy.
+type InventoryEntry struct {
+	// APIVersion of the resource.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the resource.
+	Kind string `json:"kind"`
+
+	// Namespace of the resource, empty for cluster-scoped resources.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the resource.
+	Name string `json:"name"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,133 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateSynth(t *testing.T) {
+	tests := []struct {
+		name    string
+		synth   *SynthSpec
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "package manager with detected language", synth: &SynthSpec{Toolchain: ToolchainSpec{PackageManager: PackageManagerPnpm}}},
+		{name: "package manager for typescript", synth: &SynthSpec{Language: LanguageTypeScript, Toolchain: ToolchainSpec{PackageManager: PackageManagerYarn}}},
+		{name: "package manager for python", synth: &SynthSpec{Language: LanguagePython, Toolchain: ToolchainSpec{PackageManager: PackageManagerNpm}}, wantErr: true},
+		{name: "scoped npm registry", synth: &SynthSpec{Registries: []RegistrySpec{{Kind: RegistryKindNpm, URL: "https://npm.example.com/", Scope: "@example"}}}},
+		{name: "private go modules", synth: &SynthSpec{Registries: []RegistrySpec{{Kind: RegistryKindGo, Modules: []string{"github.com/example/*"}}}}},
+		{name: "pypi without url", synth: &SynthSpec{Registries: []RegistrySpec{{Kind: RegistryKindPyPI}}}, wantErr: true},
+		{name: "go without url and modules", synth: &SynthSpec{Registries: []RegistrySpec{{Kind: RegistryKindGo}}}, wantErr: true},
+		{name: "scope for pypi", synth: &SynthSpec{Registries: []RegistrySpec{{Kind: RegistryKindPyPI, URL: "https://pypi.example.com/simple", Scope: "@example"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateSynth(tt.synth); tt.wantErr != (len(errs) > 0) {
+				t.Errorf("expected errors %v, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateKustomize(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Cdk8sAppProxySpec
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "namespace", spec: Cdk8sAppProxySpec{Kustomize: &KustomizeSpec{Namespace: "apps"}}},
+		{name: "images with target namespace", spec: Cdk8sAppProxySpec{Kustomize: &KustomizeSpec{Images: []KustomizeImage{{Name: "nginx", NewTag: "1.27"}}}, TargetNamespace: &TargetNamespaceSpec{Name: "apps"}}},
+		{name: "namespace with target namespace", spec: Cdk8sAppProxySpec{Kustomize: &KustomizeSpec{Namespace: "apps"}, TargetNamespace: &TargetNamespaceSpec{Name: "apps"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateKustomize(&tt.spec); tt.wantErr != (len(errs) > 0) {
+				t.Errorf("expected errors %v, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRenderer(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Cdk8sAppProxySpec
+		wantErr bool
+	}{
+		{name: "default renderer", spec: Cdk8sAppProxySpec{Synth: &SynthSpec{Language: LanguageGo}}},
+		{name: "per-cluster jsonnet", spec: Cdk8sAppProxySpec{Renderer: RendererJsonnet, Synth: &SynthSpec{PerCluster: true}}},
+		{name: "language for yaml", spec: Cdk8sAppProxySpec{Renderer: RendererYAML, Synth: &SynthSpec{Language: LanguageGo}}, wantErr: true},
+		{name: "toolchain for cue", spec: Cdk8sAppProxySpec{Renderer: RendererCUE, Synth: &SynthSpec{Toolchain: ToolchainSpec{Cdk8sCLIVersion: "2.0.0"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateRenderer(&tt.spec); tt.wantErr != (len(errs) > 0) {
+				t.Errorf("expected errors %v, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	git := &GitRepositorySpec{URL: "https://github.com/example/app"}
+	oci := &OCIRepositorySpec{URL: "oci://ghcr.io/example/app-manifests"}
+
+	tests := []struct {
+		name    string
+		spec    Cdk8sAppProxySpec
+		wantErr bool
+	}{
+		{name: "git repository", spec: Cdk8sAppProxySpec{GitRepository: git, Synth: &SynthSpec{Language: LanguageGo}}},
+		{name: "oci repository", spec: Cdk8sAppProxySpec{OCIRepository: oci}},
+		{name: "oci repository with kustomize", spec: Cdk8sAppProxySpec{OCIRepository: oci, Renderer: RendererKustomize}},
+		{name: "no source", wantErr: true},
+		{name: "both sources", spec: Cdk8sAppProxySpec{GitRepository: git, OCIRepository: oci}, wantErr: true},
+		{name: "oci repository with cdk8s", spec: Cdk8sAppProxySpec{OCIRepository: oci, Renderer: RendererCdk8s}, wantErr: true},
+		{name: "oci repository with synth", spec: Cdk8sAppProxySpec{OCIRepository: oci, Synth: &SynthSpec{PerCluster: true}}, wantErr: true},
+		{name: "sources only", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared", GitRepository: git}, {Name: "crds", OCIRepository: oci}}}},
+		{name: "sources with git repository", spec: Cdk8sAppProxySpec{GitRepository: git, Sources: []SourceSpec{{Name: "shared", GitRepository: git, Synth: &SynthSpec{Language: LanguagePython}}}}},
+		{name: "source without repository", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared"}}}, wantErr: true},
+		{name: "source with both repositories", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared", GitRepository: git, OCIRepository: oci}}}, wantErr: true},
+		{name: "duplicate source names", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared", GitRepository: git}, {Name: "shared", OCIRepository: oci}}}, wantErr: true},
+		{name: "oci source with synth", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "crds", OCIRepository: oci, Synth: &SynthSpec{}}}}, wantErr: true},
+		{name: "source with per-cluster synthesis", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared", GitRepository: git, Synth: &SynthSpec{PerCluster: true}}}}, wantErr: true},
+		{name: "source with synth language and yaml", spec: Cdk8sAppProxySpec{Sources: []SourceSpec{{Name: "shared", GitRepository: git, Renderer: RendererYAML, Synth: &SynthSpec{Language: LanguageGo}}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateSource(&tt.spec); tt.wantErr != (len(errs) > 0) {
+				t.Errorf("expected errors %v, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateChartTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []ChartTarget
+		wantErr bool
+	}{
+		{name: "file name", targets: []ChartTarget{{Chart: "control-plane.k8s.yaml", ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "management"}}}}},
+		{name: "glob", targets: []ChartTarget{{Chart: "*-crds.k8s.yaml"}}},
+		{name: "invalid glob", targets: []ChartTarget{{Chart: "[control-plane"}}, wantErr: true},
+		{name: "invalid selector", targets: []ChartTarget{{Chart: "workload", ClusterSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "role", Operator: metav1.LabelSelectorOpIn},
+		}}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := validateChartTargets(tt.targets); tt.wantErr != (len(errs) > 0) {
+				t.Errorf("expected errors %v, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
@@ -18,9 +18,12 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"path"
 	"reflect"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -51,17 +54,29 @@ var (
 func (*cdk8sAppProxyWebhook) Default(_ context.Context, obj *Cdk8sAppProxy) error {
 	cdk8sappproxylog.Info("default", "name", obj.Name)
 
+	defaultGitRepository(obj.Spec.GitRepository)
+	for idx := range obj.Spec.Sources {
+		defaultGitRepository(obj.Spec.Sources[idx].GitRepository)
+	}
+
+	return nil
+}
+
+// defaultGitRepository sets the defaults of the optional fields of a Git source.
+func defaultGitRepository(repo *GitRepositorySpec) {
+	if repo == nil {
+		return
+	}
+
 	// Defining the Reference is optional, so we set a default value.
-	if obj.Spec.GitRepository.Reference == "" {
-		obj.Spec.GitRepository.Reference = "main"
+	if repo.Reference == "" {
+		repo.Reference = "main"
 	}
 
 	// Defining the Path is optional, so we set a default value.
-	if obj.Spec.GitRepository.Path == "" {
-		obj.Spec.GitRepository.Path = "."
+	if repo.Path == "" {
+		repo.Path = "."
 	}
-
-	return nil
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -73,12 +88,18 @@ func (*cdk8sAppProxyWebhook) ValidateCreate(_ context.Context, obj *Cdk8sAppProx
 
 	cdk8sappproxylog.Info("validate create", "name", obj.Name) 
 
-	if obj.Spec.GitRepository.URL == "" {
+	if obj.Spec.GitRepository != nil && obj.Spec.GitRepository.URL == "" {
 		allErrs = append(allErrs,
 			field.Invalid(field.NewPath("spec", "GitRepository", "URL"),
 				obj.Spec.GitRepository.URL, "GitRepository.URL must be specified"))
 	}
 
+	allErrs = append(allErrs, validateSource(&obj.Spec)...)
+	allErrs = append(allErrs, validateSynth(obj.Spec.Synth)...)
+	allErrs = append(allErrs, validateKustomize(&obj.Spec)...)
+	allErrs = append(allErrs, validateRenderer(&obj.Spec)...)
+	allErrs = append(allErrs, validateChartTargets(obj.Spec.ChartTargets)...)
+
 	if len(allErrs) > 0 {
 		return nil, apierrors.NewInvalid(GroupVersion.WithKind("Cdk8sAppProxy").GroupKind(), obj.Name, allErrs)
 	}
@@ -92,13 +113,20 @@ func (*cdk8sAppProxyWebhook) ValidateUpdate(_ context.Context, oldObjRaw, newObj
 
 	cdk8sappproxylog.Info("validate update", "name", newObjRaw.Name)
 
-	if !reflect.DeepEqual(newObjRaw.Spec.GitRepository.URL, oldObjRaw.Spec.GitRepository.URL) {
+	if newObjRaw.Spec.GitRepository != nil && oldObjRaw.Spec.GitRepository != nil &&
+		!reflect.DeepEqual(newObjRaw.Spec.GitRepository.URL, oldObjRaw.Spec.GitRepository.URL) {
 		allErrs = append(allErrs,
 			field.Invalid(field.NewPath("spec", "GitRepository", "URL"),
 				newObjRaw.Spec.GitRepository.URL, "field is immutable"),
 		)
 	}
 
+	allErrs = append(allErrs, validateSource(&newObjRaw.Spec)...)
+	allErrs = append(allErrs, validateSynth(newObjRaw.Spec.Synth)...)
+	allErrs = append(allErrs, validateKustomize(&newObjRaw.Spec)...)
+	allErrs = append(allErrs, validateRenderer(&newObjRaw.Spec)...)
+	allErrs = append(allErrs, validateChartTargets(newObjRaw.Spec.ChartTargets)...)
+
 	if len(allErrs) > 0 {
 		return nil, apierrors.NewInvalid(GroupVersion.WithKind("Cdk8sAppProxy").GroupKind(), newObjRaw.Name, allErrs)
 	}
@@ -106,6 +134,172 @@ func (*cdk8sAppProxyWebhook) ValidateUpdate(_ context.Context, oldObjRaw, newObj
 	return nil, nil
 }
 
+// validateSource checks that the app has exactly one source, and that the manifests of an OCI artifact
+// are rendered without running code.
+func validateSource(spec *Cdk8sAppProxySpec) (allErrs field.ErrorList) {
+	switch {
+	case spec.GitRepository == nil && spec.OCIRepository == nil && len(spec.Sources) == 0:
+		allErrs = append(allErrs,
+			field.Required(field.NewPath("spec", "gitRepository"), "either gitRepository, ociRepository or sources must be specified"))
+	case spec.GitRepository != nil && spec.OCIRepository != nil:
+		allErrs = append(allErrs,
+			field.Forbidden(field.NewPath("spec", "ociRepository"), "must not be set together with spec.gitRepository"))
+	}
+
+	if spec.OCIRepository != nil {
+		allErrs = append(allErrs, validateArtifact(field.NewPath("spec"), spec.Renderer, spec.Synth)...)
+	}
+
+	return append(allErrs, validateSources(spec.Sources)...)
+}
+
+// validateSources checks that every additional app has exactly one source and fitting synth settings.
+func validateSources(sources []SourceSpec) (allErrs field.ErrorList) {
+	names := map[string]bool{}
+	for idx, source := range sources {
+		path := field.NewPath("spec", "sources").Index(idx)
+		if names[source.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), source.Name))
+		}
+		names[source.Name] = true
+
+		switch {
+		case source.GitRepository == nil && source.OCIRepository == nil:
+			allErrs = append(allErrs,
+				field.Required(path.Child("gitRepository"), "either gitRepository or ociRepository must be specified"))
+		case source.GitRepository != nil && source.OCIRepository != nil:
+			allErrs = append(allErrs,
+				field.Forbidden(path.Child("ociRepository"), "must not be set together with gitRepository"))
+		}
+		if source.GitRepository != nil && source.GitRepository.URL == "" {
+			allErrs = append(allErrs, field.Required(path.Child("gitRepository", "url"), "must be specified"))
+		}
+
+		if source.OCIRepository != nil {
+			allErrs = append(allErrs, validateArtifact(path, source.Renderer, source.Synth)...)
+		}
+		if source.Synth != nil && source.Synth.PerCluster {
+			allErrs = append(allErrs,
+				field.Forbidden(path.Child("synth", "perCluster"), "per-cluster synthesis is configured for all sources by spec.synth.perCluster"))
+		}
+		allErrs = append(allErrs, validateSynthAt(path.Child("synth"), source.Synth)...)
+		allErrs = append(allErrs, validateRendererAt(path, source.Renderer, source.Synth)...)
+	}
+
+	return allErrs
+}
+
+// validateArtifact checks that the manifests of an OCI artifact are rendered without running code.
+func validateArtifact(path *field.Path, renderer Renderer, synth *SynthSpec) (allErrs field.ErrorList) {
+	switch renderer {
+	case "", RendererYAML, RendererKustomize:
+	default:
+		allErrs = append(allErrs,
+			field.NotSupported(path.Child("renderer"), renderer,
+				[]string{string(RendererYAML), string(RendererKustomize)}))
+	}
+	if synth != nil {
+		allErrs = append(allErrs,
+			field.Forbidden(path.Child("synth"), "is not supported for pre-synthesized manifests of an OCI repository"))
+	}
+
+	return allErrs
+}
+
+// validateSynth checks that the toolchain settings fit the language of the app and the registries are complete.
+func validateSynth(synth *SynthSpec) (allErrs field.ErrorList) {
+	return validateSynthAt(field.NewPath("spec", "synth"), synth)
+}
+
+func validateSynthAt(path *field.Path, synth *SynthSpec) (allErrs field.ErrorList) {
+	if synth == nil {
+		return nil
+	}
+
+	if synth.Toolchain.PackageManager != "" && synth.Language != "" && synth.Language != LanguageTypeScript {
+		allErrs = append(allErrs,
+			field.Invalid(path.Child("toolchain", "packageManager"),
+				synth.Toolchain.PackageManager, "package managers are supported for TypeScript apps only"))
+	}
+
+	for idx, registry := range synth.Registries {
+		path := path.Child("registries").Index(idx)
+		if registry.URL == "" && registry.Kind != RegistryKindGo {
+			allErrs = append(allErrs, field.Required(path.Child("url"), fmt.Sprintf("is required for %s registries", registry.Kind)))
+		}
+		if registry.URL == "" && registry.Kind == RegistryKindGo && len(registry.Modules) == 0 {
+			allErrs = append(allErrs, field.Required(path.Child("modules"), "is required for go registries without url"))
+		}
+		if registry.Scope != "" && registry.Kind != RegistryKindNpm {
+			allErrs = append(allErrs, field.Forbidden(path.Child("scope"), "is supported for npm registries only"))
+		}
+		if len(registry.Modules) > 0 && registry.Kind != RegistryKindGo {
+			allErrs = append(allErrs, field.Forbidden(path.Child("modules"), "is supported for go registries only"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateKustomize checks that the overlay namespace does not compete with the target namespace.
+func validateKustomize(spec *Cdk8sAppProxySpec) (allErrs field.ErrorList) {
+	if spec.Kustomize == nil {
+		return nil
+	}
+
+	if spec.Kustomize.Namespace != "" && spec.TargetNamespace != nil {
+		allErrs = append(allErrs,
+			field.Forbidden(field.NewPath("spec", "kustomize", "namespace"),
+				"must not be set together with spec.targetNamespace"))
+	}
+
+	return allErrs
+}
+
+// validateRenderer checks that the cdk8s synth settings are only used with the cdk8s renderer.
+func validateRenderer(spec *Cdk8sAppProxySpec) (allErrs field.ErrorList) {
+	return validateRendererAt(field.NewPath("spec"), spec.Renderer, spec.Synth)
+}
+
+func validateRendererAt(path *field.Path, renderer Renderer, synth *SynthSpec) (allErrs field.ErrorList) {
+	if synth == nil || renderer == "" || renderer == RendererCdk8s {
+		return nil
+	}
+
+	if synth.Language != "" {
+		allErrs = append(allErrs,
+			field.Forbidden(path.Child("synth", "language"),
+				fmt.Sprintf("is not supported by the %s renderer", renderer)))
+	}
+	if synth.Toolchain != (ToolchainSpec{}) {
+		allErrs = append(allErrs,
+			field.Forbidden(path.Child("synth", "toolchain"),
+				fmt.Sprintf("is not supported by the %s renderer", renderer)))
+	}
+	if len(synth.Registries) > 0 {
+		allErrs = append(allErrs,
+			field.Forbidden(path.Child("synth", "registries"),
+				fmt.Sprintf("is not supported by the %s renderer", renderer)))
+	}
+
+	return allErrs
+}
+
+// validateChartTargets checks that the chart patterns and cluster selectors of the chart targets are valid.
+func validateChartTargets(targets []ChartTarget) (allErrs field.ErrorList) {
+	for idx, target := range targets {
+		targetPath := field.NewPath("spec", "chartTargets").Index(idx)
+		if _, err := path.Match(target.Chart, ""); err != nil {
+			allErrs = append(allErrs, field.Invalid(targetPath.Child("chart"), target.Chart, err.Error()))
+		}
+		if _, err := metav1.LabelSelectorAsSelector(&target.ClusterSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(targetPath.Child("clusterSelector"), target.ClusterSelector, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
 func (*cdk8sAppProxyWebhook) ValidateDelete(_ context.Context, obj *Cdk8sAppProxy) (admission.Warnings, error) {
 	cdk8sappproxylog.Info("validate delete", "name", obj.Name)
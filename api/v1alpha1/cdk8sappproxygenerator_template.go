@@ -0,0 +1,204 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// TemplateVars are the variables available to the Go template expressions in the string fields of
+// a Cdk8sAppProxyTemplate, e.g. "pr-{{ .Number }}" or "{{ .Branch | dnsLabel }}".
+// +kubebuilder:object:generate=false
+type TemplateVars struct {
+	// Number is the pull request number. It is 0 for branches and tags.
+	Number int
+	// Ref is the name of the PR branch, branch or tag the Cdk8sAppProxy is generated for.
+	Ref string
+	// Branch is the head branch of the pull request, or the branch in Branches mode.
+	Branch string
+	// HeadSHA is the commit the generated Cdk8sAppProxy is pinned to.
+	HeadSHA string
+	// BaseBranch is the branch the pull request targets.
+	BaseBranch string
+	// Author is the user name of the pull request author.
+	Author string
+	// Labels are the labels of the pull request.
+	Labels []string
+}
+
+var invalidDNSLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// untemplatedFields are the field paths handed to the app as they are. Values are input of the app,
+// which may use template syntax of its own (e.g. Helm or Jsonnet values), and are never rendered.
+var untemplatedFields = map[string]bool{"spec.values": true}
+
+// templateFuncs are the functions available in Cdk8sAppProxyTemplate expressions.
+var templateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"join":    func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"hasLabel": func(label string, labels []string) bool {
+		return slices.Contains(labels, label)
+	},
+	"trunc": func(length int, s string) string {
+		if len(s) > length {
+			return s[:length]
+		}
+
+		return s
+	},
+	// dnsLabel turns s into a valid DNS label (e.g. for namespaces), like feature/Foo_bar into feature-foo-bar.
+	"dnsLabel": func(s string) string {
+		label := invalidDNSLabelChars.ReplaceAllString(strings.ToLower(s), "-")
+		if len(label) > 63 {
+			label = label[:63]
+		}
+
+		return strings.Trim(label, "-")
+	},
+}
+
+// isTemplated reports whether s contains a template expression.
+func isTemplated(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// ParseExpressions parses every template expression of the template and returns the errors by field path.
+func (t *Cdk8sAppProxyTemplate) ParseExpressions() (errs map[string]error) {
+	errs = make(map[string]error)
+
+	_, err := t.transformStrings(func(fieldPath string, s string) (string, error) {
+		if _, err := template.New(fieldPath).Funcs(templateFuncs).Option("missingkey=error").Parse(s); err != nil {
+			errs[fieldPath] = err
+		}
+
+		return s, nil
+	})
+	if err != nil {
+		errs["template"] = err
+	}
+
+	return errs
+}
+
+// Render returns a copy of the template with every template expression in its labels, annotations
+// and spec string fields executed against vars.
+func (t *Cdk8sAppProxyTemplate) Render(vars TemplateVars) (rendered *Cdk8sAppProxyTemplate, err error) {
+	return t.transformStrings(func(fieldPath string, s string) (string, error) {
+		tmpl, err := template.New(fieldPath).Funcs(templateFuncs).Option("missingkey=error").Parse(s)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", fieldPath, err)
+		}
+
+		var out bytes.Buffer
+		if err = tmpl.Execute(&out, vars); err != nil {
+			return "", fmt.Errorf("failed to render %s: %w", fieldPath, err)
+		}
+
+		return out.String(), nil
+	})
+}
+
+// transformStrings applies transform to every templated string value of the labels, annotations
+// and spec of the template except the untemplatedFields and returns the transformed copy. Map keys
+// are never transformed.
+func (t *Cdk8sAppProxyTemplate) transformStrings(transform func(fieldPath string, s string) (string, error)) (*Cdk8sAppProxyTemplate, error) {
+	fields := map[string]any{
+		"metadata.labels":      t.Metadata.Labels,
+		"metadata.annotations": t.Metadata.Annotations,
+		"spec":                 t.Spec,
+	}
+
+	transformed := make(map[string]any, len(fields))
+	for fieldPath, field := range fields {
+		raw, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if err = json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+
+		if transformed[fieldPath], err = transformValue(fieldPath, value, transform); err != nil {
+			return nil, err
+		}
+	}
+
+	result := t.DeepCopy()
+	targets := map[string]any{
+		"metadata.labels":      &result.Metadata.Labels,
+		"metadata.annotations": &result.Metadata.Annotations,
+		"spec":                 &result.Spec,
+	}
+	for fieldPath, target := range targets {
+		raw, err := json.Marshal(transformed[fieldPath])
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(raw, target); err != nil {
+			return nil, fmt.Errorf("failed to decode rendered %s: %w", fieldPath, err)
+		}
+	}
+
+	return result, nil
+}
+
+func transformValue(fieldPath string, value any, transform func(fieldPath string, s string) (string, error)) (any, error) {
+	if untemplatedFields[fieldPath] {
+		return value, nil
+	}
+
+	switch typed := value.(type) {
+	case string:
+		if !isTemplated(typed) {
+			return typed, nil
+		}
+
+		return transform(fieldPath, typed)
+	case map[string]any:
+		for key, child := range typed {
+			transformedChild, err := transformValue(fieldPath+"."+key, child, transform)
+			if err != nil {
+				return nil, err
+			}
+			typed[key] = transformedChild
+		}
+
+		return typed, nil
+	case []any:
+		for i, child := range typed {
+			transformedChild, err := transformValue(fmt.Sprintf("%s[%d]", fieldPath, i), child, transform)
+			if err != nil {
+				return nil, err
+			}
+			typed[i] = transformedChild
+		}
+
+		return typed, nil
+	default:
+		return value, nil
+	}
+}
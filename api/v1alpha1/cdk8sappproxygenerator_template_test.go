@@ -0,0 +1,87 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestTemplate() *Cdk8sAppProxyTemplate {
+	return &Cdk8sAppProxyTemplate{
+		Metadata: metav1.ObjectMeta{
+			Labels:      map[string]string{"pr": "{{ .Number }}", "static": "value"},
+			Annotations: map[string]string{"commit": "{{ .HeadSHA | trunc 7 }}"},
+		},
+		Spec: Cdk8sAppProxySpec{
+			GitRepository: &GitRepositorySpec{Path: "apps/{{ .Branch | dnsLabel }}"},
+			ClusterSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"{{ .Number }}": "{{ .BaseBranch }}"},
+			},
+		},
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	tmpl := newTestTemplate()
+
+	rendered, err := tmpl.Render(TemplateVars{Number: 42, Branch: "Feature/Foo_bar", HeadSHA: "0123456789abcdef", BaseBranch: "main"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got := rendered.Metadata.Labels["pr"]; got != "42" {
+		t.Errorf("expected label pr=42, got %q", got)
+	}
+	if got := rendered.Metadata.Labels["static"]; got != "value" {
+		t.Errorf("expected static label to be kept, got %q", got)
+	}
+	if got := rendered.Metadata.Annotations["commit"]; got != "0123456" {
+		t.Errorf("expected truncated commit annotation, got %q", got)
+	}
+	if got := rendered.Spec.GitRepository.Path; got != "apps/feature-foo-bar" {
+		t.Errorf("expected rendered path, got %q", got)
+	}
+	if got := rendered.Spec.ClusterSelector.MatchLabels["{{ .Number }}"]; got != "main" {
+		t.Errorf("expected map keys to be kept and values rendered, got %v", rendered.Spec.ClusterSelector.MatchLabels)
+	}
+	if got := tmpl.Metadata.Labels["pr"]; got != "{{ .Number }}" {
+		t.Errorf("expected the template to be left untouched, got %q", got)
+	}
+}
+
+func TestTemplateRenderKeepsValues(t *testing.T) {
+	tmpl := newTestTemplate()
+	tmpl.Spec.Values = &apiextensionsv1.JSON{Raw: []byte(`{"image":"{{ .Values.image }}","tag":"{{ .Unknown }}"}`)}
+
+	rendered, err := tmpl.Render(TemplateVars{Number: 42})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := string(rendered.Spec.Values.Raw); got != `{"image":"{{ .Values.image }}","tag":"{{ .Unknown }}"}` {
+		t.Errorf("expected values to be kept as they are, got %s", got)
+	}
+	if errs := tmpl.ParseExpressions(); len(errs) != 0 {
+		t.Errorf("expected values not to be parsed, got %v", errs)
+	}
+}
+
+func TestTemplateRenderUnknownVariable(t *testing.T) {
+	tmpl := &Cdk8sAppProxyTemplate{Metadata: metav1.ObjectMeta{Labels: map[string]string{"pr": "{{ .Unknown }}"}}}
+
+	if _, err := tmpl.Render(TemplateVars{}); err == nil {
+		t.Errorf("expected an error for an unknown variable")
+	}
+}
+
+func TestTemplateParseExpressions(t *testing.T) {
+	if errs := newTestTemplate().ParseExpressions(); len(errs) != 0 {
+		t.Errorf("expected no parse errors, got %v", errs)
+	}
+
+	tmpl := &Cdk8sAppProxyTemplate{Metadata: metav1.ObjectMeta{Annotations: map[string]string{"broken": "{{ .Number "}}}
+	errs := tmpl.ParseExpressions()
+	if _, ok := errs["metadata.annotations.broken"]; !ok || len(errs) != 1 {
+		t.Errorf("expected a parse error for metadata.annotations.broken, got %v", errs)
+	}
+}
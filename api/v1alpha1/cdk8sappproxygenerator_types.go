@@ -17,17 +17,174 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"regexp"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+// GeneratorMode defines what the generator creates a Cdk8sAppProxy for.
+// +kubebuilder:validation:Enum=PullRequests;Branches;Tags
+type GeneratorMode string
+
+const (
+	// GeneratorModePullRequests creates a Cdk8sAppProxy per open pull request.
+	GeneratorModePullRequests GeneratorMode = "PullRequests"
+	// GeneratorModeBranches creates a Cdk8sAppProxy per branch matching the ref patterns.
+	GeneratorModeBranches GeneratorMode = "Branches"
+	// GeneratorModeTags creates a Cdk8sAppProxy per tag matching the ref patterns.
+	GeneratorModeTags GeneratorMode = "Tags"
 )
 
+// DefaultGeneratorPollInterval is the poll interval of generators that do not set one.
+const DefaultGeneratorPollInterval = 5 * time.Minute
+
 // PRFilter defines criteria for matching pull requests.
 type PRFilter struct {
-	// BranchMatch is a regex to match the base branch of the PR.
+	// BranchMatch is a regex to match the base branch of the PR. It has to match the whole branch
+	// name, e.g. "release/.*" matches release/1.0 but not hotfix/release/1.0.
 	// +optional
 	BranchMatch string `json:"branchMatch,omitempty"`
 }
 
-// Cdk8sAppProxyTemplate defines the Cdk8sAppProxy to be generated for each PR.
+// BranchRegexp compiles BranchMatch, anchored to match the whole branch name.
+func (f PRFilter) BranchRegexp() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + f.BranchMatch + ")$")
+}
+
+// PreviewTriggerMode defines when the generator creates a preview for a pull request.
+// +kubebuilder:validation:Enum=Always;OnDemand
+type PreviewTriggerMode string
+
+const (
+	// PreviewTriggerAlways creates a preview for every open pull request matching the filters.
+	PreviewTriggerAlways PreviewTriggerMode = "Always"
+	// PreviewTriggerOnDemand only creates a preview for a pull request carrying the trigger label
+	// or after a maintainer requested one with a command comment.
+	PreviewTriggerOnDemand PreviewTriggerMode = "OnDemand"
+)
+
+// CommandAcknowledgement defines how the generator acknowledges a handled command comment.
+// +kubebuilder:validation:Enum=Reaction;Comment;None
+type CommandAcknowledgement string
+
+const (
+	// CommandAcknowledgementReaction adds a reaction to the command comment. Providers without
+	// reactions (Bitbucket) fall back to a reply comment.
+	CommandAcknowledgementReaction CommandAcknowledgement = "Reaction"
+	// CommandAcknowledgementComment replies to the command with a comment on the pull request.
+	CommandAcknowledgementComment CommandAcknowledgement = "Comment"
+	// CommandAcknowledgementNone does not acknowledge command comments.
+	CommandAcknowledgementNone CommandAcknowledgement = "None"
+)
+
+// PreviewTrigger defines how previews are requested for pull requests.
+type PreviewTrigger struct {
+	// Mode defines when a preview is created. Defaults to Always.
+	// +optional
+	Mode PreviewTriggerMode `json:"mode,omitempty"`
+
+	// Label (optional) creates a preview for every pull request carrying this label while in OnDemand mode.
+	// +optional
+	Label string `json:"label,omitempty"`
+
+	// Command is the comment command used to request a preview while in OnDemand mode.
+	// "<command> destroy" removes the preview again. Defaults to "/preview".
+	// +optional
+	Command string `json:"command,omitempty"`
+
+	// Maintainers lists the provider user names allowed to issue commands. On GitHub, owners,
+	// members and collaborators of the repository are always allowed.
+	// +optional
+	Maintainers []string `json:"maintainers,omitempty"`
+
+	// Acknowledge defines how handled commands are acknowledged. Defaults to Reaction.
+	// +optional
+	Acknowledge CommandAcknowledgement `json:"acknowledge,omitempty"`
+}
+
+// ForkPolicyMode defines whether previews are created for pull requests from forks.
+// +kubebuilder:validation:Enum=Deny;RequireLabel;AllowAuthors
+type ForkPolicyMode string
+
+const (
+	// ForkPolicyDeny never creates previews for pull requests from forks.
+	ForkPolicyDeny ForkPolicyMode = "Deny"
+	// ForkPolicyRequireLabel creates previews for pull requests from forks once a maintainer added the approval label.
+	ForkPolicyRequireLabel ForkPolicyMode = "RequireLabel"
+	// ForkPolicyAllowAuthors creates previews for pull requests from forks opened by the listed authors.
+	ForkPolicyAllowAuthors ForkPolicyMode = "AllowAuthors"
+)
+
+// ForkPolicy defines how pull requests from forks are handled. Code from forks is untrusted, as it
+// is installed and synthesized by the controller, so it is only deployed after explicit approval.
+type ForkPolicy struct {
+	// Mode defines whether previews are created for pull requests from forks. Defaults to Deny.
+	// +optional
+	Mode ForkPolicyMode `json:"mode,omitempty"`
+
+	// Label is the label a maintainer adds to approve a pull request from a fork in RequireLabel mode.
+	// +optional
+	Label string `json:"label,omitempty"`
+
+	// Authors lists the provider user names whose pull requests from forks are trusted in AllowAuthors mode.
+	// +optional
+	Authors []string `json:"authors,omitempty"`
+}
+
+// PRCheckoutMode defines which revision of a pull request is deployed.
+// +kubebuilder:validation:Enum=Head;Merge
+type PRCheckoutMode string
+
+const (
+	// PRCheckoutHead deploys the head commit of the pull request.
+	PRCheckoutHead PRCheckoutMode = "Head"
+	// PRCheckoutMerge deploys the provider's merge result of the pull request into its base branch
+	// (refs/pull/<n>/merge on GitHub, refs/merge-requests/<n>/merge on GitLab).
+	PRCheckoutMerge PRCheckoutMode = "Merge"
+)
+
+// PreviewCapacity limits the number and lifetime of the generated Cdk8sAppProxies.
+type PreviewCapacity struct {
+	// MaxPreviews (optional) limits the number of concurrently deployed previews. Further pull
+	// requests, branches or tags are queued in order until a preview is removed. Queued pull
+	// requests get a pending commit status explaining the wait.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxPreviews *int32 `json:"maxPreviews,omitempty"`
+
+	// TTL (optional) removes a preview once no commit has been pushed for this duration. The
+	// preview is deployed again on the next push.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// SleepAfter (optional) scales the workloads of a preview to zero replicas on the workload
+	// clusters once no commit has been pushed for this duration. The next push wakes it up again.
+	// +optional
+	SleepAfter *metav1.Duration `json:"sleepAfter,omitempty"`
+}
+
+// PreviewClusterLabel is set on generated Clusters to their name, so the Cdk8sAppProxy of the preview
+// selects only them.
+const PreviewClusterLabel = "addons.cluster.x-k8s.io/preview-cluster"
+
+// PreviewClusterTemplate defines the CAPI Cluster created for every preview.
+type PreviewClusterTemplate struct {
+	// Metadata allows setting labels and annotations on the generated Cluster.
+	// +optional
+	Metadata metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Topology defines the ClusterClass (classRef), Kubernetes version, control plane, workers and
+	// variables of the generated Cluster.
+	Topology clusterv1.Topology `json:"topology"`
+
+	// ClusterNetwork (optional) defines the pod and service networks of the generated Cluster.
+	// +optional
+	ClusterNetwork *clusterv1.ClusterNetwork `json:"clusterNetwork,omitempty"`
+}
+
+// Cdk8sAppProxyTemplate defines the Cdk8sAppProxy to be generated for each PR, branch or tag.
 type Cdk8sAppProxyTemplate struct {
 	// Metadata allows setting labels and annotations on the generated Cdk8sAppProxy.
 	// +optional
@@ -39,14 +196,23 @@ type Cdk8sAppProxyTemplate struct {
 
 // Cdk8sAppProxyGeneratorSpec defines the desired state of Cdk8sAppProxyGenerator.
 type Cdk8sAppProxyGeneratorSpec struct {
-	// Source defines the repository to watch for pull requests.
+	// Source defines the repository to watch for pull requests, branches or tags.
 	Source GitRepositorySpec `json:"source"`
 
+	// Mode (optional) defines what a Cdk8sAppProxy is generated for. Defaults to PullRequests.
+	// +optional
+	Mode GeneratorMode `json:"mode,omitempty"`
+
+	// RefPatterns (optional) are glob patterns (e.g. "release/*") matching the branch or tag names
+	// a Cdk8sAppProxy is generated for in Branches or Tags mode. If empty, every branch or tag matches.
+	// +optional
+	RefPatterns []string `json:"refPatterns,omitempty"`
+
 	// Filters defines criteria for matching pull requests.
 	// +optional
 	Filters []PRFilter `json:"filters,omitempty"`
 
-	// Template defines the Cdk8sAppProxy to be generated for each PR.
+	// Template defines the Cdk8sAppProxy to be generated for each PR, branch or tag.
 	Template Cdk8sAppProxyTemplate `json:"template"`
 
 	// Path (optional) is the path within the repository where the cdk8s application is located.
@@ -58,6 +224,104 @@ type Cdk8sAppProxyGeneratorSpec struct {
 	// Defaults to 5 minutes.
 	// +optional
 	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// Trigger (optional) defines how previews are requested. Defaults to a preview for every open PR.
+	// +optional
+	Trigger *PreviewTrigger `json:"trigger,omitempty"`
+
+	// Checkout (optional) defines which revision of a pull request is deployed. The generated
+	// Cdk8sAppProxy is always pinned to the commit seen when polling. Defaults to Head.
+	// +optional
+	Checkout PRCheckoutMode `json:"checkout,omitempty"`
+
+	// Forks (optional) defines how pull requests from forks are handled. Defaults to denying them.
+	// +optional
+	Forks *ForkPolicy `json:"forks,omitempty"`
+
+	// Capacity (optional) limits the number of concurrent previews and removes or scales down idle ones.
+	// +optional
+	Capacity *PreviewCapacity `json:"capacity,omitempty"`
+
+	// Isolation (optional) deploys every generated Cdk8sAppProxy into its own namespace on the target
+	// clusters, named after the Cdk8sAppProxy, and creates the given guard rails in it.
+	// +optional
+	Isolation *NamespaceIsolation `json:"isolation,omitempty"`
+
+	// Cluster (optional) creates a dedicated CAPI Cluster per preview from a ClusterClass. The
+	// generated Cdk8sAppProxy selects only this Cluster, and the Cluster is deleted with the preview.
+	// +optional
+	Cluster *PreviewClusterTemplate `json:"cluster,omitempty"`
+}
+
+// PreviewCommandStatus records the command state of a pull request in OnDemand mode.
+type PreviewCommandStatus struct {
+	// Number is the pull request number.
+	Number int `json:"number"`
+
+	// Requested is true if the latest command requested a preview.
+	Requested bool `json:"requested"`
+
+	// LastCommandID is the provider ID of the last handled command comment.
+	// +optional
+	LastCommandID int64 `json:"lastCommandID,omitempty"`
+}
+
+// PreviewState is the lifecycle state of a preview.
+type PreviewState string
+
+const (
+	// PreviewStateActive means the Cdk8sAppProxy of the preview is deployed.
+	PreviewStateActive PreviewState = "Active"
+	// PreviewStateQueued means the preview waits for a free slot.
+	PreviewStateQueued PreviewState = "Queued"
+	// PreviewStateSleeping means the Cdk8sAppProxy is deployed with its workloads scaled to zero.
+	PreviewStateSleeping PreviewState = "Sleeping"
+	// PreviewStateExpired means the Cdk8sAppProxy was removed as its TTL passed.
+	PreviewStateExpired PreviewState = "Expired"
+)
+
+// PreviewDeployState is the deployment state of the Cdk8sAppProxy of an active preview.
+type PreviewDeployState string
+
+const (
+	// PreviewDeploying means the Cdk8sAppProxy is not ready yet.
+	PreviewDeploying PreviewDeployState = "Deploying"
+	// PreviewDeployed means the Cdk8sAppProxy is ready.
+	PreviewDeployed PreviewDeployState = "Deployed"
+	// PreviewDeployFailed means the Cdk8sAppProxy failed to deploy.
+	PreviewDeployFailed PreviewDeployState = "Failed"
+)
+
+// PreviewStatus records the state of a pull request, branch or tag the generator deploys.
+type PreviewStatus struct {
+	// Name is the name of the generated Cdk8sAppProxy.
+	Name string `json:"name"`
+
+	// Number is the pull request number. It is 0 for branches and tags.
+	// +optional
+	Number int `json:"number,omitempty"`
+
+	// Ref is the name of the PR branch, branch or tag.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// HeadSHA is the last commit seen for the preview.
+	// +optional
+	HeadSHA string `json:"headSHA,omitempty"`
+
+	// LastPushTime is the time HeadSHA was first seen.
+	LastPushTime metav1.Time `json:"lastPushTime"`
+
+	// State is the lifecycle state of the preview.
+	State PreviewState `json:"state"`
+
+	// DeployState is the deployment state of the Cdk8sAppProxy of an Active or Sleeping preview.
+	// +optional
+	DeployState PreviewDeployState `json:"deployState,omitempty"`
+
+	// Message is the message of the Ready condition of the Cdk8sAppProxy.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // Cdk8sAppProxyGeneratorStatus defines the observed state of Cdk8sAppProxyGenerator.
@@ -69,11 +333,22 @@ type Cdk8sAppProxyGeneratorStatus struct {
 	// LastPolledTime is the last time the Git provider was polled for PRs.
 	// +optional
 	LastPolledTime *metav1.Time `json:"lastPolledTime,omitempty"`
+
+	// Commands records the handled preview commands per pull request in OnDemand mode.
+	// +optional
+	Commands []PreviewCommandStatus `json:"commands,omitempty"`
+
+	// Previews records the state of every pull request, branch or tag the generator deploys.
+	// +optional
+	Previews []PreviewStatus `json:"previews,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:shortName=capg
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+//+kubebuilder:printcolumn:name="Message",type="string",priority=1,JSONPath=".status.conditions[?(@.type=='Ready')].message"
 
 // Cdk8sAppProxyGenerator is the Schema for the cdk8sappproxygenerators API.
 type Cdk8sAppProxyGenerator struct {
@@ -84,6 +359,14 @@ type Cdk8sAppProxyGenerator struct {
 	Status Cdk8sAppProxyGeneratorStatus `json:"status,omitempty"`
 }
 
+func (g *Cdk8sAppProxyGenerator) GetConditions() []metav1.Condition {
+	return g.Status.Conditions
+}
+
+func (g *Cdk8sAppProxyGenerator) SetConditions(conditions []metav1.Condition) {
+	g.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // Cdk8sAppProxyGeneratorList contains a list of Cdk8sAppProxyGenerator.
@@ -0,0 +1,220 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var cdk8sappproxygeneratorlog = logf.Log.WithName("cdk8sappproxygenerator-resource")
+
+const (
+	// maxGeneratedNameLength is the maximum length of generated names, as they are used as label
+	// values, namespace and cluster names.
+	maxGeneratedNameLength = 63
+	// maxPRNumberDigits is the number of PR number digits reserved in generated names.
+	maxPRNumberDigits = 6
+	// refHashLength is the length reserved in generated names for the hash the controller appends to
+	// altered branch and tag names, a '-' followed by 8 hex digits.
+	refHashLength = 9
+	// minPollInterval is the smallest allowed poll interval.
+	minPollInterval = time.Second
+	// recommendedPollInterval is the poll interval below which a warning about provider rate limits is returned.
+	recommendedPollInterval = time.Minute
+)
+
+// dryRunVars are the variables the template is rendered with on admission.
+var dryRunVars = TemplateVars{
+	Number:     1,
+	Ref:        "feature/dry-run",
+	Branch:     "feature/dry-run",
+	HeadSHA:    "0000000000000000000000000000000000000000",
+	BaseBranch: "main",
+	Author:     "dry-run",
+	Labels:     []string{"preview"},
+}
+
+func (g *Cdk8sAppProxyGenerator) SetupWebhookWithManager(mgr manager.Manager) error {
+	w := new(cdk8sAppProxyGeneratorWebhook)
+
+	return controllerruntime.NewWebhookManagedBy(mgr, g).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+type cdk8sAppProxyGeneratorWebhook struct{}
+
+var (
+	_ admission.Validator[*Cdk8sAppProxyGenerator] = &cdk8sAppProxyGeneratorWebhook{}
+	_ admission.Defaulter[*Cdk8sAppProxyGenerator] = &cdk8sAppProxyGeneratorWebhook{}
+)
+
+// +kubebuilder:webhook:path=/mutate-addons-cluster-x-k8s-io-v1alpha1-cdk8sappproxygenerator,mutating=true,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=cdk8sappproxygenerators,verbs=create;update,versions=v1alpha1,name=mcdk8sappproxygenerator.kb.io,admissionReviewVersions=v1
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type.
+func (*cdk8sAppProxyGeneratorWebhook) Default(_ context.Context, obj *Cdk8sAppProxyGenerator) error {
+	cdk8sappproxygeneratorlog.Info("default", "name", obj.Name)
+
+	// Defining the PollInterval is optional, so we set a default value.
+	if obj.Spec.PollInterval == nil {
+		obj.Spec.PollInterval = &metav1.Duration{Duration: DefaultGeneratorPollInterval}
+	}
+
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha1-cdk8sappproxygenerator,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=cdk8sappproxygenerators,verbs=create;update,versions=v1alpha1,name=vcdk8sappproxygenerator.kb.io,admissionReviewVersions=v1
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (*cdk8sAppProxyGeneratorWebhook) ValidateCreate(_ context.Context, obj *Cdk8sAppProxyGenerator) (admission.Warnings, error) {
+	cdk8sappproxygeneratorlog.Info("validate create", "name", obj.Name)
+
+	return obj.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+func (*cdk8sAppProxyGeneratorWebhook) ValidateUpdate(_ context.Context, _, newObj *Cdk8sAppProxyGenerator) (admission.Warnings, error) {
+	cdk8sappproxygeneratorlog.Info("validate update", "name", newObj.Name)
+
+	return newObj.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (*cdk8sAppProxyGeneratorWebhook) ValidateDelete(_ context.Context, obj *Cdk8sAppProxyGenerator) (admission.Warnings, error) {
+	cdk8sappproxygeneratorlog.Info("validate delete", "name", obj.Name)
+
+	return nil, nil
+}
+
+func (g *Cdk8sAppProxyGenerator) validate() (warnings admission.Warnings, err error) {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	// Generated names start with the generator name, followed by the PR number or the ref. Refs are
+	// truncated, so room is left for their hash.
+	reserved := len("-pr-") + maxPRNumberDigits
+	switch g.Spec.Mode {
+	case GeneratorModeBranches:
+		reserved = len("-branch-") + refHashLength
+	case GeneratorModeTags:
+		reserved = len("-tag-") + refHashLength
+	}
+	if maxLength := maxGeneratedNameLength - reserved; len(g.Name) > maxLength {
+		allErrs = append(allErrs, field.TooLong(field.NewPath("metadata", "name"), g.Name, maxLength))
+	}
+
+	if g.Spec.PollInterval != nil {
+		pollIntervalPath := specPath.Child("pollInterval")
+		switch {
+		case g.Spec.PollInterval.Duration < minPollInterval:
+			allErrs = append(allErrs, field.Invalid(pollIntervalPath, g.Spec.PollInterval.Duration.String(), "must be at least 1s"))
+		case g.Spec.PollInterval.Duration < recommendedPollInterval:
+			warnings = append(warnings, "spec.pollInterval below 1m may exceed the API rate limits of the Git provider")
+		}
+	}
+
+	for i, filter := range g.Spec.Filters {
+		if _, err := filter.BranchRegexp(); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("filters").Index(i).Child("branchMatch"), filter.BranchMatch, err.Error()))
+		}
+	}
+
+	for i, pattern := range g.Spec.RefPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("refPatterns").Index(i), pattern, err.Error()))
+		}
+	}
+
+	allErrs = append(allErrs, g.validateTemplate(specPath.Child("template"))...)
+
+	if len(allErrs) > 0 {
+		return warnings, apierrors.NewInvalid(GroupVersion.WithKind("Cdk8sAppProxyGenerator").GroupKind(), g.Name, allErrs)
+	}
+
+	return warnings, nil
+}
+
+// validateTemplate rejects sources and GitRepository fields the generator sets from the source, parses
+// the template expressions and renders the template with sample variables.
+func (g *Cdk8sAppProxyGenerator) validateTemplate(templatePath *field.Path) (allErrs field.ErrorList) {
+	// Previews are built from the source repository, which replaces any other source of the template.
+	if g.Spec.Template.Spec.OCIRepository != nil {
+		allErrs = append(allErrs, field.Forbidden(templatePath.Child("spec", "ociRepository"), "previews are built from spec.source"))
+	}
+	if len(g.Spec.Template.Spec.Sources) > 0 {
+		allErrs = append(allErrs, field.Forbidden(templatePath.Child("spec", "sources"), "previews are built from spec.source"))
+	}
+	if gitRepository := g.Spec.Template.Spec.GitRepository; gitRepository != nil {
+		gitRepositoryPath := templatePath.Child("spec", "gitRepository")
+		generated := map[string]string{
+			"url":       gitRepository.URL,
+			"reference": gitRepository.Reference,
+			"commit":    gitRepository.Commit,
+			"secretRef": gitRepository.SecretRef,
+			"secretKey": gitRepository.SecretKey,
+		}
+		fieldNames := make([]string, 0, len(generated))
+		for fieldName := range generated {
+			fieldNames = append(fieldNames, fieldName)
+		}
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			if generated[fieldName] != "" {
+				allErrs = append(allErrs, field.Forbidden(gitRepositoryPath.Child(fieldName), "is set by the generator from spec.source"))
+			}
+		}
+	}
+
+	parseErrs := g.Spec.Template.ParseExpressions()
+	fieldPaths := make([]string, 0, len(parseErrs))
+	for fieldPath := range parseErrs {
+		fieldPaths = append(fieldPaths, fieldPath)
+	}
+	sort.Strings(fieldPaths)
+	for _, fieldPath := range fieldPaths {
+		allErrs = append(allErrs, field.Invalid(templatePath.Child(fieldPath), fieldPath, parseErrs[fieldPath].Error()))
+	}
+	if len(parseErrs) > 0 {
+		return allErrs
+	}
+
+	// Dry-run render the template to catch unknown variables and invalid rendered values.
+	rendered, err := g.Spec.Template.Render(dryRunVars)
+	if err != nil {
+		return append(allErrs, field.Invalid(templatePath, "", "failed to render template: "+err.Error()))
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabels(rendered.Metadata.Labels, templatePath.Child("metadata", "labels"))...)
+	if g.Spec.Cluster == nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(&rendered.Spec.ClusterSelector,
+			metav1validation.LabelSelectorValidationOptions{}, templatePath.Child("spec", "clusterSelector"))...)
+	}
+
+	return allErrs
+}
@@ -0,0 +1,159 @@
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestGenerator() *Cdk8sAppProxyGenerator {
+	return &Cdk8sAppProxyGenerator{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: Cdk8sAppProxyGeneratorSpec{
+			Source: GitRepositorySpec{URL: "https://github.com/owner/repo"},
+			Template: Cdk8sAppProxyTemplate{
+				Metadata: metav1.ObjectMeta{Labels: map[string]string{"preview": "pr-{{ .Number }}"}},
+				Spec: Cdk8sAppProxySpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"env": "preview"}},
+				},
+			},
+		},
+	}
+}
+
+func TestGeneratorDefault(t *testing.T) {
+	generator := newTestGenerator()
+
+	if err := (&cdk8sAppProxyGeneratorWebhook{}).Default(context.Background(), generator); err != nil {
+		t.Fatalf("Default returned error: %v", err)
+	}
+	if generator.Spec.PollInterval == nil || generator.Spec.PollInterval.Duration != DefaultGeneratorPollInterval {
+		t.Errorf("expected poll interval %s, got %v", DefaultGeneratorPollInterval, generator.Spec.PollInterval)
+	}
+}
+
+func TestGeneratorValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutate    func(g *Cdk8sAppProxyGenerator)
+		wantErr   string
+		wantWarns bool
+	}{
+		{
+			name:   "valid",
+			mutate: func(_ *Cdk8sAppProxyGenerator) {},
+		},
+		{
+			name: "invalid branch regex",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Filters = []PRFilter{{BranchMatch: "release/("}}
+			},
+			wantErr: "spec.filters[0].branchMatch",
+		},
+		{
+			name: "sub-second poll interval",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.PollInterval = &metav1.Duration{Duration: 500 * time.Millisecond}
+			},
+			wantErr: "spec.pollInterval",
+		},
+		{
+			name: "short poll interval warns",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.PollInterval = &metav1.Duration{Duration: 10 * time.Second}
+			},
+			wantWarns: true,
+		},
+		{
+			name: "name too long for generated names",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Name = strings.Repeat("a", 54)
+			},
+			wantErr: "metadata.name",
+		},
+		{
+			name: "long name in branch mode",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Name = strings.Repeat("a", 46)
+				g.Spec.Mode = GeneratorModeBranches
+			},
+		},
+		{
+			name: "name too long in tag mode",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Name = strings.Repeat("a", 50)
+				g.Spec.Mode = GeneratorModeTags
+			},
+			wantErr: "metadata.name",
+		},
+		{
+			name: "invalid ref pattern",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.RefPatterns = []string{"release/["}
+			},
+			wantErr: "spec.refPatterns[0]",
+		},
+		{
+			name: "git repository set in template",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Spec.GitRepository = &GitRepositorySpec{URL: "https://github.com/other/repo", Path: "app"}
+			},
+			wantErr: "spec.template.spec.gitRepository.url",
+		},
+		{
+			name: "oci repository set in template",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Spec.OCIRepository = &OCIRepositorySpec{URL: "oci://registry.example.com/app", Tag: "v1"}
+			},
+			wantErr: "spec.template.spec.ociRepository",
+		},
+		{
+			name: "sources set in template",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Spec.Sources = []SourceSpec{{Name: "platform", GitRepository: &GitRepositorySpec{URL: "https://github.com/owner/platform"}}}
+			},
+			wantErr: "spec.template.spec.sources",
+		},
+		{
+			name: "unknown template variable",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Metadata.Labels["preview"] = "{{ .Unknown }}"
+			},
+			wantErr: "failed to render template",
+		},
+		{
+			name: "rendered label value invalid",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Metadata.Labels["preview"] = "{{ .Branch }}"
+			},
+			wantErr: "spec.template.metadata.labels",
+		},
+		{
+			name: "rendered label value sanitized",
+			mutate: func(g *Cdk8sAppProxyGenerator) {
+				g.Spec.Template.Metadata.Labels["preview"] = "{{ .Branch | dnsLabel }}"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := newTestGenerator()
+			tt.mutate(generator)
+
+			warnings, err := generator.validate()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if tt.wantWarns != (len(warnings) > 0) {
+				t.Errorf("expected warnings %v, got %v", tt.wantWarns, warnings)
+			}
+		})
+	}
+}
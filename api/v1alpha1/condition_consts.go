@@ -32,4 +32,32 @@ const (
 	GitCloneCondition = "GitCloningProgressing"
 	// GitCloneFailedReason indicates that the cloning of the git repository failed.
 	GitCloneFailedReason = "GitCloneFailed"
+	// WaitingForControlPlaneReason indicates that the control plane of a selected cluster is not available yet.
+	WaitingForControlPlaneReason = "WaitingForControlPlane"
+	// ValuesNotFoundReason indicates that the values referenced by valuesFrom could not be read.
+	ValuesNotFoundReason = "ValuesNotFound"
+	// RegistryCredentialsNotFoundReason indicates that the credentials of a package registry could not be read.
+	RegistryCredentialsNotFoundReason = "RegistryCredentialsNotFound"
+	// ArtifactPullFailedReason indicates that the OCI artifact of the app could not be pulled or verified.
+	ArtifactPullFailedReason = "ArtifactPullFailed"
+	// VendoredDependenciesMissingReason indicates that an offline synthesis found no vendored dependencies.
+	VendoredDependenciesMissingReason = "VendoredDependenciesMissing"
+	// ConflictingResourcesReason indicates that two apps of the Cdk8sAppProxy rendered the same resource differently.
+	ConflictingResourcesReason = "ConflictingResources"
+)
+
+// Cdk8sAppProxyGenerator Conditions and Reasons.
+const (
+	// ProviderReachableCondition indicates whether the Git provider of the generator source can be reached.
+	ProviderReachableCondition = "ProviderReachable"
+	// ProviderUnreachableReason indicates that the repository or the provider API could not be reached.
+	ProviderUnreachableReason = "ProviderUnreachable"
+	// AuthenticatedCondition indicates whether the generator is allowed to access the source repository.
+	AuthenticatedCondition = "Authenticated"
+	// SecretNotFoundReason indicates that the credentials secret or its key does not exist.
+	SecretNotFoundReason = "SecretNotFound"
+	// AccessDeniedReason indicates that the repository rejected the credentials.
+	AccessDeniedReason = "AccessDenied"
+	// ReconcileFailedReason indicates that the generated resources could not be reconciled.
+	ReconcileFailedReason = "ReconcileFailed"
 )
@@ -107,6 +107,9 @@ var _ = BeforeSuite(func() {
 	err = (&Cdk8sAppProxy{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = (&Cdk8sAppProxyGenerator{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:webhook
 
 	go func() {
@@ -19,15 +19,20 @@ package controllers
 import (
 	"context"
 	"os"
+	"strings"
+	"time"
 
 	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
 	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
 	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/resourcer"
 	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/synthesizer"
 	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/utils"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/events"
@@ -36,13 +41,39 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 )
 
+const (
+	// synthOutputTailLines is the number of output lines of a failed synthesis reported on the Cdk8sAppProxy.
+	synthOutputTailLines = 20
+	// maxConditionMessage is the maximum length of a condition message.
+	maxConditionMessage = 32768
+	// maxEventNote is the maximum length of the note of an event.
+	maxEventNote = 1024
+)
+
 type Reconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder events.EventRecorder
+
+	// SynthJobs synthesizes apps in Kubernetes Jobs if set, and in the controller process otherwise.
+	SynthJobs *synthesizer.JobConfig
+
+	// SynthLimits bound the resources of in-process syntheses.
+	SynthLimits synthesizer.Limits
+
+	// SynthCache is the dependency cache of in-process syntheses, nil if dependencies are not cached.
+	SynthCache *synthesizer.Cache
+
+	// SynthOffline denies syntheses network access, leaving them with vendored dependencies.
+	SynthOffline bool
+
+	// SynthOfflineEnvOnly lets offline in-process syntheses run without network namespaces, kept
+	// offline by their environment only.
+	SynthOfflineEnvOnly bool
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -54,6 +85,14 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager, options controller.Optio
 			&clusterv1.Cluster{},
 			handler.EnqueueRequestsFromMapFunc(r.ClusterToCdk8sAppProxyMapper),
 		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.ValuesToCdk8sAppProxyMapper),
+		).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.ValuesToCdk8sAppProxyMapper),
+		).
 		Complete(r)
 }
 
@@ -63,12 +102,17 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager, options controller.Optio
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters/status,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=create
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;create;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;create;update;delete
 
 func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (controller ctrl.Result, err error) {
 	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxy", req.NamespacedName)
 	logs.Info("Reconciling CDk8sAppProxy")
 
-	synthImpl := &synthesizer.Implementer{}
 	resourcerImpl := &resourcer.Implementer{
 		Client: r.Client,
 	}
@@ -76,36 +120,298 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (controlle
 
 	if err = r.Get(ctx, req.NamespacedName, cdk8sAppProxy); err != nil {
 		if apierrors.IsNotFound(err) {
-			logs.Error(err, "cdk8sAppProxy resource not found")
+			logs.Info("cdk8sAppProxy resource not found")
 
-			return ctrl.Result{}, err
+			return ctrl.Result{}, nil
 		}
 		logs.Error(err, "Failed to get cdk8sAppProxy")
 
 		return ctrl.Result{}, err
 	}
 
-	repoURL := cdk8sAppProxy.Spec.GitRepository.URL
-	branch := cdk8sAppProxy.Spec.GitRepository.Reference
-	directory := "/tmp/cdk8s-" + cdk8sAppProxy.Namespace + "-" + cdk8sAppProxy.Name + "-" + branch
+	if !cdk8sAppProxy.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.reconcileDelete(ctx, cdk8sAppProxy, resourcerImpl)
+	}
+
+	// The update with the finalizer triggers the next reconciliation.
+	if controllerutil.AddFinalizer(cdk8sAppProxy, addonsv1alpha1.Cdk8sAppProxyFinalizer) {
+		if err = r.Update(ctx, cdk8sAppProxy); err != nil {
+			logs.Error(err, "failed to add finalizer")
+		}
 
-	defer func(path string) {
-		err = os.RemoveAll(path)
+		return ctrl.Result{}, err
+	}
+
+	clusters, err := resourcerImpl.Clusters(ctx, cdk8sAppProxy, logs)
+	if err != nil {
+		logs.Error(err, "failed to list clusters")
+
+		return ctrl.Result{}, err
+	}
+
+	// Clusters whose control plane is not available yet, e.g. freshly created preview clusters, are
+	// skipped and deployed to once it is up.
+	clusters, pendingClusters := resourcer.PendingControlPlanes(clusters)
+	if len(pendingClusters) > 0 {
+		logs.Info("Waiting for control planes to become available", "clusters", pendingClusters)
+	}
+	if len(clusters) == 0 && len(pendingClusters) > 0 {
+		return r.waitForControlPlanes(ctx, cdk8sAppProxy, pendingClusters)
+	}
+
+	sources, fetched, err := r.fetchSources(ctx, cdk8sAppProxy, logs)
+	defer func() {
+		for _, src := range sources {
+			if removeErr := os.RemoveAll(src.directory); removeErr != nil {
+				logs.Error(removeErr, "Failed to clean-up directory", "path", src.directory)
+			}
+		}
+	}()
+	if !fetched {
+		return ctrl.Result{}, err
+	}
+
+	values, err := utils.FetchValues(ctx, r.Client, cdk8sAppProxy, logs)
+	if err != nil {
+		logs.Error(err, "failed to fetch values")
+		conditions.Set(cdk8sAppProxy, metav1.Condition{
+			Type:    clusterv1.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  addonsv1alpha1.ValuesNotFoundReason,
+			Message: err.Error(),
+		})
+		if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+			logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	cdk8sAppProxy.Status.ValuesHash, err = utils.ValuesHash(values)
+	if err != nil {
+		logs.Error(err, "failed to hash values")
+
+		return ctrl.Result{}, err
+	}
+
+	for idx := range sources {
+		sources[idx].registries, err = utils.FetchRegistries(ctx, r.Client, sources[idx].Cdk8sAppProxy, logs)
+		if err != nil {
+			logs.Error(err, "failed to fetch registry credentials", "source", sources[idx].Name)
+			conditions.Set(cdk8sAppProxy, metav1.Condition{
+				Type:    clusterv1.ReadyCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  addonsv1alpha1.RegistryCredentialsNotFoundReason,
+				Message: sourceMessage(sources[idx].Name, err.Error()),
+			})
+			if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+				logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+			}
+
+			return ctrl.Result{}, err
+		}
+	}
+
+	missingResource := false
+	var inventory []addonsv1alpha1.InventoryEntry
+	if cdk8sAppProxy.Spec.Synth != nil && cdk8sAppProxy.Spec.Synth.PerCluster {
+		for idx := range clusters {
+			applied, missing, err := r.synthesizeAndApply(ctx, cdk8sAppProxy, sources, values, &clusters[idx], resourcerImpl, clusters[idx:idx+1])
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			inventory = resourcer.AddToInventory(inventory, applied)
+			missingResource = missingResource || missing
+		}
+	} else {
+		applied, missing, err := r.synthesizeAndApply(ctx, cdk8sAppProxy, sources, values, nil, resourcerImpl, clusters)
 		if err != nil {
-			logs.Error(err, "Failed to clean-up directory", "path", path)
+			return ctrl.Result{}, err
 		}
-	}(directory)
+		inventory = resourcer.AddToInventory(inventory, applied)
+		missingResource = missing
+	}
+	cdk8sAppProxy.Status.Inventory = inventory
+
+	if len(pendingClusters) > 0 {
+		return r.waitForControlPlanes(ctx, cdk8sAppProxy, pendingClusters)
+	}
+
+	if !missingResource {
+		conditions.Set(cdk8sAppProxy, metav1.Condition{
+			Type:    clusterv1.ReadyCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Successful",
+			Message: "Cdk8sAppProxy is ready",
+		})
+	}
+
+	if err = r.Status().Update(ctx, cdk8sAppProxy); err != nil {
+		logs.Error(err, "failed to update cdk8sAppProxy status")
+
+		return ctrl.Result{}, err
+	}
+
+	logs.Info("Reconciliation finished successfully")
+
+	return ctrl.Result{}, err
+}
+
+// reconcileDelete deletes the applied resources and the target namespace of a deleted Cdk8sAppProxy
+// from the selected clusters, then removes its finalizer.
+func (r *Reconciler) reconcileDelete(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, resourcerImpl *resourcer.Implementer) (err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxy", client.ObjectKeyFromObject(cdk8sAppProxy))
+
+	if !controllerutil.ContainsFinalizer(cdk8sAppProxy, addonsv1alpha1.Cdk8sAppProxyFinalizer) {
+		return nil
+	}
+
+	if err = resourcerImpl.Delete(ctx, cdk8sAppProxy, logs); err != nil {
+		logs.Error(err, "failed to delete resources from the clusters")
+		r.Recorder.Eventf(cdk8sAppProxy, nil, corev1.EventTypeWarning, "DeleteFailed", "Delete", "%s", truncateMessage(err.Error(), maxEventNote))
+
+		return err
+	}
+
+	controllerutil.RemoveFinalizer(cdk8sAppProxy, addonsv1alpha1.Cdk8sAppProxyFinalizer)
+	if err = r.Update(ctx, cdk8sAppProxy); err != nil {
+		logs.Error(err, "failed to remove finalizer")
+
+		return err
+	}
+	logs.Info("Deleted resources from the clusters")
+
+	return nil
+}
+
+// waitForControlPlanes reports the clusters whose control plane is not available yet on the
+// Cdk8sAppProxy and requeues it.
+func (r *Reconciler) waitForControlPlanes(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, pendingClusters []string) (ctrl.Result, error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxy", client.ObjectKeyFromObject(cdk8sAppProxy))
+
+	conditions.Set(cdk8sAppProxy, metav1.Condition{
+		Type:    clusterv1.ReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  addonsv1alpha1.WaitingForControlPlaneReason,
+		Message: "Waiting for the control plane of clusters " + strings.Join(pendingClusters, ", "),
+	})
+	if err := r.Status().Update(ctx, cdk8sAppProxy); err != nil {
+		logs.Error(err, "failed to update cdk8sAppProxy status")
+
+		return ctrl.Result{}, err
+	}
+
+	// Cluster updates requeue the Cdk8sAppProxy, the requeue is a safety net.
+	return ctrl.Result{RequeueAfter: time.Minute}, nil
+}
+
+// source is an app of the Cdk8sAppProxy with its checkout and package registries.
+type source struct {
+	utils.SourceApp
+
+	// directory is the checkout of the repository or the extracted OCI artifact of the app.
+	directory string
+
+	// registries are the package registries of the app with their credentials.
+	registries []synthesizer.Registry
+}
+
+// fetchSources clones the Git repositories and pulls the OCI artifacts of the apps of the
+// Cdk8sAppProxy. Apps of the same repository, reference and commit share a clone. It reports whether
+// all apps were fetched and returns the apps fetched so far, whose directories the caller removes.
+func (r *Reconciler) fetchSources(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logs logr.Logger) (sources []source, fetched bool, err error) {
+	syncSourceStatuses(cdk8sAppProxy)
+
+	clones := map[addonsv1alpha1.GitRepositorySpec]string{}
+	for _, app := range utils.SourceApps(cdk8sAppProxy) {
+		prefix := "cdk8s-" + cdk8sAppProxy.Namespace + "-" + cdk8sAppProxy.Name + "-"
+		if app.Name != "" {
+			prefix += app.Name + "-"
+		}
+		spec := app.Cdk8sAppProxy.Spec
+
+		if spec.OCIRepository != nil {
+			directory, err := os.MkdirTemp("", tempDirPrefix(prefix+"oci"))
+			if err != nil {
+				logs.Error(err, "failed to create directory for the OCI artifact")
+
+				return sources, false, err
+			}
+			sources = append(sources, source{SourceApp: app, directory: directory})
+			digest, err := r.pullArtifact(ctx, cdk8sAppProxy, app.Name, spec.OCIRepository, directory, logs)
+			if err != nil {
+				return sources, false, err
+			}
+			if app.Name == "" {
+				cdk8sAppProxy.Status.ArtifactDigest = digest
+			} else {
+				sourceStatus(cdk8sAppProxy, app.Name).ArtifactDigest = digest
+			}
+
+			continue
+		}
+
+		// The apps of a repository differ in their path only.
+		key := *spec.GitRepository
+		key.Path = ""
+		if clone, ok := clones[key]; ok {
+			sources = append(sources, source{SourceApp: app, directory: clone})
+
+			continue
+		}
+
+		directory, err := os.MkdirTemp("", tempDirPrefix(prefix+spec.GitRepository.Reference))
+		if err != nil {
+			logs.Error(err, "failed to create directory for the clone")
+
+			return sources, false, err
+		}
+		sources = append(sources, source{SourceApp: app, directory: directory})
+		cloned, err := r.cloneRepository(ctx, cdk8sAppProxy, spec.GitRepository, directory, logs)
+		if !cloned {
+			return sources, false, err
+		}
+		clones[key] = directory
+	}
+
+	return sources, true, nil
+}
+
+// tempDirPrefix returns prefix usable as the name prefix of a temporary directory. References such as
+// refs/pull/42/merge are flattened, so they do not create nested directories.
+func tempDirPrefix(prefix string) string {
+	const maxLength = 100
+
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '.' || r == '_' {
+			return r
+		}
+
+		return '-'
+	}, prefix)
+	if len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+	}
+
+	return sanitized + "-"
+}
+
+// cloneRepository clones the Git repository of an app of the Cdk8sAppProxy into directory. It reports
+// whether the repository was cloned.
+func (r *Reconciler) cloneRepository(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, repo *addonsv1alpha1.GitRepositorySpec, directory string, logs logr.Logger) (cloned bool, err error) {
+	repoURL := repo.URL
+	branch := repo.Reference
 
 	// Fetch secret for Git authentication if provided.
-	secretRef, err := utils.FetchSecret(ctx, r.Client, cdk8sAppProxy.Namespace, cdk8sAppProxy.Spec.GitRepository, logs)
+	secretRef, err := utils.FetchSecret(ctx, r.Client, cdk8sAppProxy.Namespace, repo, logs)
 	if err != nil {
-		return ctrl.Result{}, err
+		return false, err
 	}
 
 	// Fetch the optional known_hosts entry used to verify the SSH host key of self-hosted servers.
-	knownHosts, err := utils.FetchKnownHosts(ctx, r.Client, cdk8sAppProxy.Namespace, cdk8sAppProxy.Spec.GitRepository, logs)
+	knownHosts, err := utils.FetchKnownHosts(ctx, r.Client, cdk8sAppProxy.Namespace, repo, logs)
 	if err != nil {
-		return ctrl.Result{}, err
+		return false, err
 	}
 
 	// Check access before Cloning
@@ -114,26 +420,26 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (controlle
 	if err != nil {
 		logs.Error(err, "Failed to check repository access")
 
-		return ctrl.Result{}, err
+		return false, err
 	}
 
 	if requiredAuth && len(secretRef) == 0 {
 		logs.Error(err, "Repository requires authentication but no secretRef was provided.")
 
-		return ctrl.Result{}, err
+		return false, err
 	}
 
 	if !accessible {
 		logs.Error(err, "repository is not accessible. Access Denied")
 
-		return ctrl.Result{}, err
+		return false, err
 	}
 
 	if !requiredAuth {
 		secretRef = nil
 	}
 
-	err = gitImpl.Clone(repoURL, secretRef, branch, directory, logs)
+	err = gitImpl.Clone(repoURL, secretRef, branch, repo.Commit, directory, logs)
 	if err != nil {
 		conditions.Set(cdk8sAppProxy, metav1.Condition{
 			Type:    clusterv1.AvailableCondition,
@@ -142,62 +448,250 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (controlle
 			Message: "Failed to clone Git Repository",
 		})
 
-		return ctrl.Result{}, err
+		return false, err
 	}
 
-	logs.Info("Starting to synthesize resources", "directory", directory)
-	parsedResources, err := synthImpl.Synthesize(directory, cdk8sAppProxy, logs, ctx)
+	return true, nil
+}
+
+// pullArtifact pulls the OCI artifact of an app of the Cdk8sAppProxy into directory and returns its digest.
+func (r *Reconciler) pullArtifact(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, sourceName string, spec *addonsv1alpha1.OCIRepositorySpec, directory string, logs logr.Logger) (digest string, err error) {
+	puller, err := utils.FetchOCIPuller(ctx, r.Client, cdk8sAppProxy.Namespace, spec, logs)
+	if err == nil {
+		digest, err = puller.Pull(ctx, spec.URL, spec.Tag, spec.Digest, directory, logs)
+	}
 	if err != nil {
-		logs.Error(err, "failed to synthesize resources")
+		logs.Error(err, "failed to pull OCI artifact", "url", spec.URL)
 		conditions.Set(cdk8sAppProxy, metav1.Condition{
-			Type:    clusterv1.AvailableCondition,
+			Type:    clusterv1.ReadyCondition,
 			Status:  metav1.ConditionFalse,
-			Reason:  metav1.StatusFailure,
-			Message: "Failed to synth cdk8s code",
+			Reason:  addonsv1alpha1.ArtifactPullFailedReason,
+			Message: sourceMessage(sourceName, err.Error()),
 		})
+		if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+			logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+		}
 
-		return ctrl.Result{}, err
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// syncSourceStatuses keeps the statuses of the apps of spec.sources in the order of the sources.
+func syncSourceStatuses(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy) {
+	statuses := make([]addonsv1alpha1.SourceStatus, 0, len(cdk8sAppProxy.Spec.Sources))
+	for _, spec := range cdk8sAppProxy.Spec.Sources {
+		status := addonsv1alpha1.SourceStatus{Name: spec.Name}
+		if previous := sourceStatus(cdk8sAppProxy, spec.Name); previous != nil {
+			status = *previous
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) == 0 {
+		statuses = nil
+	}
+	cdk8sAppProxy.Status.Sources = statuses
+}
+
+// sourceStatus returns the status of the app of spec.sources with the given name, nil if there is none.
+func sourceStatus(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, name string) *addonsv1alpha1.SourceStatus {
+	for idx := range cdk8sAppProxy.Status.Sources {
+		if cdk8sAppProxy.Status.Sources[idx].Name == name {
+			return &cdk8sAppProxy.Status.Sources[idx]
+		}
+	}
+
+	return nil
+}
+
+// sourceMessage prefixes the message with the name of the source it concerns, if any.
+func sourceMessage(sourceName, message string) string {
+	if sourceName == "" {
+		return message
+	}
+
+	return "source " + sourceName + ": " + message
+}
+
+// newSynthesizer returns the synthesizer of the configured backend handing the input values, the
+// package registries and, in per-cluster synthesis, the cluster to the app. Prebuilt apps are
+// rendered in-process.
+func (r *Reconciler) newSynthesizer(values map[string]any, registries []synthesizer.Registry, cluster *clusterv1.Cluster, prebuilt bool) (synthImpl synthesizer.Synthesizer, err error) {
+	impl := &synthesizer.Implementer{Limits: r.SynthLimits, Registries: registries, Offline: r.SynthOffline, OfflineEnvOnly: r.SynthOfflineEnvOnly}
+	if err = impl.WithValues(values); err != nil {
+		return nil, errors.Wrap(err, "failed to encode values")
+	}
+	if cluster != nil {
+		if err = impl.WithCluster(synthesizer.NewClusterInfo(cluster)); err != nil {
+			return nil, errors.Wrap(err, "failed to encode cluster information")
+		}
+	}
+
+	// Pre-synthesized manifests of OCI artifacts are rendered in-process without running code.
+	if r.SynthJobs != nil && !prebuilt {
+		return &synthesizer.JobSynthesizer{Implementer: *impl, JobConfig: *r.SynthJobs}, nil
+	}
+	// The dependency cache is a directory of the controller, it is not mounted into synth Jobs.
+	impl.Cache = r.SynthCache
+
+	return impl, nil
+}
+
+// synthesizeAndApply synthesizes the apps, in per-cluster synthesis for the given cluster, and applies
+// their combined resources to the given clusters once all apps synthesized, each cluster receiving the
+// charts targeted at it. It returns the applied resources and reports whether resources are still
+// missing on any of the clusters.
+func (r *Reconciler) synthesizeAndApply(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, sources []source, values map[string]any, cluster *clusterv1.Cluster, resourcerImpl *resourcer.Implementer, clusters []clusterv1.Cluster) (applied []*unstructured.Unstructured, missingResource bool, err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxy", client.ObjectKeyFromObject(cdk8sAppProxy))
+
+	rendered := make([]resourcer.SourceResources, 0, len(sources))
+	for _, src := range sources {
+		synthImpl, err := r.newSynthesizer(values, src.registries, cluster, src.Cdk8sAppProxy.Spec.OCIRepository != nil)
+		if err != nil {
+			logs.Error(err, "failed to set up synthesizer", "source", src.Name)
+
+			return nil, missingResource, err
+		}
+
+		parsedResources, err := r.synthesize(ctx, cdk8sAppProxy, src, synthImpl)
+		if err != nil {
+			return nil, missingResource, err
+		}
+		rendered = append(rendered, resourcer.SourceResources{Name: src.Name, Resources: parsedResources})
+		if status := sourceStatus(cdk8sAppProxy, src.Name); status != nil {
+			status.Resources = int32(len(parsedResources))
+		}
 	}
-	logs.Info("Synthesized resources", "count", len(parsedResources))
 
-	err = resourcerImpl.Apply(ctx, cdk8sAppProxy, parsedResources, logs)
+	parsedResources, err := resourcer.CombineSources(rendered)
 	if err != nil {
-		logs.Error(err, "failed to apply resources")
+		logs.Error(err, "failed to combine the resources of the sources")
 		conditions.Set(cdk8sAppProxy, metav1.Condition{
 			Type:    clusterv1.ReadyCondition,
 			Status:  metav1.ConditionFalse,
-			Reason:  metav1.StatusFailure,
-			Message: "Failed to apply resources",
+			Reason:  addonsv1alpha1.ConflictingResourcesReason,
+			Message: err.Error(),
 		})
+		r.Recorder.Eventf(cdk8sAppProxy, nil, corev1.EventTypeWarning, addonsv1alpha1.ConflictingResourcesReason, "Synthesize", "%s", truncateMessage(err.Error(), maxEventNote))
+		if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+			logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+		}
 
-		return ctrl.Result{}, err
+		return nil, missingResource, err
 	}
 
-	missingResource, err := resourcerImpl.Check(ctx, cdk8sAppProxy, parsedResources, logs)
-	if err != nil {
-		logs.Error(err, "failed to check for resource existence")
+	// The overlay applies once to the resources of all sources.
+	if cdk8sAppProxy.Spec.Kustomize != nil {
+		parsedResources, err = synthesizer.ApplyOverlay(parsedResources, cdk8sAppProxy.Spec.Kustomize, logs)
+		if err != nil {
+			logs.Error(err, "failed to apply the kustomize overlay")
+			message := "kustomize overlay: " + err.Error()
+			conditions.Set(cdk8sAppProxy, metav1.Condition{
+				Type:    clusterv1.ReadyCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  addonsv1alpha1.SynthFailedReason,
+				Message: truncateMessage(message, maxConditionMessage),
+			})
+			r.Recorder.Eventf(cdk8sAppProxy, nil, corev1.EventTypeWarning, addonsv1alpha1.SynthFailedReason, "Synthesize", "%s", truncateMessage(message, maxEventNote))
+			if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+				logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+			}
 
-		return ctrl.Result{}, err
+			return nil, missingResource, err
+		}
 	}
 
-	if !missingResource {
+	for idx := range clusters {
+		isolated := parsedResources
+		if cdk8sAppProxy.Spec.TargetNamespace != nil {
+			mapper, err := resourcerImpl.RESTMapper(ctx, &clusters[idx])
+			if err != nil {
+				logs.Error(err, "failed to get the REST mapper of the cluster", "cluster", clusters[idx].Name)
+
+				return nil, missingResource, err
+			}
+			isolated, err = resourcer.IsolateNamespace(cdk8sAppProxy, parsedResources, mapper)
+			if err != nil {
+				logs.Error(err, "failed to move resources into the target namespace", "cluster", clusters[idx].Name)
+
+				return nil, missingResource, err
+			}
+		}
+
+		targeted, err := resourcer.TargetCharts(cdk8sAppProxy, &clusters[idx], isolated)
+		if err != nil {
+			logs.Error(err, "failed to select the charts of the cluster", "cluster", clusters[idx].Name)
+
+			return nil, missingResource, err
+		}
+
+		err = resourcerImpl.ApplyToCluster(ctx, cdk8sAppProxy, &clusters[idx], targeted, logs)
+		if err != nil {
+			logs.Error(err, "failed to apply resources")
+			conditions.Set(cdk8sAppProxy, metav1.Condition{
+				Type:    clusterv1.ReadyCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  metav1.StatusFailure,
+				Message: "Failed to apply resources",
+			})
+
+			return nil, missingResource, err
+		}
+
+		missing, err := resourcerImpl.CheckCluster(ctx, &clusters[idx], targeted, logs)
+		if err != nil {
+			logs.Error(err, "failed to check for resource existence")
+
+			return nil, missingResource, err
+		}
+		missingResource = missingResource || missing
+		applied = append(applied, targeted...)
+	}
+
+	return applied, missingResource, nil
+}
+
+// synthesize synthesizes an app of the Cdk8sAppProxy and reports failures on the Cdk8sAppProxy.
+func (r *Reconciler) synthesize(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, src source, synthImpl synthesizer.Synthesizer) (parsedResources []*unstructured.Unstructured, err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxy", client.ObjectKeyFromObject(cdk8sAppProxy), "source", src.Name)
+
+	logs.Info("Starting to synthesize resources", "directory", src.directory)
+	parsedResources, err = synthImpl.Synthesize(src.directory, src.Cdk8sAppProxy, logs, ctx)
+	if err != nil {
+		logs.Error(err, "failed to synthesize resources")
+		conditions.Set(cdk8sAppProxy, metav1.Condition{
+			Type:    clusterv1.AvailableCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  metav1.StatusFailure,
+			Message: "Failed to synth cdk8s code",
+		})
+		// The error names the exceeded limit or the compiler errors, followed by the tail of the output.
+		message := sourceMessage(src.Name, err.Error())
+		if output := synthesizer.OutputTail(err, synthOutputTailLines); output != "" {
+			message += "\n" + output
+		}
+		reason := addonsv1alpha1.SynthFailedReason
+		var offlineErr *synthesizer.OfflineError
+		if errors.As(err, &offlineErr) {
+			reason = addonsv1alpha1.VendoredDependenciesMissingReason
+		}
 		conditions.Set(cdk8sAppProxy, metav1.Condition{
 			Type:    clusterv1.ReadyCondition,
-			Status:  metav1.ConditionTrue,
-			Reason:  "Successful",
-			Message: "Cdk8sAppProxy is ready",
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: truncateMessage(message, maxConditionMessage),
 		})
-	}
-
-	if err = r.Status().Update(ctx, cdk8sAppProxy); err != nil {
-		logs.Error(err, "failed to update cdk8sAppProxy status")
+		r.Recorder.Eventf(cdk8sAppProxy, nil, corev1.EventTypeWarning, reason, "Synthesize", "%s", truncateMessage(message, maxEventNote))
+		if statusErr := r.Status().Update(ctx, cdk8sAppProxy); statusErr != nil {
+			logs.Error(statusErr, "failed to update cdk8sAppProxy status")
+		}
 
-		return ctrl.Result{}, err
+		return nil, err
 	}
+	logs.Info("Synthesized resources", "count", len(parsedResources))
 
-	logs.Info("Reconciliation finished successfully")
-
-	return ctrl.Result{}, err
+	return parsedResources, nil
 }
 
 // ClusterToCdk8sAppProxyMapper is a handler.ToRequestsFunc to be used to enqeue requests for Cdk8sAppProxyReconciler.
@@ -238,3 +732,39 @@ func (r *Reconciler) ClusterToCdk8sAppProxyMapper(ctx context.Context, o client.
 
 	return results
 }
+
+// ValuesToCdk8sAppProxyMapper is a handler.ToRequestsFunc to be used to enqeue requests for Cdk8sAppProxyReconciler.
+// It maps ConfigMap and Secret events to the Cdk8sAppProxies reading values from them.
+func (r *Reconciler) ValuesToCdk8sAppProxyMapper(ctx context.Context, o client.Object) (results []ctrl.Request) {
+	var kind addonsv1alpha1.ValuesKind
+	switch o.(type) {
+	case *corev1.ConfigMap:
+		kind = addonsv1alpha1.ValuesKindConfigMap
+	case *corev1.Secret:
+		kind = addonsv1alpha1.ValuesKindSecret
+	default:
+		return results
+	}
+
+	cdk8sappproxies := &addonsv1alpha1.Cdk8sAppProxyList{}
+	if err := r.List(ctx, cdk8sappproxies, client.InNamespace(o.GetNamespace())); err != nil {
+		return results
+	}
+
+	for i := range cdk8sappproxies.Items {
+		if utils.References(&cdk8sappproxies.Items[i], kind, o.GetName()) {
+			results = append(results, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&cdk8sappproxies.Items[i])})
+		}
+	}
+
+	return results
+}
+
+// truncateMessage shortens message to at most limit bytes, keeping it valid UTF-8.
+func truncateMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+
+	return strings.ToValidUTF8(message[:limit-3], "") + "..."
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// previewStatusContext identifies the commit status the generator reports on queued pull requests.
+const previewStatusContext = "cdk8s/preview"
+
+// preview is a Cdk8sAppProxy the generator deploys for a pull request, branch or tag.
+type preview struct {
+	name      string
+	labels    map[string]string
+	vars      addonsv1alpha1.TemplateVars
+	repoURL   string
+	reference string
+	commit    string
+	// headSHA is the last pushed commit. It differs from commit when deploying the merge result of a PR.
+	headSHA string
+	// err is set if the checkout could not be resolved. An existing Cdk8sAppProxy is kept unchanged.
+	err error
+}
+
+// schedulePreviews returns the state of every preview. Previews idle for longer than the TTL expire,
+// deployed previews keep their slot and the remaining slots go to the queued previews in order of
+// PR number and name. Deployed previews idle for longer than SleepAfter are put to sleep.
+func schedulePreviews(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, previews []preview, now time.Time) (statuses []addonsv1alpha1.PreviewStatus) {
+	capacity := generator.Spec.Capacity
+	if capacity == nil {
+		capacity = &addonsv1alpha1.PreviewCapacity{}
+	}
+
+	previous := make(map[string]addonsv1alpha1.PreviewStatus, len(generator.Status.Previews))
+	for _, status := range generator.Status.Previews {
+		previous[status.Name] = status
+	}
+
+	deployed := func(state addonsv1alpha1.PreviewState) bool {
+		return state == addonsv1alpha1.PreviewStateActive || state == addonsv1alpha1.PreviewStateSleeping
+	}
+
+	used := 0
+	var candidates []addonsv1alpha1.PreviewStatus
+	for _, p := range previews {
+		prev, known := previous[p.name]
+		if p.err != nil {
+			// Keep the last known state of previews whose checkout can not be resolved right now.
+			if known {
+				statuses = append(statuses, prev)
+				if deployed(prev.State) {
+					used++
+				}
+			}
+
+			continue
+		}
+
+		status := addonsv1alpha1.PreviewStatus{
+			Name:         p.name,
+			Number:       p.vars.Number,
+			Ref:          p.vars.Ref,
+			HeadSHA:      p.headSHA,
+			LastPushTime: metav1.Time{Time: now},
+			State:        addonsv1alpha1.PreviewStateQueued,
+		}
+		if known && prev.HeadSHA == p.headSHA {
+			status.LastPushTime = prev.LastPushTime
+		}
+
+		if capacity.TTL != nil && now.Sub(status.LastPushTime.Time) >= capacity.TTL.Duration {
+			status.State = addonsv1alpha1.PreviewStateExpired
+			statuses = append(statuses, status)
+
+			continue
+		}
+
+		// Remember whether the preview is deployed, so it keeps its slot.
+		if known && deployed(prev.State) {
+			status.State = prev.State
+		}
+		candidates = append(candidates, status)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iDeployed, jDeployed := deployed(candidates[i].State), deployed(candidates[j].State)
+		if iDeployed != jDeployed {
+			return iDeployed
+		}
+
+		return lessPreview(candidates[i], candidates[j])
+	})
+
+	for _, status := range candidates {
+		status.State = addonsv1alpha1.PreviewStateQueued
+		if capacity.MaxPreviews == nil || used < int(*capacity.MaxPreviews) {
+			used++
+			status.State = addonsv1alpha1.PreviewStateActive
+			if capacity.SleepAfter != nil && now.Sub(status.LastPushTime.Time) >= capacity.SleepAfter.Duration {
+				status.State = addonsv1alpha1.PreviewStateSleeping
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return lessPreview(statuses[i], statuses[j])
+	})
+
+	return statuses
+}
+
+// lessPreview orders previews by PR number and name.
+func lessPreview(a, b addonsv1alpha1.PreviewStatus) bool {
+	if a.Number != b.Number {
+		return a.Number < b.Number
+	}
+
+	return a.Name < b.Name
+}
+
+// deployPreviews creates or updates the Cdk8sAppProxies of the deployed previews and reports queued
+// pull requests through a commit status. It returns the names of the Cdk8sAppProxies to keep.
+func (r *GeneratorReconciler) deployPreviews(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, previews []preview, statuses []addonsv1alpha1.PreviewStatus, secretRef []byte) (active map[string]bool) {
+	logs := ctrl.LoggerFrom(ctx)
+
+	byName := make(map[string]preview, len(previews))
+	for _, p := range previews {
+		byName[p.name] = p
+	}
+	previous := make(map[string]addonsv1alpha1.PreviewStatus, len(generator.Status.Previews))
+	for _, status := range generator.Status.Previews {
+		previous[status.Name] = status
+	}
+
+	deployed, queued := 0, 0
+	for _, status := range statuses {
+		if status.State == addonsv1alpha1.PreviewStateActive || status.State == addonsv1alpha1.PreviewStateSleeping {
+			deployed++
+		}
+	}
+
+	active = make(map[string]bool)
+	for _, status := range statuses {
+		p := byName[status.Name]
+		prev, known := previous[status.Name]
+
+		switch status.State {
+		case addonsv1alpha1.PreviewStateActive, addonsv1alpha1.PreviewStateSleeping:
+			active[status.Name] = true
+			if p.err != nil {
+				continue
+			}
+			if generator.Spec.Cluster != nil {
+				if err := r.applyCluster(ctx, generator, p); err != nil {
+					logs.Error(err, "failed to reconcile preview cluster", "proxyName", status.Name)
+
+					continue
+				}
+			}
+			if err := r.applyProxy(ctx, generator, p, status.State == addonsv1alpha1.PreviewStateSleeping); err != nil {
+				logs.Error(err, "failed to reconcile preview", "proxyName", status.Name)
+			}
+			if known && prev.State == addonsv1alpha1.PreviewStateQueued {
+				r.setPreviewStatus(ctx, generator, p, secretRef, gitoperator.CommitStatus{
+					State:       gitoperator.CommitStateSuccess,
+					Context:     previewStatusContext,
+					Description: "A preview slot was assigned, the preview is being deployed",
+				})
+			}
+		case addonsv1alpha1.PreviewStateQueued:
+			queued++
+			// Report the wait once per pushed commit.
+			if known && prev.State == addonsv1alpha1.PreviewStateQueued && prev.HeadSHA == status.HeadSHA {
+				continue
+			}
+			logs.Info("Preview capacity reached, queuing preview", "proxyName", status.Name, "position", queued)
+			r.setPreviewStatus(ctx, generator, p, secretRef, gitoperator.CommitStatus{
+				State:       gitoperator.CommitStatePending,
+				Context:     previewStatusContext,
+				Description: fmt.Sprintf("Waiting for a free preview slot: %d previews deployed, position %d in the queue", deployed, queued),
+			})
+		case addonsv1alpha1.PreviewStateExpired:
+			if !known || prev.State != addonsv1alpha1.PreviewStateExpired {
+				logs.Info("Preview TTL passed, removing preview until the next push", "proxyName", status.Name)
+			}
+		}
+	}
+
+	return active
+}
+
+// setPreviewStatus reports the commit status on the head commit of a pull request preview. Failures
+// are only logged, as the status is informational.
+func (r *GeneratorReconciler) setPreviewStatus(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, p preview, secretRef []byte, status gitoperator.CommitStatus) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("proxyName", p.name)
+
+	if p.vars.Number == 0 || p.headSHA == "" {
+		return
+	}
+
+	providerClient, err := gitoperator.NewProviderClient(generator.Spec.Source.URL, nil)
+	if err != nil {
+		logs.Error(err, "failed to get provider client")
+
+		return
+	}
+
+	if err = providerClient.SetCommitStatus(ctx, generator.Spec.Source.URL, secretRef, p.headSHA, status); err != nil {
+		logs.Error(err, "failed to set commit status", "state", status.State)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// previewClusterName returns the name of the Cluster generated for the given Cdk8sAppProxy.
+func previewClusterName(proxyName string) string {
+	return namespaceName(proxyName)
+}
+
+// applyCluster creates or updates the Cluster of the preview from the generator's cluster template.
+func (r *GeneratorReconciler) applyCluster(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, p preview) (err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("proxyName", p.name)
+	template := generator.Spec.Cluster
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        previewClusterName(p.name),
+			Namespace:   generator.Namespace,
+			Labels:      make(map[string]string),
+			Annotations: template.Metadata.Annotations,
+		},
+	}
+	for key, value := range template.Metadata.Labels {
+		cluster.Labels[key] = value
+	}
+	for key, value := range p.labels {
+		cluster.Labels[key] = value
+	}
+	cluster.Labels[generatorNameLabel] = generator.Name
+	cluster.Labels[addonsv1alpha1.PreviewClusterLabel] = cluster.Name
+
+	if err = ctrl.SetControllerReference(generator, cluster, r.Scheme); err != nil {
+		return errors.Wrap(err, "failed to set controller reference")
+	}
+
+	cluster.Spec.Topology = *template.Topology.DeepCopy()
+	if template.ClusterNetwork != nil {
+		cluster.Spec.ClusterNetwork = *template.ClusterNetwork.DeepCopy()
+	}
+
+	existingCluster := &clusterv1.Cluster{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, existingCluster)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			logs.Info("Creating preview Cluster", "cluster", cluster.Name, "clusterClass", cluster.Spec.Topology.ClassRef.Name)
+			if err = r.Create(ctx, cluster); err != nil {
+				return err
+			}
+			r.Recorder.Eventf(generator, cluster, corev1.EventTypeNormal, "PreviewClusterCreated", "Create", "Created preview Cluster %s from ClusterClass %s", cluster.Name, cluster.Spec.Topology.ClassRef.Name)
+
+			return nil
+		}
+
+		return err
+	}
+
+	existingCluster.Spec.Topology = cluster.Spec.Topology
+	existingCluster.Spec.ClusterNetwork = cluster.Spec.ClusterNetwork
+	existingCluster.Labels = cluster.Labels
+	existingCluster.Annotations = cluster.Annotations
+
+	return r.Update(ctx, existingCluster)
+}
+
+// pruneClusters deletes the Clusters of the generator whose preview is not active anymore.
+func (r *GeneratorReconciler) pruneClusters(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, active map[string]bool) (err error) {
+	logs := ctrl.LoggerFrom(ctx)
+
+	activeClusters := make(map[string]bool, len(active))
+	for proxyName := range active {
+		activeClusters[previewClusterName(proxyName)] = true
+	}
+
+	clusters := &clusterv1.ClusterList{}
+	if err = r.List(ctx, clusters, client.InNamespace(generator.Namespace), client.MatchingLabels{generatorNameLabel: generator.Name}); err != nil {
+		return err
+	}
+
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if !metav1.IsControlledBy(cluster, generator) || activeClusters[cluster.Name] {
+			continue
+		}
+
+		logs.Info("Deleting preview Cluster", "cluster", cluster.Name)
+		if err = r.Delete(ctx, cluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+		r.Recorder.Eventf(generator, cluster, corev1.EventTypeNormal, "PreviewClusterDeleted", "Delete", "Deleted preview Cluster %s", cluster.Name)
+	}
+
+	return nil
+}
@@ -19,23 +19,36 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
 	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
 	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/utils"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/events"
-	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 )
 
+const (
+	// generatorNameLabel is set on generated Cdk8sAppProxies to the name of their generator.
+	generatorNameLabel = "addons.cluster.x-k8s.io/generator-name"
+	// prNumberLabel is set on generated Cdk8sAppProxies to the number of their pull request.
+	prNumberLabel = "addons.cluster.x-k8s.io/pr-number"
+	// defaultPreviewCommand is the comment command requesting a preview in OnDemand mode.
+	defaultPreviewCommand = "/preview"
+)
+
 // GeneratorReconciler reconciles a Cdk8sAppProxyGenerator object.
 type GeneratorReconciler struct {
 	client.Client
@@ -56,6 +69,8 @@ func (r *GeneratorReconciler) SetupWithManager(mgr ctrl.Manager, options control
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=cdk8sappproxygenerators/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=cdk8sappproxygenerators/finalizers,verbs=update
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=cdk8sappproxies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 func (r *GeneratorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (controller ctrl.Result, err error) {
 	logs := ctrl.LoggerFrom(ctx).WithValues("cdk8sappproxygenerator", req.NamespacedName)
@@ -71,22 +86,30 @@ func (r *GeneratorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 
 	// Determine poll interval.
-	pollInterval := 5 * time.Minute
+	pollInterval := addonsv1alpha1.DefaultGeneratorPollInterval
 	if generator.Spec.PollInterval != nil {
 		pollInterval = generator.Spec.PollInterval.Duration
 	}
 
-	// Check if it's time to poll.
+	// Check if it's time to poll. In between polls, only the deploy states of the previews are refreshed.
 	if generator.Status.LastPolledTime != nil {
 		nextPoll := generator.Status.LastPolledTime.Add(pollInterval)
 		if time.Now().Before(nextPoll) {
-			return ctrl.Result{RequeueAfter: time.Until(nextPoll)}, err
+			if err = r.refreshDeployStates(ctx, generator); err != nil {
+				logs.Error(err, "failed to refresh deploy states")
+
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{RequeueAfter: time.Until(nextPoll)}, nil
 		}
 	}
 
 	// Fetch secret for Git authentication if provided.
 	secretRef, err := utils.FetchSecret(ctx, r.Client, generator.Namespace, &generator.Spec.Source, logs)
 	if err != nil {
+		_ = r.markFailed(ctx, generator, addonsv1alpha1.AuthenticatedCondition, addonsv1alpha1.SecretNotFoundReason, err)
+
 		return ctrl.Result{}, err
 	}
 
@@ -95,53 +118,81 @@ func (r *GeneratorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	accessible, requiredAuth, err := gitImpl.CheckAccess(generator.Spec.Source.URL, secretRef, logs)
 	if err != nil {
 		logs.Error(err, "failed to check repository access")
+		_ = r.markFailed(ctx, generator, addonsv1alpha1.ProviderReachableCondition, addonsv1alpha1.ProviderUnreachableReason, err)
 
 		return ctrl.Result{}, err
 	}
 
 	if requiredAuth && len(secretRef) == 0 {
 		logs.Error(err, "Repository requires authentication but no secretRef was provided.")
+		err = r.markFailed(ctx, generator, addonsv1alpha1.AuthenticatedCondition, addonsv1alpha1.AccessDeniedReason,
+			errors.New("repository requires authentication but no secretRef was provided"))
 
-		return ctrl.Result{}, err
+		return ctrl.Result{RequeueAfter: pollInterval}, err
 	}
 
 	if !accessible {
 		logs.Error(err, "repository is not accessible. Access Denied")
+		err = r.markFailed(ctx, generator, addonsv1alpha1.AuthenticatedCondition, addonsv1alpha1.AccessDeniedReason,
+			errors.New("repository is not accessible with the given credentials"))
 
-		return ctrl.Result{}, err
+		return ctrl.Result{RequeueAfter: pollInterval}, err
 	}
 
-	// List pull requests.
-	providerClient, err := gitoperator.NewProviderClient(generator.Spec.Source.URL, nil)
+	// Collect a preview per pull request, branch or tag.
+	var previews []preview
+	var commands []addonsv1alpha1.PreviewCommandStatus
+	switch generator.Spec.Mode {
+	case addonsv1alpha1.GeneratorModeBranches, addonsv1alpha1.GeneratorModeTags:
+		previews, err = r.reconcileRefs(ctx, generator, gitImpl, secretRef)
+	case addonsv1alpha1.GeneratorModePullRequests:
+		fallthrough
+	default:
+		previews, commands, err = r.reconcilePRs(ctx, generator, gitImpl, secretRef)
+	}
 	if err != nil {
-		logs.Error(err, "failed to get provider client")
+		_ = r.markFailed(ctx, generator, addonsv1alpha1.ProviderReachableCondition, addonsv1alpha1.ProviderUnreachableReason, err)
 
 		return ctrl.Result{}, err
 	}
 
-	prs, err := providerClient.ListPullRequests(ctx, generator.Spec.Source.URL, secretRef)
-	if err != nil {
-		logs.Error(err, "failed to list pull requests")
+	// Assign the preview slots and create or update a Cdk8sAppProxy per deployed preview.
+	statuses := schedulePreviews(generator, previews, time.Now())
+	active := r.deployPreviews(ctx, generator, previews, statuses, secretRef)
+
+	// Remove Cdk8sAppProxies of closed or no longer requested PRs and of deleted branches or tags.
+	if err = r.pruneProxies(ctx, generator, active); err != nil {
+		logs.Error(err, "failed to prune Cdk8sAppProxies")
+		_ = r.markFailed(ctx, generator, clusterv1.ReadyCondition, addonsv1alpha1.ReconcileFailedReason, err)
 
 		return ctrl.Result{}, err
 	}
 
-	// Process each PR.
-	for _, pr := range prs {
-		if err = r.reconcilePR(ctx, generator, pr); err != nil {
-			logs.Error(err, "failed to reconcile PR", "prNumber", pr.Number)
-		}
+	// Remove the Clusters of removed previews, or all of them if previews do not get their own Cluster anymore.
+	activeClusters := active
+	if generator.Spec.Cluster == nil {
+		activeClusters = nil
 	}
+	if err = r.pruneClusters(ctx, generator, activeClusters); err != nil {
+		logs.Error(err, "failed to prune preview Clusters")
+		_ = r.markFailed(ctx, generator, clusterv1.ReadyCondition, addonsv1alpha1.ReconcileFailedReason, err)
 
-	// Update last polled time.
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		latest := &addonsv1alpha1.Cdk8sAppProxyGenerator{}
-		if err = r.Get(ctx, req.NamespacedName, latest); err != nil {
-			return err
-		}
-		latest.Status.LastPolledTime = &metav1.Time{Time: time.Now()}
+		return ctrl.Result{}, err
+	}
 
-		return r.Status().Update(ctx, latest)
+	statuses, err = r.deployStates(ctx, generator, statuses)
+	if err != nil {
+		logs.Error(err, "failed to get deploy states")
+
+		return ctrl.Result{}, err
+	}
+
+	// Update last polled time, previews and conditions.
+	err = r.updateStatus(ctx, generator, func(latest *addonsv1alpha1.Cdk8sAppProxyGenerator) {
+		latest.Status.LastPolledTime = &metav1.Time{Time: time.Now()}
+		latest.Status.Commands = commands
+		latest.Status.Previews = statuses
+		markReady(latest)
 	})
 	if err != nil {
 		logs.Error(err, "failed to update status")
@@ -152,57 +203,126 @@ func (r *GeneratorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	return ctrl.Result{RequeueAfter: pollInterval}, nil
 }
 
-func (r *GeneratorReconciler) reconcilePR(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, pr gitoperator.PullRequest) (err error) {
-	logs := ctrl.LoggerFrom(ctx).WithValues("prNumber", pr.Number)
+// reconcilePRs returns a preview per open pull request that matches the filters, the fork policy
+// and the trigger, along with the command states.
+func (r *GeneratorReconciler) reconcilePRs(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, gitImpl *gitoperator.Implementer, secretRef []byte) (previews []preview, commands []addonsv1alpha1.PreviewCommandStatus, err error) {
+	logs := ctrl.LoggerFrom(ctx)
+
+	// List pull requests.
+	providerClient, err := gitoperator.NewProviderClient(generator.Spec.Source.URL, nil)
+	if err != nil {
+		logs.Error(err, "failed to get provider client")
+
+		return nil, nil, err
+	}
+
+	prs, err := providerClient.ListPullRequests(ctx, generator.Spec.Source.URL, secretRef)
+	if err != nil {
+		logs.Error(err, "failed to list pull requests")
+
+		return nil, nil, err
+	}
 
-	// Apply filters.
-	if len(generator.Spec.Filters) > 0 {
-		match := false
-		for _, filter := range generator.Spec.Filters {
-			if filter.BranchMatch == "" || filter.BranchMatch == pr.BaseBranch {
-				match = true
+	// Process each PR.
+	for _, pr := range prs {
+		if !matchesFilters(generator, pr) {
+			logs.Info("PR does not match any filters, skipping", "prNumber", pr.Number, "baseBranch", pr.BaseBranch)
+
+			continue
+		}
 
-				break
+		if pr.Fork && !forkAllowed(generator, pr) {
+			logs.Info("PR from fork is not approved by the fork policy, skipping", "prNumber", pr.Number, "author", pr.Author)
+
+			continue
+		}
+
+		if onDemand(generator) {
+			state := commandStatus(generator, pr.Number)
+			requested, err := r.previewRequested(ctx, generator, providerClient, secretRef, pr, &state)
+			if err != nil {
+				logs.Error(err, "failed to evaluate preview commands", "prNumber", pr.Number)
+			}
+			commands = append(commands, state)
+			if !requested {
+				continue
 			}
 		}
-		if !match {
-			logs.Info("PR does not match any filters, skipping", "baseBranch", pr.BaseBranch)
 
-			return nil
+		p := prPreview(generator, pr, gitImpl, secretRef, logs)
+		if p.err != nil {
+			logs.Error(p.err, "failed to resolve PR checkout", "prNumber", pr.Number)
 		}
+		previews = append(previews, p)
+	}
+
+	return previews, keepCommandStatus(generator, prs, commands), nil
+}
+
+// prPreview returns the preview of the given PR.
+func prPreview(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, pr gitoperator.PullRequest, gitImpl *gitoperator.Implementer, secretRef []byte, logs logr.Logger) preview {
+	repoURL, reference, commit, err := prCheckout(generator, pr, gitImpl, secretRef, logs.WithValues("prNumber", pr.Number))
+
+	return preview{
+		name:      generatedProxyName(generator, pr.Number),
+		labels:    map[string]string{prNumberLabel: strconv.Itoa(pr.Number)},
+		repoURL:   repoURL,
+		reference: reference,
+		commit:    commit,
+		headSHA:   pr.HeadSHA,
+		err:       err,
+		vars: addonsv1alpha1.TemplateVars{
+			Number:     pr.Number,
+			Ref:        pr.Branch,
+			Branch:     pr.Branch,
+			HeadSHA:    commit,
+			BaseBranch: pr.BaseBranch,
+			Author:     pr.Author,
+			Labels:     pr.Labels,
+		},
 	}
+}
+
+// applyProxy creates or updates the Cdk8sAppProxy of the preview from the generator template rendered
+// with the preview variables. A sleeping preview has its workloads scaled to zero.
+func (r *GeneratorReconciler) applyProxy(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, p preview, sleep bool) (err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("proxyName", p.name)
 
-	// Define the Cdk8sAppProxy name.
-	proxyName := fmt.Sprintf("%s-pr-%d", generator.Name, pr.Number)
+	template, err := generator.Spec.Template.Render(p.vars)
+	if err != nil {
+		return errors.Wrap(err, "failed to render template")
+	}
 
 	proxy := &addonsv1alpha1.Cdk8sAppProxy{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        proxyName,
+			Name:        p.name,
 			Namespace:   generator.Namespace,
-			Labels:      generator.Spec.Template.Metadata.Labels,
-			Annotations: generator.Spec.Template.Metadata.Annotations,
+			Labels:      make(map[string]string),
+			Annotations: template.Metadata.Annotations,
 		},
 	}
 
-	if proxy.Labels == nil {
-		proxy.Labels = make(map[string]string)
+	for key, value := range template.Metadata.Labels {
+		proxy.Labels[key] = value
+	}
+	for key, value := range p.labels {
+		proxy.Labels[key] = value
 	}
-	proxy.Labels["addons.cluster.x-k8s.io/generator-name"] = generator.Name
-	proxy.Labels["addons.cluster.x-k8s.io/pr-number"] = fmt.Sprintf("%d", pr.Number)
+	proxy.Labels[generatorNameLabel] = generator.Name
 
 	// Set OwnerReference.
 	if err = ctrl.SetControllerReference(generator, proxy, r.Scheme); err != nil {
 		return errors.Wrap(err, "failed to set controller reference")
 	}
 
-	// Render the template spec.
-	proxy.Spec = generator.Spec.Template.Spec
-	// Override GitRepository information with PR specifics.
+	proxy.Spec = template.Spec
+	// Override GitRepository information with the checkout specifics.
 	if proxy.Spec.GitRepository == nil {
 		proxy.Spec.GitRepository = &addonsv1alpha1.GitRepositorySpec{}
 	}
-	proxy.Spec.GitRepository.URL = generator.Spec.Source.URL
-	proxy.Spec.GitRepository.Reference = pr.Branch
+	proxy.Spec.GitRepository.URL = p.repoURL
+	proxy.Spec.GitRepository.Reference = p.reference
+	proxy.Spec.GitRepository.Commit = p.commit
 	proxy.Spec.GitRepository.SecretRef = generator.Spec.Source.SecretRef
 	proxy.Spec.GitRepository.SecretKey = generator.Spec.Source.SecretKey
 	if generator.Spec.Source.Path != "" {
@@ -211,24 +331,131 @@ func (r *GeneratorReconciler) reconcilePR(ctx context.Context, generator *addons
 	if generator.Spec.Path != "" {
 		proxy.Spec.GitRepository.Path = generator.Spec.Path
 	}
+	proxy.Spec.Sleep = sleep
+	if generator.Spec.Cluster != nil {
+		proxy.Spec.ClusterSelector = metav1.LabelSelector{
+			MatchLabels: map[string]string{addonsv1alpha1.PreviewClusterLabel: previewClusterName(p.name)},
+		}
+	}
+	if generator.Spec.Isolation != nil {
+		proxy.Spec.TargetNamespace = &addonsv1alpha1.TargetNamespaceSpec{
+			Name:               namespaceName(p.name),
+			NamespaceIsolation: *generator.Spec.Isolation.DeepCopy(),
+		}
+	}
 
 	// Create or Update the Cdk8sAppProxy.
 	existingProxy := &addonsv1alpha1.Cdk8sAppProxy{}
 	err = r.Get(ctx, types.NamespacedName{Namespace: proxy.Namespace, Name: proxy.Name}, existingProxy)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
-			logs.Info("Creating Cdk8sAppProxy for PR", "proxyName", proxyName)
+			logs.Info("Creating Cdk8sAppProxy", "ref", p.reference, "commit", p.commit)
+			if err = r.Create(ctx, proxy); err != nil {
+				return err
+			}
+			r.Recorder.Eventf(generator, proxy, corev1.EventTypeNormal, "ProxyCreated", "Create", "Created Cdk8sAppProxy %s for %s at %s", proxy.Name, p.reference, p.commit)
 
-			return r.Create(ctx, proxy)
+			return nil
 		}
 
 		return err
 	}
 
-	logs.Info("Updating Cdk8sAppProxy for PR", "proxyName", proxyName, "ref", proxy.Spec.GitRepository.Reference, "path", proxy.Spec.GitRepository.Path)
+	if equality.Semantic.DeepEqual(existingProxy.Spec, proxy.Spec) &&
+		equality.Semantic.DeepEqual(existingProxy.Labels, proxy.Labels) &&
+		equality.Semantic.DeepEqual(existingProxy.Annotations, proxy.Annotations) {
+		return nil
+	}
+
+	logs.Info("Updating Cdk8sAppProxy", "ref", proxy.Spec.GitRepository.Reference, "commit", proxy.Spec.GitRepository.Commit, "path", proxy.Spec.GitRepository.Path, "sleep", sleep)
 	existingProxy.Spec = proxy.Spec
 	existingProxy.Labels = proxy.Labels
 	existingProxy.Annotations = proxy.Annotations
+	if err = r.Update(ctx, existingProxy); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(generator, existingProxy, corev1.EventTypeNormal, "ProxyUpdated", "Update", "Updated Cdk8sAppProxy %s to %s at %s", proxy.Name, p.reference, p.commit)
+
+	return nil
+}
+
+// prCheckout returns the repository URL, reference and pinned commit deployed for the given PR.
+func prCheckout(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, pr gitoperator.PullRequest, gitImpl *gitoperator.Implementer, secretRef []byte, logs logr.Logger) (repoURL string, reference string, commit string, err error) {
+	if generator.Spec.Checkout == addonsv1alpha1.PRCheckoutMerge {
+		if pr.MergeRef != "" {
+			// Merge results live in the base repository, also for PRs from forks.
+			commit, err = gitImpl.Hash(generator.Spec.Source.URL, secretRef, pr.MergeRef, logs)
+			if err != nil {
+				return "", "", "", errors.Wrap(err, "failed to resolve merge ref")
+			}
+			if commit == "" {
+				return "", "", "", errors.Errorf("merge ref %s is not available, the PR might have conflicts", pr.MergeRef)
+			}
+
+			return generator.Spec.Source.URL, pr.MergeRef, commit, nil
+		}
+		logs.Info("Provider does not publish merge results, deploying the PR head instead")
+	}
+
+	repoURL = generator.Spec.Source.URL
+	if pr.HeadRepoURL != "" {
+		// PRs from forks are cloned from the fork, as their branch does not exist in the source repository.
+		repoURL = pr.HeadRepoURL
+	}
+
+	return repoURL, pr.Branch, pr.HeadSHA, nil
+}
+
+// generatedProxyName returns the name of the Cdk8sAppProxy generated for the given PR.
+func generatedProxyName(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, number int) string {
+	return fmt.Sprintf("%s-pr-%d", generator.Name, number)
+}
+
+// matchesFilters reports whether the PR matches any of the generator filters.
+func matchesFilters(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, pr gitoperator.PullRequest) bool {
+	if len(generator.Spec.Filters) == 0 {
+		return true
+	}
+
+	for _, filter := range generator.Spec.Filters {
+		if filter.BranchMatch == "" {
+			return true
+		}
+		// Invalid expressions are rejected by the webhook and never match.
+		branchRegexp, err := filter.BranchRegexp()
+		if err == nil && branchRegexp.MatchString(pr.BaseBranch) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pruneProxies deletes the Cdk8sAppProxies of the generator that are not active anymore.
+func (r *GeneratorReconciler) pruneProxies(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, active map[string]bool) (err error) {
+	logs := ctrl.LoggerFrom(ctx)
+
+	proxies := &addonsv1alpha1.Cdk8sAppProxyList{}
+	if err = r.List(ctx, proxies, client.InNamespace(generator.Namespace), client.MatchingLabels{generatorNameLabel: generator.Name}); err != nil {
+		return err
+	}
+
+	for i := range proxies.Items {
+		proxy := &proxies.Items[i]
+		if !metav1.IsControlledBy(proxy, generator) || active[proxy.Name] {
+			continue
+		}
+
+		logs.Info("Deleting inactive Cdk8sAppProxy", "proxyName", proxy.Name)
+		if err = r.Delete(ctx, proxy); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+		r.Recorder.Eventf(generator, proxy, corev1.EventTypeNormal, "ProxyDeleted", "Delete", "Deleted inactive Cdk8sAppProxy %s", proxy.Name)
+	}
 
-	return r.Update(ctx, existingProxy)
+	return nil
 }
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// branchLabel is set on Cdk8sAppProxies generated for a branch to the sanitized branch name.
+	branchLabel = "addons.cluster.x-k8s.io/branch"
+	// tagLabel is set on Cdk8sAppProxies generated for a tag to the sanitized tag name.
+	tagLabel = "addons.cluster.x-k8s.io/tag"
+	// maxLabelValueLength is the maximum length of a Kubernetes label value.
+	maxLabelValueLength = 63
+	// nameHashLength is the length of the hash of the original name appended to altered names.
+	nameHashLength = 8
+)
+
+var (
+	// invalidNameChars matches the characters not allowed in label values and object names.
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+	// invalidNamespaceChars matches the characters not allowed in namespace names.
+	invalidNamespaceChars = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// reconcileRefs returns a preview per remote branch or tag matching the ref patterns.
+func (r *GeneratorReconciler) reconcileRefs(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, gitImpl *gitoperator.Implementer, secretRef []byte) (previews []preview, err error) {
+	logs := ctrl.LoggerFrom(ctx)
+
+	kind, prefix, label := "branch", "refs/heads/", branchLabel
+	if generator.Spec.Mode == addonsv1alpha1.GeneratorModeTags {
+		kind, prefix, label = "tag", "refs/tags/", tagLabel
+	}
+
+	refs, err := gitImpl.ListRefs(generator.Spec.Source.URL, secretRef, prefix, logs)
+	if err != nil {
+		logs.Error(err, "failed to list remote refs", "prefix", prefix)
+
+		return nil, err
+	}
+
+	for _, ref := range refs {
+		if !matchesRefPatterns(generator.Spec.RefPatterns, ref.Name) {
+			continue
+		}
+
+		// Branches are checked out by name, tags by their full reference name.
+		reference := ref.Name
+		if kind == "tag" {
+			reference = prefix + ref.Name
+		}
+
+		p := preview{
+			name:      generatedRefProxyName(generator, kind, ref.Name),
+			labels:    map[string]string{label: sanitizeName(ref.Name)},
+			vars:      addonsv1alpha1.TemplateVars{Ref: ref.Name, HeadSHA: ref.Hash},
+			repoURL:   generator.Spec.Source.URL,
+			reference: reference,
+			commit:    ref.Hash,
+			headSHA:   ref.Hash,
+		}
+		if kind == "branch" {
+			p.vars.Branch = ref.Name
+		}
+		previews = append(previews, p)
+	}
+
+	return previews, nil
+}
+
+// matchesRefPatterns reports whether name matches any of the glob patterns. Every name matches if there are no patterns.
+func matchesRefPatterns(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generatedRefProxyName returns the name of the Cdk8sAppProxy generated for the given branch or tag.
+func generatedRefProxyName(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, kind string, name string) string {
+	return uniqueName(generator.Name+"-"+kind+"-"+name, invalidNameChars)
+}
+
+// sanitizeName turns a branch or tag name into a valid label value, e.g. release/1.0 into
+// release-1.0-<hash>. Names which are valid as they are, such as release-1.0, are kept.
+func sanitizeName(name string) string {
+	return uniqueName(name, invalidNameChars)
+}
+
+// namespaceName turns the name of a generated Cdk8sAppProxy into a valid namespace name, e.g.
+// app-branch-release-1.0 into app-branch-release-1-0-<hash>.
+func namespaceName(proxyName string) string {
+	return uniqueName(proxyName, invalidNamespaceChars)
+}
+
+// uniqueName replaces the invalid characters of name with '-' and truncates it to the maximum length
+// of a label value. If that alters name, a short hash of name is appended, so distinct names such as
+// release/1.0 and release-1.0, or long names sharing a prefix, do not map to the same result.
+func uniqueName(name string, invalid *regexp.Regexp) string {
+	sanitized := strings.Trim(invalid.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	if sanitized == name && len(sanitized) <= maxLabelValueLength {
+		return sanitized
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+	if maxLength := maxLabelValueLength - len("-") - nameHashLength; len(sanitized) > maxLength {
+		sanitized = strings.TrimRight(sanitized[:maxLength], "-.")
+	}
+	if sanitized == "" {
+		return hash
+	}
+
+	return sanitized + "-" + hash
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// updateStatus applies mutate to the latest version of the generator and persists its status.
+func (r *GeneratorReconciler) updateStatus(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, mutate func(latest *addonsv1alpha1.Cdk8sAppProxyGenerator)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &addonsv1alpha1.Cdk8sAppProxyGenerator{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(generator), latest); err != nil {
+			return err
+		}
+		mutate(latest)
+
+		return r.Status().Update(ctx, latest)
+	})
+}
+
+// markFailed sets the given condition and the Ready condition of the generator to false, records a
+// warning event and persists the status. The returned error is the one of the status update.
+func (r *GeneratorReconciler) markFailed(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, conditionType string, reason string, cause error) error {
+	logs := ctrl.LoggerFrom(ctx)
+
+	r.Recorder.Eventf(generator, nil, corev1.EventTypeWarning, reason, "Reconcile", "%s", cause.Error())
+
+	err := r.updateStatus(ctx, generator, func(latest *addonsv1alpha1.Cdk8sAppProxyGenerator) {
+		conditionTypes := []string{conditionType}
+		if conditionType != clusterv1.ReadyCondition {
+			conditionTypes = append(conditionTypes, clusterv1.ReadyCondition)
+		}
+		for _, t := range conditionTypes {
+			conditions.Set(latest, metav1.Condition{
+				Type:    t,
+				Status:  metav1.ConditionFalse,
+				Reason:  reason,
+				Message: cause.Error(),
+			})
+		}
+	})
+	if err != nil {
+		logs.Error(err, "failed to update status")
+	}
+
+	return err
+}
+
+// markReady sets the ProviderReachable, Authenticated and Ready conditions of the latest generator to true.
+func markReady(latest *addonsv1alpha1.Cdk8sAppProxyGenerator) {
+	active, queued := 0, 0
+	for _, status := range latest.Status.Previews {
+		switch status.State {
+		case addonsv1alpha1.PreviewStateActive, addonsv1alpha1.PreviewStateSleeping:
+			active++
+		case addonsv1alpha1.PreviewStateQueued:
+			queued++
+		}
+	}
+
+	conditions.Set(latest, metav1.Condition{
+		Type:    addonsv1alpha1.ProviderReachableCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  addonsv1alpha1.ProviderReachableCondition,
+		Message: "Git provider is reachable",
+	})
+	conditions.Set(latest, metav1.Condition{
+		Type:    addonsv1alpha1.AuthenticatedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  addonsv1alpha1.AuthenticatedCondition,
+		Message: "Repository is accessible",
+	})
+	conditions.Set(latest, metav1.Condition{
+		Type:    clusterv1.ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Successful",
+		Message: fmt.Sprintf("%d previews active, %d queued", active, queued),
+	})
+}
+
+// deployStates returns a copy of the preview statuses with the deploy state of the active previews
+// taken from the Ready condition of their Cdk8sAppProxy.
+func (r *GeneratorReconciler) deployStates(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, statuses []addonsv1alpha1.PreviewStatus) (updated []addonsv1alpha1.PreviewStatus, err error) {
+	for _, status := range statuses {
+		status.DeployState, status.Message = "", ""
+		if status.State == addonsv1alpha1.PreviewStateActive || status.State == addonsv1alpha1.PreviewStateSleeping {
+			proxy := &addonsv1alpha1.Cdk8sAppProxy{}
+			err = r.Get(ctx, types.NamespacedName{Namespace: generator.Namespace, Name: status.Name}, proxy)
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			status.DeployState, status.Message = addonsv1alpha1.PreviewDeploying, ""
+			if !apierrors.IsNotFound(err) {
+				status.DeployState, status.Message = deployState(proxy)
+			}
+		}
+		updated = append(updated, status)
+	}
+
+	return updated, nil
+}
+
+// refreshDeployStates updates the deploy states in the generator status in between polls.
+func (r *GeneratorReconciler) refreshDeployStates(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator) (err error) {
+	statuses, err := r.deployStates(ctx, generator, generator.Status.Previews)
+	if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(statuses, generator.Status.Previews) {
+		return nil
+	}
+
+	return r.updateStatus(ctx, generator, func(latest *addonsv1alpha1.Cdk8sAppProxyGenerator) {
+		latest.Status.Previews = statuses
+	})
+}
+
+// deployState derives the deploy state of a Cdk8sAppProxy from its Ready condition.
+func deployState(proxy *addonsv1alpha1.Cdk8sAppProxy) (state addonsv1alpha1.PreviewDeployState, message string) {
+	ready := conditions.Get(proxy, clusterv1.ReadyCondition)
+	switch {
+	case ready == nil:
+		return addonsv1alpha1.PreviewDeploying, ""
+	case ready.Status == metav1.ConditionTrue:
+		return addonsv1alpha1.PreviewDeployed, ready.Message
+	case ready.Reason == addonsv1alpha1.WaitingForControlPlaneReason:
+		return addonsv1alpha1.PreviewDeploying, ready.Message
+	default:
+		return addonsv1alpha1.PreviewDeployFailed, ready.Message
+	}
+}
@@ -0,0 +1,553 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantRequest bool
+		wantOK      bool
+	}{
+		{"request", "/preview", true, true},
+		{"request with surrounding whitespace", "  /preview \n", true, true},
+		{"request with trailing text on next line", "/preview\nplease", true, true},
+		{"destroy", "/preview destroy", false, true},
+		{"unknown argument", "/preview now", false, false},
+		{"other command", "/deploy", false, false},
+		{"command not on first line", "looks good\n/preview", false, false},
+		{"empty", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, ok := parseCommand(tt.body, "/preview")
+			if request != tt.wantRequest || ok != tt.wantOK {
+				t.Errorf("parseCommand(%q) = (%v, %v), want (%v, %v)", tt.body, request, ok, tt.wantRequest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestForkAllowed(t *testing.T) {
+	fork := gitoperator.PullRequest{
+		Number:      1,
+		Fork:        true,
+		Author:      "contributor",
+		Labels:      []string{"safe-to-preview"},
+		HeadRepoURL: "https://github.com/contributor/repo.git",
+	}
+
+	tests := []struct {
+		name   string
+		policy *addonsv1alpha1.ForkPolicy
+		pr     gitoperator.PullRequest
+		want   bool
+	}{
+		{"no policy denies", nil, fork, false},
+		{"deny", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyDeny}, fork, false},
+		{"required label present", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyRequireLabel, Label: "safe-to-preview"}, fork, true},
+		{"required label missing", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyRequireLabel, Label: "approved"}, fork, false},
+		{"empty required label", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyRequireLabel}, fork, false},
+		{"allowed author", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyAllowAuthors, Authors: []string{"contributor"}}, fork, true},
+		{"other author", &addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyAllowAuthors, Authors: []string{"someone"}}, fork, false},
+		{
+			"unknown head repository",
+			&addonsv1alpha1.ForkPolicy{Mode: addonsv1alpha1.ForkPolicyAllowAuthors, Authors: []string{"contributor"}},
+			gitoperator.PullRequest{Number: 2, Fork: true, Author: "contributor"},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{Forks: tt.policy}}
+			if got := forkAllowed(generator, tt.pr); got != tt.want {
+				t.Errorf("forkAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPRCheckout(t *testing.T) {
+	const sourceURL = "https://github.com/owner/repo"
+	newGenerator := func(mode addonsv1alpha1.PRCheckoutMode) *addonsv1alpha1.Cdk8sAppProxyGenerator {
+		return &addonsv1alpha1.Cdk8sAppProxyGenerator{Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{
+			Source:   addonsv1alpha1.GitRepositorySpec{URL: sourceURL},
+			Checkout: mode,
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		generator     *addonsv1alpha1.Cdk8sAppProxyGenerator
+		pr            gitoperator.PullRequest
+		wantURL       string
+		wantReference string
+		wantCommit    string
+	}{
+		{
+			name:          "head is pinned to the head commit",
+			generator:     newGenerator(""),
+			pr:            gitoperator.PullRequest{Number: 1, Branch: "feature", HeadSHA: "abc", HeadRepoURL: sourceURL, MergeRef: "refs/pull/1/merge"},
+			wantURL:       sourceURL,
+			wantReference: "feature",
+			wantCommit:    "abc",
+		},
+		{
+			name:          "head of a fork is cloned from the fork",
+			generator:     newGenerator(addonsv1alpha1.PRCheckoutHead),
+			pr:            gitoperator.PullRequest{Number: 2, Branch: "main", HeadSHA: "def", Fork: true, HeadRepoURL: "https://github.com/fork/repo.git"},
+			wantURL:       "https://github.com/fork/repo.git",
+			wantReference: "main",
+			wantCommit:    "def",
+		},
+		{
+			name:          "merge falls back to head without merge ref",
+			generator:     newGenerator(addonsv1alpha1.PRCheckoutMerge),
+			pr:            gitoperator.PullRequest{Number: 3, Branch: "feature", HeadSHA: "123", HeadRepoURL: sourceURL},
+			wantURL:       sourceURL,
+			wantReference: "feature",
+			wantCommit:    "123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoURL, reference, commit, err := prCheckout(tt.generator, tt.pr, &gitoperator.Implementer{}, nil, logr.Discard())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if repoURL != tt.wantURL || reference != tt.wantReference || commit != tt.wantCommit {
+				t.Errorf("prCheckout() = (%q, %q, %q), want (%q, %q, %q)", repoURL, reference, commit, tt.wantURL, tt.wantReference, tt.wantCommit)
+			}
+		})
+	}
+}
+
+func TestMatchesRefPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "anything", true},
+		{[]string{"release/*"}, "release/1.0", true},
+		{[]string{"release/*"}, "release/1.0/hotfix", false},
+		{[]string{"release/*"}, "main", false},
+		{[]string{"main", "v*"}, "v1.2.3", true},
+		{[]string{"[invalid"}, "main", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesRefPatterns(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchesRefPatterns(%v, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main", "main"},
+		{"release-1.0", "release-1.0"},
+		{"release/1.0", "release-1.0-05c07dbf"},
+		{"Feature/Some_Thing", "feature-some-thing-17f796e6"},
+		{"-leading/", "leading-f5f0b31f"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 54) + "-6bd5e503"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeName(tt.name); got != tt.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Long names sharing a prefix stay distinct.
+	if sanitizeName(strings.Repeat("a", 70)+"1") == sanitizeName(strings.Repeat("a", 70)+"2") {
+		t.Error("expected truncated names to differ")
+	}
+}
+
+func TestTempDirPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"cdk8s-default-app-main", "cdk8s-default-app-main-"},
+		{"cdk8s-default-app-refs/pull/42/merge", "cdk8s-default-app-refs-pull-42-merge-"},
+		{"cdk8s-default-app-../feature/x", "cdk8s-default-app-..-feature-x-"},
+		{strings.Repeat("a", 120), strings.Repeat("a", 100) + "-"},
+	}
+
+	for _, tt := range tests {
+		if got := tempDirPrefix(tt.prefix); got != tt.want {
+			t.Errorf("tempDirPrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaceName(t *testing.T) {
+	if got := namespaceName("app-branch-release-1.0"); got != "app-branch-release-1-0-edbde703" {
+		t.Errorf("namespaceName() = %q, want app-branch-release-1-0-edbde703", got)
+	}
+	if got := namespaceName("app-pr-42"); got != "app-pr-42" {
+		t.Errorf("namespaceName() = %q, want app-pr-42", got)
+	}
+}
+
+func TestSchedulePreviews(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	maxPreviews := int32(2)
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{
+		Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{
+			Capacity: &addonsv1alpha1.PreviewCapacity{
+				MaxPreviews: &maxPreviews,
+				TTL:         &metav1.Duration{Duration: 72 * time.Hour},
+				SleepAfter:  &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		},
+		Status: addonsv1alpha1.Cdk8sAppProxyGeneratorStatus{
+			Previews: []addonsv1alpha1.PreviewStatus{
+				// Deployed, idle for two days.
+				{Name: "app-pr-5", Number: 5, HeadSHA: "e", LastPushTime: metav1.NewTime(now.Add(-48 * time.Hour)), State: addonsv1alpha1.PreviewStateActive},
+				// Sleeping, but a new commit was pushed.
+				{Name: "app-pr-3", Number: 3, HeadSHA: "old", LastPushTime: metav1.NewTime(now.Add(-48 * time.Hour)), State: addonsv1alpha1.PreviewStateSleeping},
+				// Deployed, idle for longer than the TTL.
+				{Name: "app-pr-1", Number: 1, HeadSHA: "a", LastPushTime: metav1.NewTime(now.Add(-96 * time.Hour)), State: addonsv1alpha1.PreviewStateActive},
+			},
+		},
+	}
+	previews := []preview{
+		{name: "app-pr-1", headSHA: "a", vars: addonsv1alpha1.TemplateVars{Number: 1}},
+		{name: "app-pr-2", headSHA: "b", vars: addonsv1alpha1.TemplateVars{Number: 2}},
+		{name: "app-pr-3", headSHA: "c", vars: addonsv1alpha1.TemplateVars{Number: 3}},
+		{name: "app-pr-5", headSHA: "e", vars: addonsv1alpha1.TemplateVars{Number: 5}},
+	}
+
+	statuses := schedulePreviews(generator, previews, now)
+
+	want := map[string]addonsv1alpha1.PreviewState{
+		"app-pr-1": addonsv1alpha1.PreviewStateExpired,
+		// Queued, as the deployed previews keep their slots although PR 2 is older.
+		"app-pr-2": addonsv1alpha1.PreviewStateQueued,
+		"app-pr-3": addonsv1alpha1.PreviewStateActive,
+		"app-pr-5": addonsv1alpha1.PreviewStateSleeping,
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("expected %d statuses, got %+v", len(want), statuses)
+	}
+	for i, status := range statuses {
+		if status.State != want[status.Name] {
+			t.Errorf("expected %s to be %s, got %s", status.Name, want[status.Name], status.State)
+		}
+		if i > 0 && statuses[i-1].Number > status.Number {
+			t.Errorf("expected statuses ordered by PR number, got %+v", statuses)
+		}
+	}
+	if !statuses[2].LastPushTime.Equal(&metav1.Time{Time: now}) {
+		t.Errorf("expected the new commit of PR 3 to reset its last push time, got %v", statuses[2].LastPushTime)
+	}
+}
+
+func TestSchedulePreviewsUnlimited(t *testing.T) {
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{}
+	previews := []preview{
+		{name: "app-branch-main", headSHA: "a"},
+		{name: "app-branch-dev", headSHA: "b"},
+		// Checkout failures without a previous state are skipped.
+		{name: "app-branch-broken", err: errors.New("unresolvable")},
+	}
+
+	statuses := schedulePreviews(generator, previews, time.Now())
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.State != addonsv1alpha1.PreviewStateActive {
+			t.Errorf("expected %s to be active, got %s", status.Name, status.State)
+		}
+	}
+}
+
+func TestPreviewClusters(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = addonsv1alpha1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "generator-uid"},
+		Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{
+			Cluster: &addonsv1alpha1.PreviewClusterTemplate{
+				Topology: clusterv1.Topology{
+					ClassRef: clusterv1.ClusterClassRef{Name: "quick-start"},
+					Version:  "v1.33.0",
+				},
+			},
+		},
+	}
+	r := &GeneratorReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme:   scheme,
+		Recorder: events.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+
+	for _, p := range []preview{{name: "app-pr-1"}, {name: "app-pr-2"}} {
+		if err := r.applyCluster(ctx, generator, p); err != nil {
+			t.Fatalf("applyCluster(%s) returned error: %v", p.name, err)
+		}
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "app-pr-1"}, cluster); err != nil {
+		t.Fatalf("expected preview cluster, got %v", err)
+	}
+	if cluster.Spec.Topology.ClassRef.Name != "quick-start" || cluster.Labels[addonsv1alpha1.PreviewClusterLabel] != "app-pr-1" {
+		t.Errorf("unexpected preview cluster %+v", cluster)
+	}
+
+	// The Cluster of the closed PR 2 is removed.
+	if err := r.pruneClusters(ctx, generator, map[string]bool{"app-pr-1": true}); err != nil {
+		t.Fatalf("pruneClusters returned error: %v", err)
+	}
+	clusters := &clusterv1.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		t.Fatalf("failed to list clusters: %v", err)
+	}
+	if len(clusters.Items) != 1 || clusters.Items[0].Name != "app-pr-1" {
+		t.Errorf("expected only the cluster of PR 1 to remain, got %d clusters", len(clusters.Items))
+	}
+}
+
+func TestDeployStates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = addonsv1alpha1.AddToScheme(scheme)
+
+	ready := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-pr-1", Namespace: "default"},
+		Status: addonsv1alpha1.Cdk8sAppProxyStatus{Conditions: []metav1.Condition{
+			{Type: clusterv1.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Successful", Message: "Cdk8sAppProxy is ready"},
+		}},
+	}
+	waiting := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-pr-2", Namespace: "default"},
+		Status: addonsv1alpha1.Cdk8sAppProxyStatus{Conditions: []metav1.Condition{
+			{Type: clusterv1.ReadyCondition, Status: metav1.ConditionFalse, Reason: addonsv1alpha1.WaitingForControlPlaneReason},
+		}},
+	}
+	failed := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-pr-3", Namespace: "default"},
+		Status: addonsv1alpha1.Cdk8sAppProxyStatus{Conditions: []metav1.Condition{
+			{Type: clusterv1.ReadyCondition, Status: metav1.ConditionFalse, Reason: "Failure", Message: "Failed to apply resources"},
+		}},
+	}
+	r := &GeneratorReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ready, waiting, failed).Build()}
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+
+	statuses, err := r.deployStates(context.Background(), generator, []addonsv1alpha1.PreviewStatus{
+		{Name: "app-pr-1", State: addonsv1alpha1.PreviewStateActive},
+		{Name: "app-pr-2", State: addonsv1alpha1.PreviewStateActive},
+		{Name: "app-pr-3", State: addonsv1alpha1.PreviewStateSleeping},
+		{Name: "app-pr-4", State: addonsv1alpha1.PreviewStateActive},
+		{Name: "app-pr-5", State: addonsv1alpha1.PreviewStateQueued},
+	})
+	if err != nil {
+		t.Fatalf("deployStates returned error: %v", err)
+	}
+
+	want := []addonsv1alpha1.PreviewDeployState{
+		addonsv1alpha1.PreviewDeployed,
+		addonsv1alpha1.PreviewDeploying,
+		addonsv1alpha1.PreviewDeployFailed,
+		// Not created yet.
+		addonsv1alpha1.PreviewDeploying,
+		"",
+	}
+	for i, status := range statuses {
+		if status.DeployState != want[i] {
+			t.Errorf("expected %s to be %q, got %q", status.Name, want[i], status.DeployState)
+		}
+	}
+	if statuses[2].Message != "Failed to apply resources" {
+		t.Errorf("expected the failure message, got %q", statuses[2].Message)
+	}
+}
+
+func TestMatchesFilters(t *testing.T) {
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{
+		Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{
+			Filters: []addonsv1alpha1.PRFilter{{BranchMatch: "main"}, {BranchMatch: "release/.*"}},
+		},
+	}
+
+	tests := []struct {
+		baseBranch string
+		want       bool
+	}{
+		{"main", true},
+		{"release/1.0", true},
+		{"maintenance", false},
+		{"hotfix/release/1.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesFilters(generator, gitoperator.PullRequest{BaseBranch: tt.baseBranch}); got != tt.want {
+			t.Errorf("matchesFilters(%q) = %v, want %v", tt.baseBranch, got, tt.want)
+		}
+	}
+}
+
+// commandProviderClient returns fixed comments and records the command state persisted at the time
+// each acknowledgement comment is created.
+type commandProviderClient struct {
+	gitoperator.ProviderClient
+	comments     []gitoperator.Comment
+	reconciler   *GeneratorReconciler
+	acknowledged []int64
+}
+
+func (c *commandProviderClient) ListComments(_ context.Context, _ string, _ []byte, _ int) ([]gitoperator.Comment, error) {
+	return c.comments, nil
+}
+
+func (c *commandProviderClient) CreateComment(ctx context.Context, _ string, _ []byte, number int, _ string) error {
+	latest := &addonsv1alpha1.Cdk8sAppProxyGenerator{}
+	if err := c.reconciler.Get(ctx, types.NamespacedName{Namespace: "default", Name: "app"}, latest); err != nil {
+		return err
+	}
+	for _, state := range latest.Status.Commands {
+		if state.Number == number {
+			c.acknowledged = append(c.acknowledged, state.LastCommandID)
+		}
+	}
+
+	return nil
+}
+
+func TestKeepCommandStatus(t *testing.T) {
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{
+		Status: addonsv1alpha1.Cdk8sAppProxyGeneratorStatus{
+			Commands: []addonsv1alpha1.PreviewCommandStatus{
+				{Number: 1, Requested: true, LastCommandID: 10},
+				{Number: 2, Requested: true, LastCommandID: 20},
+				{Number: 3, LastCommandID: 30},
+			},
+		},
+	}
+	// PR 1 was evaluated in this poll, PR 2 was skipped by the filters and PR 3 is closed.
+	commands := []addonsv1alpha1.PreviewCommandStatus{{Number: 1, LastCommandID: 11}}
+	prs := []gitoperator.PullRequest{{Number: 1}, {Number: 2}}
+
+	got := keepCommandStatus(generator, prs, commands)
+	want := []addonsv1alpha1.PreviewCommandStatus{
+		{Number: 1, LastCommandID: 11},
+		{Number: 2, Requested: true, LastCommandID: 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keepCommandStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPreviewRequestedSavesBeforeAcknowledge(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = addonsv1alpha1.AddToScheme(scheme)
+
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: addonsv1alpha1.Cdk8sAppProxyGeneratorSpec{
+			Trigger: &addonsv1alpha1.PreviewTrigger{
+				Mode:        addonsv1alpha1.PreviewTriggerOnDemand,
+				Acknowledge: addonsv1alpha1.CommandAcknowledgementComment,
+			},
+		},
+	}
+	r := &GeneratorReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(generator).WithStatusSubresource(generator).Build()}
+	providerClient := &commandProviderClient{
+		reconciler: r,
+		comments: []gitoperator.Comment{
+			{ID: 7, Author: "octocat", Body: "/preview", Maintainer: true},
+			{ID: 9, Author: "octocat", Body: "/preview destroy", Maintainer: true},
+		},
+	}
+	state := addonsv1alpha1.PreviewCommandStatus{Number: 42}
+
+	requested, err := r.previewRequested(context.Background(), generator, providerClient, nil, gitoperator.PullRequest{Number: 42}, &state)
+	if err != nil {
+		t.Fatalf("previewRequested returned error: %v", err)
+	}
+	if requested || state.LastCommandID != 9 {
+		t.Errorf("expected the destroy command to be the latest, got requested=%v state=%+v", requested, state)
+	}
+	if len(providerClient.acknowledged) != 2 || providerClient.acknowledged[0] != 7 || providerClient.acknowledged[1] != 9 {
+		t.Errorf("expected every command to be saved before its acknowledgement, got %v", providerClient.acknowledged)
+	}
+}
+
+func TestExpiredPreviewFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = addonsv1alpha1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	generator := &addonsv1alpha1.Cdk8sAppProxyGenerator{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "generator-uid"}}
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-pr-1", Namespace: "default", Labels: map[string]string{generatorNameLabel: "app"}},
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{addonsv1alpha1.PreviewClusterLabel: "app-pr-1"}},
+		},
+	}
+	if err := ctrl.SetControllerReference(generator, proxy, scheme); err != nil {
+		t.Fatalf("failed to set controller reference: %v", err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(proxy).WithStatusSubresource(proxy).Build()
+	r := &Reconciler{Client: c, Scheme: scheme, Recorder: events.NewFakeRecorder(10)}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "app-pr-1"}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := c.Get(ctx, key, proxy); err != nil || !controllerutil.ContainsFinalizer(proxy, addonsv1alpha1.Cdk8sAppProxyFinalizer) {
+		t.Fatalf("expected the finalizer to be added, got %v %v", proxy.Finalizers, err)
+	}
+
+	// The expired preview is deleted by the generator, its resources by the finalizer.
+	generatorReconciler := &GeneratorReconciler{Client: c, Scheme: scheme, Recorder: events.NewFakeRecorder(10)}
+	if err := generatorReconciler.pruneProxies(ctx, generator, map[string]bool{}); err != nil {
+		t.Fatalf("pruneProxies returned error: %v", err)
+	}
+	if err := c.Get(ctx, key, proxy); err != nil || proxy.DeletionTimestamp.IsZero() {
+		t.Fatalf("expected the Cdk8sAppProxy to wait for its finalizer, got %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := c.Get(ctx, key, proxy); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the Cdk8sAppProxy to be removed after the clean-up, got %v", err)
+	}
+}
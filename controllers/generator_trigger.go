@@ -0,0 +1,193 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// onDemand reports whether the generator only creates previews on request.
+func onDemand(generator *addonsv1alpha1.Cdk8sAppProxyGenerator) bool {
+	return generator.Spec.Trigger != nil && generator.Spec.Trigger.Mode == addonsv1alpha1.PreviewTriggerOnDemand
+}
+
+// forkAllowed reports whether the fork policy of the generator approves the given PR from a fork.
+func forkAllowed(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, pr gitoperator.PullRequest) bool {
+	policy := generator.Spec.Forks
+	if policy == nil || pr.HeadRepoURL == "" {
+		return false
+	}
+
+	switch policy.Mode {
+	case addonsv1alpha1.ForkPolicyRequireLabel:
+		return policy.Label != "" && slices.Contains(pr.Labels, policy.Label)
+	case addonsv1alpha1.ForkPolicyAllowAuthors:
+		return slices.Contains(policy.Authors, pr.Author)
+	case addonsv1alpha1.ForkPolicyDeny:
+		return false
+	default:
+		return false
+	}
+}
+
+// commandStatus returns the recorded command state of the given PR.
+func commandStatus(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, number int) addonsv1alpha1.PreviewCommandStatus {
+	for _, state := range generator.Status.Commands {
+		if state.Number == number {
+			return state
+		}
+	}
+
+	return addonsv1alpha1.PreviewCommandStatus{Number: number}
+}
+
+// keepCommandStatus adds the recorded command state of the open PRs missing from commands, e.g. PRs
+// skipped by the filters or the fork policy in this poll, so their handled commands are not handled
+// again. Only the state of closed PRs is dropped.
+func keepCommandStatus(generator *addonsv1alpha1.Cdk8sAppProxyGenerator, prs []gitoperator.PullRequest, commands []addonsv1alpha1.PreviewCommandStatus) []addonsv1alpha1.PreviewCommandStatus {
+	open := make(map[int]bool, len(prs))
+	for _, pr := range prs {
+		open[pr.Number] = true
+	}
+	for _, state := range commands {
+		delete(open, state.Number)
+	}
+
+	for _, state := range generator.Status.Commands {
+		if open[state.Number] {
+			commands = append(commands, state)
+		}
+	}
+
+	return commands
+}
+
+// previewRequested handles new command comments of the PR, updating state accordingly, and reports
+// whether a preview is requested either by the trigger label or by the latest command.
+func (r *GeneratorReconciler) previewRequested(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, providerClient gitoperator.ProviderClient, secretRef []byte, pr gitoperator.PullRequest, state *addonsv1alpha1.PreviewCommandStatus) (requested bool, err error) {
+	logs := ctrl.LoggerFrom(ctx).WithValues("prNumber", pr.Number)
+	trigger := generator.Spec.Trigger
+	labelled := trigger.Label != "" && slices.Contains(pr.Labels, trigger.Label)
+
+	command := trigger.Command
+	if command == "" {
+		command = defaultPreviewCommand
+	}
+
+	comments, err := providerClient.ListComments(ctx, generator.Spec.Source.URL, secretRef, pr.Number)
+	if err != nil {
+		return labelled || state.Requested, err
+	}
+
+	for _, comment := range comments {
+		if comment.ID <= state.LastCommandID {
+			continue
+		}
+
+		request, ok := parseCommand(comment.Body, command)
+		if !ok {
+			continue
+		}
+
+		if !comment.Maintainer && !slices.Contains(trigger.Maintainers, comment.Author) {
+			logs.Info("Ignoring preview command of non-maintainer", "author", comment.Author, "commentID", comment.ID)
+
+			continue
+		}
+
+		logs.Info("Handling preview command", "author", comment.Author, "commentID", comment.ID, "request", request)
+		state.Requested = request
+		state.LastCommandID = comment.ID
+
+		// Record the command before acknowledging it, so a failing reconcile does not handle and
+		// acknowledge it again.
+		if err = r.saveCommandStatus(ctx, generator, *state); err != nil {
+			return labelled || state.Requested, err
+		}
+
+		if err = acknowledge(ctx, generator, providerClient, secretRef, pr, comment, request); err != nil {
+			logs.Error(err, "failed to acknowledge preview command", "commentID", comment.ID)
+		}
+	}
+
+	return labelled || state.Requested, nil
+}
+
+// saveCommandStatus persists the command state of a PR in the generator status.
+func (r *GeneratorReconciler) saveCommandStatus(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, state addonsv1alpha1.PreviewCommandStatus) error {
+	return r.updateStatus(ctx, generator, func(latest *addonsv1alpha1.Cdk8sAppProxyGenerator) {
+		for i := range latest.Status.Commands {
+			if latest.Status.Commands[i].Number == state.Number {
+				latest.Status.Commands[i] = state
+
+				return
+			}
+		}
+		latest.Status.Commands = append(latest.Status.Commands, state)
+	})
+}
+
+// parseCommand reports whether the first line of body is the given command, and whether it
+// requests (true) or destroys (false) a preview.
+func parseCommand(body string, command string) (request bool, ok bool) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != command {
+		return false, false
+	}
+
+	switch {
+	case len(fields) == 1:
+		return true, true
+	case len(fields) == 2 && fields[1] == "destroy":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// acknowledge lets the commenter know the command was handled, using the configured acknowledgement.
+func acknowledge(ctx context.Context, generator *addonsv1alpha1.Cdk8sAppProxyGenerator, providerClient gitoperator.ProviderClient, secretRef []byte, pr gitoperator.PullRequest, comment gitoperator.Comment, request bool) (err error) {
+	repoURL := generator.Spec.Source.URL
+
+	switch generator.Spec.Trigger.Acknowledge {
+	case addonsv1alpha1.CommandAcknowledgementNone:
+		return nil
+	case addonsv1alpha1.CommandAcknowledgementComment:
+	default:
+		err = providerClient.AddReaction(ctx, repoURL, secretRef, pr.Number, comment.ID)
+		if !errors.Is(err, gitoperator.ErrReactionsUnsupported) {
+			return err
+		}
+	}
+
+	proxyName := generatedProxyName(generator, pr.Number)
+	body := fmt.Sprintf("Preview requested by @%s, deploying %s.", comment.Author, proxyName)
+	if !request {
+		body = fmt.Sprintf("Preview removal requested by @%s, deleting %s.", comment.Author, proxyName)
+	}
+
+	return providerClient.CreateComment(ctx, repoURL, secretRef, pr.Number, body)
+}
@@ -6,6 +6,7 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -45,11 +46,54 @@ const (
 )
 
 type PullRequest struct {
-	ID         int    `json:"id"`
-	Number     int    `json:"number"`
-	Branch     string `json:"branch"`
-	HeadSHA    string `json:"head_sha"`
-	BaseBranch string `json:"base_branch"`
+	ID         int      `json:"id"`
+	Number     int      `json:"number"`
+	Branch     string   `json:"branch"`
+	HeadSHA    string   `json:"head_sha"`
+	BaseBranch string   `json:"base_branch"`
+	Author     string   `json:"author"`
+	Labels     []string `json:"labels"`
+	// Fork is true if the head branch lives in a different repository than the base branch.
+	Fork bool `json:"fork"`
+	// HeadRepoURL is the clone URL of the repository holding the head branch. It is empty if
+	// the head repository is not known (e.g. a deleted fork).
+	HeadRepoURL string `json:"head_repo_url"`
+	// MergeRef is the reference of the provider's merge result in the base repository. It is
+	// empty if the provider does not publish merge results.
+	MergeRef string `json:"merge_ref"`
+}
+
+// Ref is a branch or tag of a remote repository.
+type Ref struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// Comment is a comment on a pull request.
+type Comment struct {
+	ID     int64  `json:"id"`
+	Author string `json:"author"`
+	Body   string `json:"body"`
+	// Maintainer is true if the provider reports the author as owner, member or collaborator of the repository.
+	Maintainer bool `json:"maintainer"`
+}
+
+// CommitState is the state of a commit status.
+type CommitState string
+
+const (
+	// CommitStatePending marks work on the commit as pending, e.g. a queued preview.
+	CommitStatePending CommitState = "pending"
+	// CommitStateSuccess marks work on the commit as done.
+	CommitStateSuccess CommitState = "success"
+)
+
+// CommitStatus is a status reported on a commit and shown on the pull requests containing it.
+type CommitStatus struct {
+	State CommitState `json:"state"`
+	// Context identifies the status. A later status with the same context replaces it.
+	Context     string `json:"context"`
+	Description string `json:"description"`
 }
 
 // Client implements the ProviderClient interface for various Git providers.
@@ -62,7 +106,7 @@ type Client struct {
 
 // Operator defines the interface for git operations.
 type Operator interface {
-	Clone(repoURL string, secretRef []byte, branch string, directory string, logger logr.Logger) (err error)
+	Clone(repoURL string, secretRef []byte, reference string, commit string, directory string, logger logr.Logger) (err error)
 	Poll(repoURL string, secretRef []byte, branch string, directory string, logger logr.Logger) (changes bool, err error)
 	Hash(repoURL string, secretRef []byte, branch string, logger logr.Logger) (hash string, err error)
 	CheckAccess(repoURL string, secretRef []byte, logger logr.Logger) (accessible bool, requiresAuth bool, err error)
@@ -71,6 +115,10 @@ type Operator interface {
 
 type ProviderClient interface {
 	ListPullRequests(ctx context.Context, repoURL string, secretRef []byte) (prs []PullRequest, err error)
+	ListComments(ctx context.Context, repoURL string, secretRef []byte, number int) (comments []Comment, err error)
+	AddReaction(ctx context.Context, repoURL string, secretRef []byte, number int, commentID int64) (err error)
+	CreateComment(ctx context.Context, repoURL string, secretRef []byte, number int, body string) (err error)
+	SetCommitStatus(ctx context.Context, repoURL string, secretRef []byte, sha string, status CommitStatus) (err error)
 }
 
 // Implementer implements the GitOperator interface.
@@ -81,11 +129,13 @@ type Implementer struct {
 	KnownHosts []byte
 }
 
-// Clone clones the given repository to a local directory.
-func (g *Implementer) Clone(repoURL string, secretRef []byte, branch string, directory string, logger logr.Logger) (err error) {
+// Clone clones the given repository to a local directory. The reference is either a branch name
+// or a full reference name (e.g. refs/pull/42/merge). If commit is set, the checkout is pinned to
+// that commit instead of the tip of the reference.
+func (g *Implementer) Clone(repoURL string, secretRef []byte, reference string, commit string, directory string, logger logr.Logger) (err error) {
 	var auth transport.AuthMethod
 
-	logger.Info("Starting to clone git repository", "repoURL", repoURL, "branch", branch, "directory", directory)
+	logger.Info("Starting to clone git repository", "repoURL", repoURL, "reference", reference, "commit", commit, "directory", directory)
 
 	err = os.MkdirAll(directory, 0755)
 	if err != nil {
@@ -103,12 +153,16 @@ func (g *Implementer) Clone(repoURL string, secretRef []byte, branch string, dir
 		}
 	}
 
-	_, err = git.PlainClone(directory, false, &git.CloneOptions{
-		URL:           repoURL,
-		Auth:          auth,
-		ReferenceName: plumbing.NewBranchReferenceName(branch),
-		Depth:         1,
-	})
+	if commit != "" || strings.HasPrefix(reference, "refs/") {
+		err = fetchCheckout(repoURL, auth, referenceName(reference), commit, directory, logger)
+	} else {
+		_, err = git.PlainClone(directory, false, &git.CloneOptions{
+			URL:           repoURL,
+			Auth:          auth,
+			ReferenceName: plumbing.NewBranchReferenceName(reference),
+			Depth:         1,
+		})
+	}
 	if err != nil {
 		logger.Error(err, "Failed to clone git repository", "repoURL", repoURL, "directory", directory)
 
@@ -119,6 +173,74 @@ func (g *Implementer) Clone(repoURL string, secretRef []byte, branch string, dir
 	return err
 }
 
+// fetchCheckout initializes a repository in directory, fetches the given reference or commit and
+// checks it out. A commit is fetched directly if the server allows it, otherwise the full history
+// of the reference is fetched and the commit has to be part of it.
+func fetchCheckout(repoURL string, auth transport.AuthMethod, refName plumbing.ReferenceName, commit string, directory string, logger logr.Logger) (err error) {
+	repo, err := git.PlainInit(directory, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err = repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoURL}}); err != nil {
+		return err
+	}
+
+	checkoutRef := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "checkout")
+	fetch := func(src string, depth int) error {
+		err := repo.Fetch(&git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", src, checkoutRef))},
+			Depth:      depth,
+			Auth:       auth,
+		})
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
+		}
+
+		return err
+	}
+
+	if commit == "" {
+		err = fetch(refName.String(), 1)
+	} else if err = fetch(commit, 1); err != nil {
+		logger.Info("Fetching the commit directly failed, fetching the reference instead", "commit", commit, "reference", refName, "reason", err.Error())
+		err = fetch(refName.String(), 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	hash := plumbing.NewHash(commit)
+	if commit == "" {
+		ref, err := repo.Reference(checkoutRef, true)
+		if err != nil {
+			return err
+		}
+		hash = ref.Hash()
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if err = worktree.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+		return fmt.Errorf("failed to check out commit %s of %s: %w", hash, refName, err)
+	}
+
+	return nil
+}
+
+// referenceName returns the full reference name for a branch name or full reference name.
+func referenceName(reference string) plumbing.ReferenceName {
+	if strings.HasPrefix(reference, "refs/") {
+		return plumbing.ReferenceName(reference)
+	}
+
+	return plumbing.NewBranchReferenceName(reference)
+}
+
 // Poll polls for changes for the given remote git repository. Returns true, if current local commit hash and remote hash are not equal.
 func (g *Implementer) Poll(repoURL string, secretRef []byte, branch string, directory string, logger logr.Logger) (changes bool, err error) {
 	// Defaults to false. We only change to true if there is a difference between the hashes.
@@ -364,34 +486,79 @@ func (g *Implementer) localHash(path string, logger logr.Logger) (hash string, e
 }
 
 func (g *Implementer) remoteHash(repoURL string, secretRef []byte, branch string, logger logr.Logger) (hash string, err error) {
-	auth, err := getAuth(repoURL, secretRef, g.KnownHosts, logger)
+	refs, err := g.listRemote(repoURL, secretRef, logger)
 	if err != nil {
 		return hash, err
 	}
 
+	refName := referenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == refName {
+			hash = ref.Hash().String()
+
+			return hash, err
+		}
+	}
+
+	return hash, err
+}
+
+// ListRefs lists the remote references below prefix (e.g. refs/heads/ or refs/tags/). Names are
+// returned without the prefix and annotated tags are resolved to the commit they point to.
+func (g *Implementer) ListRefs(repoURL string, secretRef []byte, prefix string, logger logr.Logger) (refs []Ref, err error) {
+	remoteRefs, err := g.listRemote(repoURL, secretRef, logger)
+	if err != nil {
+		return refs, err
+	}
+
+	peeled := make(map[string]string)
+	for _, ref := range remoteRefs {
+		if name, ok := strings.CutSuffix(ref.Name().String(), "^{}"); ok {
+			peeled[name] = ref.Hash().String()
+		}
+	}
+
+	for _, ref := range remoteRefs {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference || strings.HasSuffix(name, "^{}") || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		hash := ref.Hash().String()
+		if commit, ok := peeled[name]; ok {
+			hash = commit
+		}
+		refs = append(refs, Ref{Name: strings.TrimPrefix(name, prefix), Hash: hash})
+	}
+
+	return refs, err
+}
+
+// listRemote lists the references of the remote repository, authenticating if a secret is given.
+func (g *Implementer) listRemote(repoURL string, secretRef []byte, logger logr.Logger) (refs []*plumbing.Reference, err error) {
+	var auth transport.AuthMethod
+	if len(secretRef) > 0 {
+		auth, err = getAuth(repoURL, secretRef, g.KnownHosts, logger)
+		if err != nil {
+			return refs, err
+		}
+	}
+
 	remoteRepo := git.NewRemote(nil, &config.RemoteConfig{
 		URLs: []string{repoURL},
 	})
 
-	refs, err := remoteRepo.List(&git.ListOptions{
-		Auth: auth,
+	refs, err = remoteRepo.List(&git.ListOptions{
+		Auth:          auth,
+		PeelingOption: git.AppendPeeled,
 	})
 	if err != nil {
 		logger.Error(err, "Failed to list remote repo")
 
-		return hash, err
+		return refs, err
 	}
 
-	refName := plumbing.NewBranchReferenceName(branch)
-	for _, ref := range refs {
-		if ref.Name() == refName {
-			hash = ref.Hash().String()
-
-			return hash, err
-		}
-	}
-
-	return hash, err
+	return refs, err
 }
 
 // isURL checks if the given string is a valid URL.
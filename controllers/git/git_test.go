@@ -6,10 +6,14 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/go-logr/logr"
@@ -394,3 +398,137 @@ func TestParseURL(t *testing.T) {
 		}
 	})
 }
+
+// newTestRepository creates a local repository with one commit per message on the main branch
+// and returns its path and the commit hashes in order.
+func newTestRepository(t *testing.T, messages ...string) (string, []string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := gogit.PlainInitWithOptions(dir, &gogit.PlainInitOptions{
+		InitOptions: gogit.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	hashes := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if err = os.WriteFile(filepath.Join(dir, "file"), []byte(message), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err = worktree.Add("file"); err != nil {
+			t.Fatalf("failed to add file: %v", err)
+		}
+		hash, err := worktree.Commit(message, &gogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		hashes = append(hashes, hash.String())
+	}
+
+	return dir, hashes
+}
+
+func TestClonePinned(t *testing.T) {
+	source, hashes := newTestRepository(t, "first", "second")
+	g := &Implementer{}
+	logger := logr.Discard()
+
+	readFile := func(t *testing.T, dir string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, "file"))
+		if err != nil {
+			t.Fatalf("failed to read cloned file: %v", err)
+		}
+
+		return string(content)
+	}
+
+	t.Run("branch tip", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		if err := g.Clone(source, nil, "main", "", dir, logger); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := readFile(t, dir); got != "second" {
+			t.Errorf("expected tip of main, got %q", got)
+		}
+	})
+
+	t.Run("full reference name", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		if err := g.Clone(source, nil, "refs/heads/main", "", dir, logger); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := readFile(t, dir); got != "second" {
+			t.Errorf("expected tip of refs/heads/main, got %q", got)
+		}
+	})
+
+	t.Run("pinned commit", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		if err := g.Clone(source, nil, "main", hashes[0], dir, logger); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := readFile(t, dir); got != "first" {
+			t.Errorf("expected pinned commit, got %q", got)
+		}
+	})
+
+	t.Run("unknown commit", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		if err := g.Clone(source, nil, "main", strings.Repeat("a", 40), dir, logger); err == nil {
+			t.Errorf("expected an error for a commit that is not part of the reference")
+		}
+	})
+}
+
+func TestListRefs(t *testing.T) {
+	source, hashes := newTestRepository(t, "first", "second")
+	repo, err := gogit.PlainOpen(source)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	first := plumbing.NewHash(hashes[0])
+	if err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release/1.0"), first)); err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+	if _, err = repo.CreateTag("v1.0.0", first, &gogit.CreateTagOptions{
+		Message: "release",
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to create annotated tag: %v", err)
+	}
+
+	g := &Implementer{}
+	toMap := func(refs []Ref) map[string]string {
+		result := make(map[string]string, len(refs))
+		for _, ref := range refs {
+			result[ref.Name] = ref.Hash
+		}
+
+		return result
+	}
+
+	branches, err := g.ListRefs(source, nil, "refs/heads/", logr.Discard())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := toMap(branches); len(got) != 2 || got["main"] != hashes[1] || got["release/1.0"] != hashes[0] {
+		t.Errorf("unexpected branches: %v", got)
+	}
+
+	tags, err := g.ListRefs(source, nil, "refs/tags/", logr.Discard())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := toMap(tags); len(got) != 1 || got["v1.0.0"] != hashes[0] {
+		t.Errorf("expected annotated tag resolved to its commit, got %v", got)
+	}
+}
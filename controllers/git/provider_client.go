@@ -17,83 +17,315 @@ limitations under the License.
 package git
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
+// maxPages bounds the number of pages fetched from a paginated API listing.
+const maxPages = 50
+
+// ErrReactionsUnsupported is returned by AddReaction for providers without comment reactions.
+var ErrReactionsUnsupported = errors.New("provider does not support comment reactions")
+
 // ListPullRequests lists open pull requests for the repository.
 func (c *Client) ListPullRequests(ctx context.Context, repoURL string, secretRef []byte) (prs []PullRequest, err error) {
-	owner, repo, err := parseRepoURL(repoURL, c.host, c.allowNested)
+	baseURL, headers, err := c.apiEndpoint(repoURL, secretRef)
 	if err != nil {
 		return nil, err
 	}
 
-	var apiURL string
-	headers := make(map[string]string)
+	useSSH := getURLType(repoURL) == authTypeSSH
+
+	switch c.provider {
+	case ProviderGitHub:
+		prs, err = c.fetchGitHubPRs(ctx, baseURL+"/pulls?state=open", headers, useSSH)
+	case ProviderGitLab:
+		prs, err = c.fetchGitLabMRs(ctx, baseURL+"/merge_requests?state=opened", headers, useSSH)
+	case ProviderBitbucket:
+		prs, err = c.fetchBitbucketPRs(ctx, baseURL+"/pullrequests?state=OPEN", headers, useSSH)
+	default:
+		return nil, fmt.Errorf("unsupported Git provider: %s", c.provider)
+	}
+
+	// Branches of the repository itself are cloned from the configured URL, keeping its scheme and credentials.
+	for i := range prs {
+		if !prs[i].Fork {
+			prs[i].HeadRepoURL = repoURL
+		}
+	}
+
+	return prs, err
+}
+
+// ListComments lists the comments of the given pull request, oldest first.
+func (c *Client) ListComments(ctx context.Context, repoURL string, secretRef []byte, number int) (comments []Comment, err error) {
+	baseURL, headers, err := c.apiEndpoint(repoURL, secretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.provider {
+	case ProviderGitHub:
+		return c.fetchGitHubComments(ctx, fmt.Sprintf("%s/issues/%d/comments?per_page=100", baseURL, number), headers)
+	case ProviderGitLab:
+		return c.fetchGitLabNotes(ctx, fmt.Sprintf("%s/merge_requests/%d/notes?sort=asc&per_page=100", baseURL, number), headers)
+	case ProviderBitbucket:
+		return c.fetchBitbucketComments(ctx, fmt.Sprintf("%s/pullrequests/%d/comments?pagelen=100", baseURL, number), headers)
+	default:
+		return nil, fmt.Errorf("unsupported Git provider: %s", c.provider)
+	}
+}
+
+// AddReaction adds an approving reaction to the given pull request comment.
+// It returns ErrReactionsUnsupported for providers without comment reactions.
+func (c *Client) AddReaction(ctx context.Context, repoURL string, secretRef []byte, number int, commentID int64) (err error) {
+	baseURL, headers, err := c.apiEndpoint(repoURL, secretRef)
+	if err != nil {
+		return err
+	}
 
 	switch c.provider {
 	case ProviderGitHub:
-		apiURL = fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls?state=open", owner, repo)
+		apiURL := fmt.Sprintf("%s/issues/comments/%d/reactions", baseURL, commentID)
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, map[string]string{"content": "+1"}, nil)
+	case ProviderGitLab:
+		apiURL := fmt.Sprintf("%s/merge_requests/%d/notes/%d/award_emoji", baseURL, number, commentID)
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, map[string]string{"name": "thumbsup"}, nil)
+	case ProviderBitbucket:
+		return ErrReactionsUnsupported
+	default:
+		return fmt.Errorf("unsupported Git provider: %s", c.provider)
+	}
+}
+
+// CreateComment adds a comment to the given pull request.
+func (c *Client) CreateComment(ctx context.Context, repoURL string, secretRef []byte, number int, body string) (err error) {
+	baseURL, headers, err := c.apiEndpoint(repoURL, secretRef)
+	if err != nil {
+		return err
+	}
+
+	switch c.provider {
+	case ProviderGitHub:
+		apiURL := fmt.Sprintf("%s/issues/%d/comments", baseURL, number)
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, map[string]string{"body": body}, nil)
+	case ProviderGitLab:
+		apiURL := fmt.Sprintf("%s/merge_requests/%d/notes", baseURL, number)
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, map[string]string{"body": body}, nil)
+	case ProviderBitbucket:
+		apiURL := fmt.Sprintf("%s/pullrequests/%d/comments", baseURL, number)
+		payload := map[string]any{"content": map[string]string{"raw": body}}
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, payload, nil)
+	default:
+		return fmt.Errorf("unsupported Git provider: %s", c.provider)
+	}
+}
+
+// SetCommitStatus reports the status on the given commit.
+func (c *Client) SetCommitStatus(ctx context.Context, repoURL string, secretRef []byte, sha string, status CommitStatus) (err error) {
+	baseURL, headers, err := c.apiEndpoint(repoURL, secretRef)
+	if err != nil {
+		return err
+	}
+
+	switch c.provider {
+	case ProviderGitHub:
+		apiURL := fmt.Sprintf("%s/statuses/%s", baseURL, sha)
+		payload := map[string]string{"state": string(status.State), "context": status.Context, "description": status.Description}
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, payload, nil)
+	case ProviderGitLab:
+		apiURL := fmt.Sprintf("%s/statuses/%s", baseURL, sha)
+		payload := map[string]string{"state": string(status.State), "name": status.Context, "description": status.Description}
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, payload, nil)
+	case ProviderBitbucket:
+		state := "INPROGRESS"
+		if status.State == CommitStateSuccess {
+			state = "SUCCESSFUL"
+		}
+		owner, repo, err := parseRepoURL(repoURL, c.host, c.allowNested)
+		if err != nil {
+			return err
+		}
+		apiURL := fmt.Sprintf("%s/commit/%s/statuses/build", baseURL, sha)
+		// Bitbucket requires a link for every build status; point it at the repository.
+		webURL := fmt.Sprintf("https://%s/%s/%s", c.host, owner, repo)
+		payload := map[string]string{"state": state, "key": status.Context, "name": status.Context, "description": status.Description, "url": webURL}
+
+		return c.doRequest(ctx, http.MethodPost, apiURL, headers, payload, nil)
+	default:
+		return fmt.Errorf("unsupported Git provider: %s", c.provider)
+	}
+}
+
+// apiEndpoint returns the REST API URL of the repository and the headers needed to authenticate against it.
+func (c *Client) apiEndpoint(repoURL string, secretRef []byte) (baseURL string, headers map[string]string, err error) {
+	owner, repo, err := parseRepoURL(repoURL, c.host, c.allowNested)
+	if err != nil {
+		return "", nil, err
+	}
+
+	headers = make(map[string]string)
+
+	switch c.provider {
+	case ProviderGitHub:
+		baseURL = fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
 		headers["Accept"] = "application/vnd.github.v3+json"
 		if len(secretRef) > 0 {
 			headers["Authorization"] = fmt.Sprintf("token %s", string(secretRef))
 		}
-
-		return c.fetchGitHubPRs(ctx, apiURL, headers)
-
 	case ProviderGitLab:
 		projectID := urlPathEscape(fmt.Sprintf("%s/%s", owner, repo))
-		apiURL = fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/merge_requests?state=opened", projectID)
+		baseURL = fmt.Sprintf("https://gitlab.com/api/v4/projects/%s", projectID)
 		if len(secretRef) > 0 {
 			headers["Private-Token"] = string(secretRef)
 		}
-
-		return c.fetchGitLabMRs(ctx, apiURL, headers)
-
 	case ProviderBitbucket:
-		apiURL = fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/pullrequests?state=OPEN", owner, repo)
+		baseURL = fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s", owner, repo)
 		if len(secretRef) > 0 {
 			headers["Authorization"] = fmt.Sprintf("Bearer %s", string(secretRef))
 		}
-
-		return c.fetchBitbucketPRs(ctx, apiURL, headers)
-
 	default:
-		return nil, fmt.Errorf("unsupported Git provider: %s", c.provider)
+		return "", nil, fmt.Errorf("unsupported Git provider: %s", c.provider)
 	}
+
+	return baseURL, headers, nil
 }
 
 func (c *Client) doJSONRequest(ctx context.Context, apiURL string, headers map[string]string, target any) (err error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	return c.doRequest(ctx, http.MethodGet, apiURL, headers, nil, target)
+}
+
+// doRequest sends payload (if any) as JSON and decodes the response into target (if any).
+func (c *Client) doRequest(ctx context.Context, method string, apiURL string, headers map[string]string, payload any, target any) (err error) {
+	resp, err := c.send(ctx, method, apiURL, headers, payload)
 	if err != nil {
-		fmt.Println("replace me")
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if target == nil {
+		return nil
+	}
 
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// doPagedRequest fetches every page of a listing, starting at apiURL. decode is called with the body
+// of each page and returns the URL of the next page if the provider paginates in the body; otherwise
+// the next link of the Link header is followed. Only links to the host of apiURL are followed, so the
+// credentials in headers are never sent elsewhere.
+func (c *Client) doPagedRequest(ctx context.Context, apiURL string, headers map[string]string, decode func(body io.Reader) (next string, err error)) (err error) {
+	first, err := url.Parse(apiURL)
+	if err != nil {
 		return err
 	}
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	for page := 0; apiURL != ""; page++ {
+		if page == maxPages {
+			return fmt.Errorf("listing has more than %d pages", maxPages)
+		}
+
+		resp, err := c.send(ctx, http.MethodGet, apiURL, headers, nil)
+		if err != nil {
+			return err
+		}
+		next, err := decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if next == "" {
+			next = nextLink(resp.Header.Get("Link"))
+		}
+
+		apiURL = next
+		if next == "" {
+			continue
+		}
+		nextURL, err := url.Parse(next)
+		if err != nil {
+			return fmt.Errorf("invalid next page link %q: %w", next, err)
+		}
+		if nextURL.Scheme != first.Scheme || nextURL.Host != first.Host {
+			return fmt.Errorf("next page link %q leaves %s", next, first.Host)
+		}
+	}
+
+	return nil
+}
+
+// nextLink returns the URL of the rel="next" link of a Link header, as used by GitHub and GitLab.
+func nextLink(header string) string {
+	for link := range strings.SplitSeq(header, ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+		for param := range strings.SplitSeq(params, ";") {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+// send sends payload (if any) as JSON and returns the response if it succeeded.
+// The caller must close the response body.
+func (c *Client) send(ctx context.Context, method string, apiURL string, headers map[string]string, payload any) (resp *http.Response, err error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
 	}
 
-	resp, err := c.getHTTPClient().Do(req)
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	resp, err = c.getHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp, nil
 }
 
 // httpClientContainer provides common HTTP client access.
@@ -109,15 +341,29 @@ func (h *httpClientContainer) getHTTPClient() *http.Client {
 	return h.httpClient
 }
 
-func (c *Client) fetchGitHubPRs(ctx context.Context, apiURL string, headers map[string]string) (prs []PullRequest, err error) {
+func (c *Client) fetchGitHubPRs(ctx context.Context, apiURL string, headers map[string]string, useSSH bool) (prs []PullRequest, err error) {
 	var ghPRs []struct {
 		Number int `json:"number"`
-		Head   struct {
-			Ref string `json:"ref"`
-			SHA string `json:"sha"`
+		User   struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+		Head struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo *struct {
+				FullName string `json:"full_name"`
+				CloneURL string `json:"clone_url"`
+				SSHURL   string `json:"ssh_url"`
+			} `json:"repo"`
 		} `json:"head"`
 		Base struct {
-			Ref string `json:"ref"`
+			Ref  string `json:"ref"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
 		} `json:"base"`
 	}
 
@@ -127,23 +373,44 @@ func (c *Client) fetchGitHubPRs(ctx context.Context, apiURL string, headers map[
 
 	prs = make([]PullRequest, len(ghPRs))
 	for i, ghPR := range ghPRs {
+		labels := make([]string, 0, len(ghPR.Labels))
+		for _, label := range ghPR.Labels {
+			labels = append(labels, label.Name)
+		}
 		prs[i] = PullRequest{
 			Number:     ghPR.Number,
 			Branch:     ghPR.Head.Ref,
 			HeadSHA:    ghPR.Head.SHA,
 			BaseBranch: ghPR.Base.Ref,
+			Author:     ghPR.User.Login,
+			Labels:     labels,
+			MergeRef:   fmt.Sprintf("refs/pull/%d/merge", ghPR.Number),
+			// The head repository is null if the fork has been deleted.
+			Fork: ghPR.Head.Repo == nil || ghPR.Head.Repo.FullName != ghPR.Base.Repo.FullName,
+		}
+		if prs[i].Fork && ghPR.Head.Repo != nil {
+			prs[i].HeadRepoURL = ghPR.Head.Repo.CloneURL
+			if useSSH {
+				prs[i].HeadRepoURL = ghPR.Head.Repo.SSHURL
+			}
 		}
 	}
 
 	return prs, err
 }
 
-func (c *Client) fetchGitLabMRs(ctx context.Context, apiURL string, headers map[string]string) ([]PullRequest, error) {
+func (c *Client) fetchGitLabMRs(ctx context.Context, apiURL string, headers map[string]string, useSSH bool) ([]PullRequest, error) {
 	var glMRs []struct {
-		IID          int    `json:"iid"`
-		SourceBranch string `json:"source_branch"`
-		TargetBranch string `json:"target_branch"`
-		SHA          string `json:"sha"`
+		IID          int      `json:"iid"`
+		SourceBranch string   `json:"source_branch"`
+		TargetBranch string   `json:"target_branch"`
+		SHA          string   `json:"sha"`
+		Labels       []string `json:"labels"`
+		Author       struct {
+			Username string `json:"username"`
+		} `json:"author"`
+		SourceProjectID int `json:"source_project_id"`
+		TargetProjectID int `json:"target_project_id"`
 	}
 
 	if err := c.doJSONRequest(ctx, apiURL, headers, &glMRs); err != nil {
@@ -157,16 +424,40 @@ func (c *Client) fetchGitLabMRs(ctx context.Context, apiURL string, headers map[
 			Branch:     glMR.SourceBranch,
 			HeadSHA:    glMR.SHA,
 			BaseBranch: glMR.TargetBranch,
+			Author:     glMR.Author.Username,
+			Labels:     glMR.Labels,
+			MergeRef:   fmt.Sprintf("refs/merge-requests/%d/merge", glMR.IID),
+			Fork:       glMR.SourceProjectID != glMR.TargetProjectID,
+		}
+		if !prs[i].Fork {
+			continue
+		}
+
+		// Merge requests only reference the source project by ID, so look up its clone URLs.
+		var project struct {
+			HTTPURLToRepo string `json:"http_url_to_repo"`
+			SSHURLToRepo  string `json:"ssh_url_to_repo"`
+		}
+		projectURL := fmt.Sprintf("https://gitlab.com/api/v4/projects/%d", glMR.SourceProjectID)
+		if err := c.doJSONRequest(ctx, projectURL, headers, &project); err != nil {
+			return nil, fmt.Errorf("gitlab api request failed: %w", err)
+		}
+		prs[i].HeadRepoURL = project.HTTPURLToRepo
+		if useSSH {
+			prs[i].HeadRepoURL = project.SSHURLToRepo
 		}
 	}
 
 	return prs, nil
 }
 
-func (c *Client) fetchBitbucketPRs(ctx context.Context, apiURL string, headers map[string]string) ([]PullRequest, error) {
+func (c *Client) fetchBitbucketPRs(ctx context.Context, apiURL string, headers map[string]string, useSSH bool) ([]PullRequest, error) {
 	var bbPRs struct {
 		Values []struct {
 			ID     int `json:"id"`
+			Author struct {
+				Nickname string `json:"nickname"`
+			} `json:"author"`
 			Source struct {
 				Branch struct {
 					Name string `json:"name"`
@@ -174,11 +465,17 @@ func (c *Client) fetchBitbucketPRs(ctx context.Context, apiURL string, headers m
 				Commit struct {
 					Hash string `json:"hash"`
 				} `json:"commit"`
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
 			} `json:"source"`
 			Destination struct {
 				Branch struct {
 					Name string `json:"name"`
 				} `json:"branch"`
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
 			} `json:"destination"`
 		} `json:"values"`
 	}
@@ -194,12 +491,128 @@ func (c *Client) fetchBitbucketPRs(ctx context.Context, apiURL string, headers m
 			Branch:     bbPR.Source.Branch.Name,
 			HeadSHA:    bbPR.Source.Commit.Hash,
 			BaseBranch: bbPR.Destination.Branch.Name,
+			Author:     bbPR.Author.Nickname,
+			Fork:       bbPR.Source.Repository.FullName != bbPR.Destination.Repository.FullName,
+		}
+		if prs[i].Fork && bbPR.Source.Repository.FullName != "" {
+			prs[i].HeadRepoURL = fmt.Sprintf("https://bitbucket.org/%s.git", bbPR.Source.Repository.FullName)
+			if useSSH {
+				prs[i].HeadRepoURL = fmt.Sprintf("git@bitbucket.org:%s.git", bbPR.Source.Repository.FullName)
+			}
 		}
 	}
 
 	return prs, nil
 }
 
+// maintainerAssociations are the GitHub author associations trusted to issue commands.
+var maintainerAssociations = map[string]bool{"OWNER": true, "MEMBER": true, "COLLABORATOR": true}
+
+func (c *Client) fetchGitHubComments(ctx context.Context, apiURL string, headers map[string]string) ([]Comment, error) {
+	var comments []Comment
+	err := c.doPagedRequest(ctx, apiURL, headers, func(body io.Reader) (string, error) {
+		var ghComments []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			AuthorAssociation string `json:"author_association"`
+		}
+		if err := json.NewDecoder(body).Decode(&ghComments); err != nil {
+			return "", err
+		}
+
+		for _, ghComment := range ghComments {
+			comments = append(comments, Comment{
+				ID:         ghComment.ID,
+				Author:     ghComment.User.Login,
+				Body:       ghComment.Body,
+				Maintainer: maintainerAssociations[ghComment.AuthorAssociation],
+			})
+		}
+
+		return "", nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("github api request failed: %w", err)
+	}
+
+	return comments, nil
+}
+
+func (c *Client) fetchGitLabNotes(ctx context.Context, apiURL string, headers map[string]string) ([]Comment, error) {
+	var comments []Comment
+	err := c.doPagedRequest(ctx, apiURL, headers, func(body io.Reader) (string, error) {
+		var glNotes []struct {
+			ID     int64  `json:"id"`
+			Body   string `json:"body"`
+			System bool   `json:"system"`
+			Author struct {
+				Username string `json:"username"`
+			} `json:"author"`
+		}
+		if err := json.NewDecoder(body).Decode(&glNotes); err != nil {
+			return "", err
+		}
+
+		for _, glNote := range glNotes {
+			// System notes record events such as pushes and label changes, not user comments.
+			if glNote.System {
+				continue
+			}
+			comments = append(comments, Comment{
+				ID:     glNote.ID,
+				Author: glNote.Author.Username,
+				Body:   glNote.Body,
+			})
+		}
+
+		return "", nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gitlab api request failed: %w", err)
+	}
+
+	return comments, nil
+}
+
+func (c *Client) fetchBitbucketComments(ctx context.Context, apiURL string, headers map[string]string) ([]Comment, error) {
+	var comments []Comment
+	err := c.doPagedRequest(ctx, apiURL, headers, func(body io.Reader) (string, error) {
+		var bbComments struct {
+			Values []struct {
+				ID      int64 `json:"id"`
+				Content struct {
+					Raw string `json:"raw"`
+				} `json:"content"`
+				User struct {
+					Nickname string `json:"nickname"`
+				} `json:"user"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := json.NewDecoder(body).Decode(&bbComments); err != nil {
+			return "", err
+		}
+
+		for _, bbComment := range bbComments.Values {
+			comments = append(comments, Comment{
+				ID:     bbComment.ID,
+				Author: bbComment.User.Nickname,
+				Body:   bbComment.Content.Raw,
+			})
+		}
+
+		return bbComments.Next, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket api request failed: %w", err)
+	}
+
+	return comments, nil
+}
+
 // NewProviderClient returns the appropriate ProviderClient for the given repoURL.
 func NewProviderClient(repoURL string, httpClient *http.Client) (client ProviderClient, err error) {
 	provider := detectProvider(repoURL)
@@ -239,4 +652,3 @@ func detectProvider(repoURL string) (provider providerType) {
 
 	return provider
 }
-
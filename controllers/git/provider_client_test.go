@@ -0,0 +1,255 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// rewriteTransport sends every request to the test server, keeping the original path and query,
+// so the provider clients can be exercised against their hardcoded API hosts.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestProviderClient(t *testing.T, repoURL string, handler http.Handler) ProviderClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	client, err := NewProviderClient(repoURL, &http.Client{Transport: rewriteTransport{target: target}})
+	if err != nil {
+		t.Fatalf("failed to create provider client: %v", err)
+	}
+
+	return client
+}
+
+func TestListPullRequestsGitHub(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token secret" {
+			t.Errorf("expected token authorization, got %q", got)
+		}
+		_, _ = w.Write([]byte(`[{"number":42,"user":{"login":"octocat"},"labels":[{"name":"preview"}],
+			"head":{"ref":"feature","sha":"abc","repo":{"full_name":"owner/repo"}},"base":{"ref":"main","repo":{"full_name":"owner/repo"}}},
+			{"number":43,"user":{"login":"stranger"},
+			"head":{"ref":"main","sha":"def","repo":{"full_name":"stranger/repo","clone_url":"https://github.com/stranger/repo.git","ssh_url":"git@github.com:stranger/repo.git"}},
+			"base":{"ref":"main","repo":{"full_name":"owner/repo"}}},
+			{"number":44,"user":{"login":"gone"},"head":{"ref":"main","sha":"123","repo":null},"base":{"ref":"main","repo":{"full_name":"owner/repo"}}}]`))
+	})
+	client := newTestProviderClient(t, "https://github.com/owner/repo", mux)
+
+	prs, err := client.ListPullRequests(context.Background(), "https://github.com/owner/repo", []byte("secret"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(prs) != 3 {
+		t.Fatalf("expected 3 pull requests, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Number != 42 || pr.Branch != "feature" || pr.HeadSHA != "abc" || pr.BaseBranch != "main" || pr.Author != "octocat" {
+		t.Errorf("unexpected pull request: %+v", pr)
+	}
+	if len(pr.Labels) != 1 || pr.Labels[0] != "preview" {
+		t.Errorf("expected label preview, got %v", pr.Labels)
+	}
+	if pr.Fork || pr.HeadRepoURL != "https://github.com/owner/repo" {
+		t.Errorf("expected branch of the source repository, got fork=%v url=%q", pr.Fork, pr.HeadRepoURL)
+	}
+
+	fork := prs[1]
+	if !fork.Fork || fork.HeadRepoURL != "https://github.com/stranger/repo.git" {
+		t.Errorf("expected fork cloned from its own repository, got fork=%v url=%q", fork.Fork, fork.HeadRepoURL)
+	}
+
+	deleted := prs[2]
+	if !deleted.Fork || deleted.HeadRepoURL != "" {
+		t.Errorf("expected deleted fork without clone URL, got fork=%v url=%q", deleted.Fork, deleted.HeadRepoURL)
+	}
+}
+
+func TestListPullRequestsGitLabFork(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/owner%2Frepo/merge_requests", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"iid":5,"source_branch":"fix","target_branch":"main","sha":"abc","source_project_id":2,"target_project_id":1}]`))
+	})
+	mux.HandleFunc("GET /api/v4/projects/2", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"http_url_to_repo":"https://gitlab.com/fork/repo.git","ssh_url_to_repo":"git@gitlab.com:fork/repo.git"}`))
+	})
+	client := newTestProviderClient(t, "git@gitlab.com:owner/repo.git", mux)
+
+	prs, err := client.ListPullRequests(context.Background(), "git@gitlab.com:owner/repo.git", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(prs) != 1 || !prs[0].Fork || prs[0].HeadRepoURL != "git@gitlab.com:fork/repo.git" {
+		t.Errorf("expected fork cloned over SSH from its own project, got %+v", prs)
+	}
+}
+
+func TestCommentsGitHub(t *testing.T) {
+	var reaction, comment map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/issues/42/comments", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":7,"body":"/preview","user":{"login":"octocat"},"author_association":"MEMBER"},
+			{"id":8,"body":"/preview","user":{"login":"someone"},"author_association":"NONE"}]`))
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/comments/7/reactions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&reaction)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		w.WriteHeader(http.StatusCreated)
+	})
+	client := newTestProviderClient(t, "https://github.com/owner/repo", mux)
+	ctx := context.Background()
+
+	comments, err := client.ListComments(ctx, "https://github.com/owner/repo", nil, 42)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("expected 2 comments, got %d", len(comments))
+	}
+	if !comments[0].Maintainer || comments[1].Maintainer {
+		t.Errorf("expected only the member to be a maintainer, got %+v", comments)
+	}
+
+	if err = client.AddReaction(ctx, "https://github.com/owner/repo", nil, 42, 7); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reaction["content"] != "+1" {
+		t.Errorf("expected +1 reaction, got %v", reaction)
+	}
+
+	if err = client.CreateComment(ctx, "https://github.com/owner/repo", nil, 42, "done"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if comment["body"] != "done" {
+		t.Errorf("expected comment body done, got %v", comment)
+	}
+}
+
+func TestCommentsGitLab(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/owner%2Frepo/merge_requests/3/notes", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":1,"body":"added 1 commit","system":true,"author":{"username":"bot"}},
+			{"id":2,"body":"/preview destroy","system":false,"author":{"username":"dev"}}]`))
+	})
+	client := newTestProviderClient(t, "https://gitlab.com/owner/repo", mux)
+
+	comments, err := client.ListComments(context.Background(), "https://gitlab.com/owner/repo", nil, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(comments) != 1 || comments[0].ID != 2 || comments[0].Author != "dev" {
+		t.Errorf("expected only the user note, got %+v", comments)
+	}
+}
+
+func TestCommentsPaginated(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`[{"id":2,"body":"/preview","user":{"login":"octocat"}}]`))
+
+			return
+		}
+		w.Header().Set("Link", `<https://api.github.com/repos/owner/repo/issues/42/comments?per_page=100&page=2>; rel="next", `+
+			`<https://api.github.com/repos/owner/repo/issues/42/comments?per_page=100&page=2>; rel="last"`)
+		_, _ = w.Write([]byte(`[{"id":1,"body":"first","user":{"login":"octocat"}}]`))
+	})
+	mux.HandleFunc("GET /2.0/repositories/owner/repo/pullrequests/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`{"values":[{"id":2,"content":{"raw":"/preview"},"user":{"nickname":"dev"}}]}`))
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"values":[{"id":1,"content":{"raw":"first"},"user":{"nickname":"dev"}}],
+			"next":"https://api.bitbucket.org/2.0/repositories/owner/repo/pullrequests/3/comments?pagelen=100&page=2"}`))
+	})
+
+	for repoURL, number := range map[string]int{"https://github.com/owner/repo": 42, "https://bitbucket.org/owner/repo": 3} {
+		client := newTestProviderClient(t, repoURL, mux)
+
+		comments, err := client.ListComments(context.Background(), repoURL, nil, number)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %v", repoURL, err)
+		}
+		if len(comments) != 2 || comments[0].ID != 1 || comments[1].ID != 2 {
+			t.Errorf("expected comments of both pages for %s, got %+v", repoURL, comments)
+		}
+	}
+}
+
+func TestCommentsForeignNextPage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/issues/42/comments", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Link", `<https://attacker.example/comments?page=2>; rel="next"`)
+		_, _ = w.Write([]byte(`[]`))
+	})
+	client := newTestProviderClient(t, "https://github.com/owner/repo", mux)
+
+	if _, err := client.ListComments(context.Background(), "https://github.com/owner/repo", []byte("secret"), 42); err == nil {
+		t.Error("expected an error for a next page on another host")
+	}
+}
+
+func TestAddReactionBitbucketUnsupported(t *testing.T) {
+	client := newTestProviderClient(t, "https://bitbucket.org/owner/repo", http.NewServeMux())
+
+	err := client.AddReaction(context.Background(), "https://bitbucket.org/owner/repo", nil, 1, 1)
+	if !errors.Is(err, ErrReactionsUnsupported) {
+		t.Errorf("expected ErrReactionsUnsupported, got %v", err)
+	}
+}
+
+func TestSetCommitStatus(t *testing.T) {
+	var github, bitbucket map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /repos/owner/repo/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&github)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /2.0/repositories/owner/repo/commit/abc123/statuses/build", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&bitbucket)
+		w.WriteHeader(http.StatusCreated)
+	})
+	status := CommitStatus{State: CommitStatePending, Context: "cdk8s/preview", Description: "queued"}
+
+	client := newTestProviderClient(t, "https://github.com/owner/repo", mux)
+	if err := client.SetCommitStatus(context.Background(), "https://github.com/owner/repo", nil, "abc123", status); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if github["state"] != "pending" || github["context"] != "cdk8s/preview" || github["description"] != "queued" {
+		t.Errorf("unexpected GitHub status %v", github)
+	}
+
+	client = newTestProviderClient(t, "https://bitbucket.org/owner/repo", mux)
+	if err := client.SetCommitStatus(context.Background(), "https://bitbucket.org/owner/repo", nil, "abc123", status); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bitbucket["state"] != "INPROGRESS" || bitbucket["key"] != "cdk8s/preview" || bitbucket["url"] != "https://bitbucket.org/owner/repo" {
+		t.Errorf("unexpected Bitbucket status %v", bitbucket)
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Package oci pulls bundles of pre-synthesized manifests from OCI registries.
+*/
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// Scheme prefixes the URLs of OCI repositories.
+	Scheme = "oci://"
+
+	// TitleAnnotation names the file of a layer, as set by oras push.
+	TitleAnnotation = "org.opencontainers.image.title"
+
+	// MaxBundleBytes bounds the extracted size of a bundle.
+	MaxBundleBytes = 256 << 20
+)
+
+// Implementer pulls bundles from OCI registries.
+type Implementer struct {
+	// Username and Password authenticate at the registry. Without them, the bundle is pulled anonymously.
+	Username string
+	Password string
+
+	// Insecure pulls over plain HTTP.
+	Insecure bool
+}
+
+// DigestMismatchError reports a bundle whose manifest does not match the pinned digest.
+type DigestMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("artifact digest %s does not match the pinned digest %s", e.Actual, e.Expected)
+}
+
+// Reference returns the reference of the bundle at url with the tag or the digest, which takes
+// precedence. The tag defaults to latest.
+func Reference(url, tag, digest string) string {
+	repository := strings.TrimPrefix(url, Scheme)
+	switch {
+	case digest != "":
+		return repository + "@" + digest
+	case tag != "":
+		return repository + ":" + tag
+	}
+
+	return repository + ":latest"
+}
+
+// Registry returns the host of the registry of the repository at url.
+func Registry(url string) string {
+	host, _, _ := strings.Cut(strings.TrimPrefix(url, Scheme), "/")
+
+	return host
+}
+
+// Pull pulls the bundle at url with the tag or digest and extracts its layers into directory:
+// tar+gzip layers are unpacked, layers with a title annotation are written to a file of that
+// name. The digests of the manifest and the layers are verified. It returns the manifest digest.
+func (i *Implementer) Pull(ctx context.Context, url, tag, digest, directory string, logger logr.Logger) (artifactDigest string, err error) {
+	var options []name.Option
+	if i.Insecure {
+		options = append(options, name.Insecure)
+	}
+	ref, err := name.ParseReference(Reference(url, tag, digest), options...)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact reference: %w", err)
+	}
+
+	auth := authn.Anonymous
+	if i.Username != "" || i.Password != "" {
+		auth = &authn.Basic{Username: i.Username, Password: i.Password}
+	}
+
+	descriptor, err := remote.Get(ref, remote.WithContext(ctx), remote.WithAuth(auth))
+	if err != nil {
+		logger.Error(err, "Failed to fetch artifact manifest", "reference", ref.String())
+
+		return "", fmt.Errorf("failed to fetch artifact %s: %w", ref, err)
+	}
+
+	sum := sha256.Sum256(descriptor.Manifest)
+	artifactDigest = "sha256:" + hex.EncodeToString(sum[:])
+	if digest != "" && artifactDigest != digest {
+		return "", &DigestMismatchError{Expected: digest, Actual: artifactDigest}
+	}
+	if descriptor.MediaType.IsIndex() {
+		return "", fmt.Errorf("artifact %s is an index, a single manifest is required", ref)
+	}
+
+	image, err := descriptor.Image()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := image.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(directory, 0o755); err != nil {
+		return "", err
+	}
+	budget := &budget{remaining: MaxBundleBytes}
+	for _, layer := range manifest.Layers {
+		if err = extractLayer(image, layer, directory, budget); err != nil {
+			logger.Error(err, "Failed to extract artifact layer", "digest", layer.Digest.String())
+
+			return "", fmt.Errorf("failed to extract layer %s of artifact %s: %w", layer.Digest, ref, err)
+		}
+	}
+	logger.Info("Pulled artifact", "reference", ref.String(), "digest", artifactDigest, "layers", len(manifest.Layers))
+
+	return artifactDigest, nil
+}
+
+// extractLayer extracts the layer into directory. The layer is read to its end, so its digest is verified.
+func extractLayer(image v1.Image, descriptor v1.Descriptor, directory string, budget *budget) (err error) {
+	layer, err := image.LayerByDigest(descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	reader, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	mediaType := string(descriptor.MediaType)
+	switch {
+	case strings.HasSuffix(mediaType, "tar+gzip") || strings.HasSuffix(mediaType, "tar.gzip"):
+		if err = extractTarball(reader, directory, budget); err != nil {
+			return err
+		}
+	case descriptor.Annotations[TitleAnnotation] != "":
+		target, err := within(directory, descriptor.Annotations[TitleAnnotation])
+		if err != nil {
+			return err
+		}
+		if err = writeFile(reader, target, 0o644, budget); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported media type %q without %s annotation", mediaType, TitleAnnotation)
+	}
+
+	// Drain the layer, the digest is verified at its end.
+	_, err = io.Copy(io.Discard, reader)
+
+	return err
+}
+
+// extractTarball extracts the directories and regular files of a gzipped tarball into directory.
+// Links are skipped, so no entry is written outside of directory.
+func extractTarball(reader io.Reader, directory string, budget *budget) (err error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := within(directory, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			err = writeFile(archive, target, header.FileInfo().Mode().Perm()|0o600, budget)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Drain the gzip trailer.
+	_, err = io.Copy(io.Discard, gz)
+
+	return err
+}
+
+// within returns the path of name in directory, refusing names leaving it.
+func within(directory, name string) (path string, err error) {
+	path = filepath.Join(directory, name)
+	if path != directory && !strings.HasPrefix(path, directory+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the artifact", name)
+	}
+
+	return path, nil
+}
+
+// budget tracks the bytes a bundle may still extract.
+type budget struct {
+	remaining int64
+}
+
+func writeFile(reader io.Reader, target string, mode os.FileMode, budget *budget) (err error) {
+	if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, io.LimitReader(reader, budget.remaining+1))
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+	budget.remaining -= written
+	if budget.remaining < 0 {
+		_ = file.Close()
+
+		return fmt.Errorf("artifact exceeds %d bytes", MaxBundleBytes)
+	}
+
+	return file.Close()
+}
+
+// DockerConfigCredentials returns the credentials of registry in a .dockerconfigjson.
+func DockerConfigCredentials(config []byte, registry string) (username, password string, err error) {
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err = json.Unmarshal(config, &dockerConfig); err != nil {
+		return "", "", fmt.Errorf("invalid docker config: %w", err)
+	}
+
+	for server, auth := range dockerConfig.Auths {
+		host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		if host != registry {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid auth of %s in docker config: %w", server, err)
+		}
+		username, password, _ = strings.Cut(string(decoded), ":")
+
+		return username, password, nil
+	}
+
+	return "", "", fmt.Errorf("docker config has no credentials for %s", registry)
+}
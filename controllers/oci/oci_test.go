@@ -0,0 +1,272 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+)
+
+const (
+	configMapManifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"
+	tarballMediaType  = "application/vnd.cncf.flux.content.v1.tar+gzip"
+)
+
+// tarball returns a gzipped tarball of the files.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// push pushes an artifact of the layers to the registry at host and returns its URL and digest.
+func push(t *testing.T, host, tag string, layers ...mutate.Addendum) (url, digest string) {
+	t.Helper()
+
+	image, err := mutate.Append(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host + "/apps/manifests:" + tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remote.Write(ref, image); err != nil {
+		t.Fatal(err)
+	}
+	imageDigest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Scheme + host + "/apps/manifests", imageDigest.String()
+}
+
+// localRegistry starts an in-memory registry, wrapping its handler with wrap if given.
+func localRegistry(t *testing.T, wrap func(http.Handler) http.Handler) (host string) {
+	t.Helper()
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	return serve(t, handler)
+}
+
+// serve serves handler and returns its host.
+func serve(t *testing.T, handler http.Handler) (host string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestPull(t *testing.T) {
+	host := localRegistry(t, nil)
+
+	url, digest := push(t, host, "v1", mutate.Addendum{
+		Layer:     static.NewLayer(tarball(t, map[string]string{"dist/app.k8s.yaml": configMapManifest}), tarballMediaType),
+		MediaType: tarballMediaType,
+	})
+	// An artifact pushed with oras, one layer per file.
+	orasURL, orasDigest := push(t, host, "oras", mutate.Addendum{
+		Layer:       static.NewLayer([]byte(configMapManifest), "application/yaml"),
+		MediaType:   "application/yaml",
+		Annotations: map[string]string{TitleAnnotation: "app.k8s.yaml"},
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		tag        string
+		digest     string
+		wantFile   string
+		wantDigest string
+	}{
+		{name: "tag", url: url, tag: "v1", wantFile: "dist/app.k8s.yaml", wantDigest: digest},
+		{name: "digest", url: url, digest: digest, wantFile: "dist/app.k8s.yaml", wantDigest: digest},
+		{name: "title annotations", url: orasURL, tag: "oras", wantFile: "app.k8s.yaml", wantDigest: orasDigest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			artifactDigest, err := (&Implementer{Insecure: true}).Pull(context.Background(), tt.url, tt.tag, tt.digest, directory, logr.Discard())
+			if err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			if artifactDigest != tt.wantDigest {
+				t.Errorf("Pull() digest = %s, want %s", artifactDigest, tt.wantDigest)
+			}
+
+			content, err := os.ReadFile(filepath.Join(directory, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != configMapManifest {
+				t.Errorf("extracted %q, want %q", content, configMapManifest)
+			}
+		})
+	}
+}
+
+func TestPullFailures(t *testing.T) {
+	host := localRegistry(t, nil)
+	url, _ := push(t, host, "traversal", mutate.Addendum{
+		Layer:     static.NewLayer(tarball(t, map[string]string{"../escape.yaml": configMapManifest}), tarballMediaType),
+		MediaType: tarballMediaType,
+	})
+	unknownURL, _ := push(t, host, "unknown", mutate.Addendum{
+		Layer:     static.NewLayer([]byte("{}"), "application/json"),
+		MediaType: "application/json",
+	})
+
+	tests := []struct {
+		name    string
+		url     string
+		tag     string
+		digest  string
+		wantErr string
+	}{
+		{name: "entry outside of the artifact", url: url, tag: "traversal", wantErr: "outside of the artifact"},
+		{name: "layer without title", url: unknownURL, tag: "unknown", wantErr: "unsupported media type"},
+		{name: "unknown digest", url: url, digest: "sha256:" + strings.Repeat("0", 64), wantErr: "failed to fetch artifact"},
+		{name: "unknown tag", url: url, tag: "missing", wantErr: "failed to fetch artifact"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			_, err := (&Implementer{Insecure: true}).Pull(context.Background(), tt.url, tt.tag, tt.digest, directory, logr.Discard())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Pull() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPullTamperedLayer(t *testing.T) {
+	// The registry serves a layer whose content does not match its digest.
+	host := localRegistry(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+				recorder := httptest.NewRecorder()
+				next.ServeHTTP(recorder, r)
+				body := bytes.Replace(recorder.Body.Bytes(), []byte("name: cm"), []byte("name: xx"), 1)
+				for key, values := range recorder.Header() {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(recorder.Code)
+				_, _ = w.Write(body)
+
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	url, digest := push(t, host, "v1", mutate.Addendum{
+		Layer:       static.NewLayer([]byte(configMapManifest), "application/yaml"),
+		MediaType:   "application/yaml",
+		Annotations: map[string]string{TitleAnnotation: "app.k8s.yaml"},
+	})
+
+	_, err := (&Implementer{Insecure: true}).Pull(context.Background(), url, "", digest, t.TempDir(), logr.Discard())
+	if err == nil || !strings.Contains(err.Error(), "error verifying sha256 checksum") {
+		t.Fatalf("Pull() error = %v, want a checksum error", err)
+	}
+}
+
+func TestPullAuthentication(t *testing.T) {
+	// The artifact is pushed anonymously and pulled from the same registry requiring credentials.
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	host := serve(t, handler)
+	authenticatedHost := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "ci" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	_, _ = push(t, host, "v1", mutate.Addendum{
+		Layer:       static.NewLayer([]byte(configMapManifest), "application/yaml"),
+		MediaType:   "application/yaml",
+		Annotations: map[string]string{TitleAnnotation: "app.k8s.yaml"},
+	})
+	url := Scheme + authenticatedHost + "/apps/manifests"
+
+	if _, err := (&Implementer{Insecure: true}).Pull(context.Background(), url, "v1", "", t.TempDir(), logr.Discard()); err == nil {
+		t.Error("Pull() without credentials succeeded")
+	}
+	if _, err := (&Implementer{Insecure: true, Username: "ci", Password: "secret"}).Pull(context.Background(), url, "v1", "", t.TempDir(), logr.Discard()); err != nil {
+		t.Errorf("Pull() with credentials error = %v", err)
+	}
+}
+
+func TestReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	for _, tt := range []struct{ tag, digest, want string }{
+		{want: "ghcr.io/org/app:latest"},
+		{tag: "v1", want: "ghcr.io/org/app:v1"},
+		{tag: "v1", digest: digest, want: "ghcr.io/org/app@" + digest},
+	} {
+		if got := Reference("oci://ghcr.io/org/app", tt.tag, tt.digest); got != tt.want {
+			t.Errorf("Reference() = %s, want %s", got, tt.want)
+		}
+	}
+	if got := Registry("oci://ghcr.io/org/app"); got != "ghcr.io" {
+		t.Errorf("Registry() = %s, want ghcr.io", got)
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	config := []byte(`{"auths": {"https://ghcr.io": {"auth": "Y2k6c2VjcmV0"}, "registry.local:5000": {"username": "u", "password": "p"}}}`)
+
+	username, password, err := DockerConfigCredentials(config, "ghcr.io")
+	if err != nil || username != "ci" || password != "secret" {
+		t.Errorf("DockerConfigCredentials() = %s, %s, %v", username, password, err)
+	}
+	username, password, err = DockerConfigCredentials(config, "registry.local:5000")
+	if err != nil || username != "u" || password != "p" {
+		t.Errorf("DockerConfigCredentials() = %s, %s, %v", username, password, err)
+	}
+	if _, _, err = DockerConfigCredentials(config, "docker.io"); err == nil {
+		t.Error("DockerConfigCredentials() found credentials of an unknown registry")
+	}
+}
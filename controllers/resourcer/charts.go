@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcer
+
+import (
+	"fmt"
+	"path"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+// TargetCharts returns the resources of the Cdk8sAppProxy deployed to the cluster. A resource whose
+// chart matches a chart target is deployed if the cluster matches the cluster selector of the first
+// matching target, all other resources are deployed to every cluster.
+func TargetCharts(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, cluster *clusterv1.Cluster, parsedResources []*unstructured.Unstructured) (targeted []*unstructured.Unstructured, err error) {
+	targets := cdk8sAppProxy.Spec.ChartTargets
+	if len(targets) == 0 {
+		return parsedResources, nil
+	}
+
+	selectors := make([]labels.Selector, len(targets))
+	for idx := range targets {
+		selectors[idx], err = metav1.LabelSelectorAsSelector(&targets[idx].ClusterSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster selector of chart target %s: %w", targets[idx].Chart, err)
+		}
+	}
+
+	clusterLabels := labels.Set(cluster.GetLabels())
+	for _, resource := range parsedResources {
+		if chart, ok := resource.GetAnnotations()[addonsv1alpha1.ChartAnnotation]; ok {
+			idx := matchChartTarget(targets, chart)
+			if idx >= 0 && !selectors[idx].Matches(clusterLabels) {
+				continue
+			}
+		}
+		targeted = append(targeted, resource)
+	}
+
+	return targeted, nil
+}
+
+// matchChartTarget returns the index of the first target matching the chart, -1 if none does.
+func matchChartTarget(targets []addonsv1alpha1.ChartTarget, chart string) int {
+	for idx, target := range targets {
+		if matched, _ := path.Match(target.Chart, chart); matched {
+			return idx
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcer
+
+import (
+	"fmt"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// isolationObjectName is the name of the ResourceQuota, LimitRange and NetworkPolicy created in a target namespace.
+const isolationObjectName = "cdk8s-isolation"
+
+// IsolateNamespace moves the namespaced resources into the target namespace of the Cdk8sAppProxy and
+// prepends the namespace and its guard rails. Namespace resources of the app are dropped, and the
+// ServiceAccount subjects of role bindings referring to a moved namespace follow the resources. The
+// scope of a kind is looked up with mapper, the RESTMapper of the target cluster, or taken from a
+// CustomResourceDefinition of the app. The resources are returned unchanged if the Cdk8sAppProxy has
+// no target namespace.
+func IsolateNamespace(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, parsedResources []*unstructured.Unstructured, mapper meta.RESTMapper) (isolated []*unstructured.Unstructured, err error) {
+	target := cdk8sAppProxy.Spec.TargetNamespace
+	if target == nil {
+		return parsedResources, nil
+	}
+
+	objects := []runtime.Object{
+		&corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: target.Name},
+		},
+	}
+	if target.ResourceQuota != nil {
+		objects = append(objects, &corev1.ResourceQuota{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"},
+			ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName, Namespace: target.Name},
+			Spec:       *target.ResourceQuota,
+		})
+	}
+	if target.LimitRange != nil {
+		objects = append(objects, &corev1.LimitRange{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "LimitRange"},
+			ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName, Namespace: target.Name},
+			Spec:       *target.LimitRange,
+		})
+	}
+	if target.NetworkPolicy != nil {
+		objects = append(objects, &networkingv1.NetworkPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+			ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName, Namespace: target.Name},
+			Spec:       *target.NetworkPolicy,
+		})
+	}
+
+	for _, object := range objects {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+		if err != nil {
+			return nil, err
+		}
+		resource := &unstructured.Unstructured{Object: content}
+		// Drop the empty creationTimestamp and status the converter adds.
+		unstructured.RemoveNestedField(resource.Object, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(resource.Object, "status")
+		isolated = append(isolated, resource)
+	}
+
+	// The namespaces of the app, whose references are rewritten to the target namespace.
+	moved := map[string]bool{}
+	clusterScoped := make([]bool, len(parsedResources))
+	crdScopes := customResourceScopes(parsedResources)
+	for idx, resource := range parsedResources {
+		if resource.GetKind() == "Namespace" {
+			moved[resource.GetName()] = true
+
+			continue
+		}
+		if clusterScoped[idx], err = isClusterScoped(resource.GroupVersionKind(), mapper, crdScopes); err != nil {
+			return nil, err
+		}
+		if !clusterScoped[idx] {
+			moved[resource.GetNamespace()] = true
+		}
+	}
+
+	for idx, resource := range parsedResources {
+		if resource.GetKind() == "Namespace" {
+			continue
+		}
+
+		resource = resource.DeepCopy()
+		if !clusterScoped[idx] {
+			resource.SetNamespace(target.Name)
+		}
+		if err = rewriteSubjects(resource, moved, target.Name); err != nil {
+			return nil, err
+		}
+		isolated = append(isolated, resource)
+	}
+
+	return isolated, nil
+}
+
+// customResourceScopes returns whether the kinds defined by the CustomResourceDefinitions among the
+// resources are cluster-scoped. The kinds are not known to the cluster before the app is applied.
+func customResourceScopes(resources []*unstructured.Unstructured) map[schema.GroupKind]bool {
+	scopes := map[schema.GroupKind]bool{}
+	for _, resource := range resources {
+		if resource.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(resource.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(resource.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(resource.Object, "spec", "scope")
+		scopes[schema.GroupKind{Group: group, Kind: kind}] = scope == "Cluster"
+	}
+
+	return scopes
+}
+
+// isClusterScoped reports whether resources of the kind are cluster-scoped. Kinds unknown to the
+// cluster and the app are treated as namespaced.
+func isClusterScoped(gvk schema.GroupVersionKind, mapper meta.RESTMapper, crdScopes map[schema.GroupKind]bool) (bool, error) {
+	if clusterScoped, ok := crdScopes[gvk.GroupKind()]; ok {
+		return clusterScoped, nil
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the scope of %s: %w", gvk.Kind, err)
+	}
+
+	return mapping.Scope.Name() == meta.RESTScopeNameRoot, nil
+}
+
+// rewriteSubjects moves the ServiceAccount subjects of a RoleBinding or ClusterRoleBinding that refer
+// to one of the moved namespaces into the target namespace.
+func rewriteSubjects(resource *unstructured.Unstructured, moved map[string]bool, target string) error {
+	gvk := resource.GroupVersionKind()
+	if gvk.Group != rbacv1.GroupName || (gvk.Kind != "RoleBinding" && gvk.Kind != "ClusterRoleBinding") {
+		return nil
+	}
+
+	subjects, found, err := unstructured.NestedSlice(resource.Object, "subjects")
+	if !found || err != nil {
+		return err
+	}
+	for _, subject := range subjects {
+		fields, ok := subject.(map[string]any)
+		if !ok || fields["kind"] != rbacv1.ServiceAccountKind {
+			continue
+		}
+		if namespace, _ := fields["namespace"].(string); moved[namespace] {
+			fields["namespace"] = target
+		}
+	}
+
+	return unstructured.SetNestedSlice(resource.Object, subjects, "subjects")
+}
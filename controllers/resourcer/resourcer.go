@@ -4,17 +4,26 @@ package resourcer
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 
 	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -27,35 +36,59 @@ type Implementer struct {
 	client.Client
 }
 
+// fieldManager is the field manager applying the resources of a Cdk8sAppProxy.
+const fieldManager = "cdk8sappproxy-controller"
+
+// newDynamicClient returns the client of a target cluster for its REST config.
+var newDynamicClient = func(restConfig *rest.Config) (dynamic.Interface, error) {
+	return dynamic.NewForConfig(restConfig)
+}
+
 // Apply applies resources to the target clusters.
 func (i *Implementer) Apply(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, parsedResources []*unstructured.Unstructured, logger logr.Logger) (err error) {
-	clusters, err := i.clusterList(ctx, cdk8sAppProxy, logger)
+	clusters, err := i.Clusters(ctx, cdk8sAppProxy, logger)
 	if err != nil {
 		logger.Error(err, "failed to list clusters")
 
 		return err
 	}
 
-	for _, cluster := range clusters.Items {
-		c, err := i.clusterClient(ctx, cluster.Namespace, cluster.Name)
-		if err != nil {
-			logger.Error(err, "failed to get cluster client")
-
-			break
+	for idx := range clusters {
+		if err = i.ApplyToCluster(ctx, cdk8sAppProxy, &clusters[idx], parsedResources, logger); err != nil {
+			return err
 		}
+	}
 
-		for _, resource := range parsedResources {
-			resources := resource.DeepCopy()
-			gvr := resource.GroupVersionKind().GroupVersion().WithResource(getPluralFromKind(resource.GetKind()))
-			applyOpts := metav1.ApplyOptions{FieldManager: "cdk8sappproxy-controller", Force: true}
+	return err
+}
+
+// ApplyToCluster applies resources to a single target cluster.
+func (i *Implementer) ApplyToCluster(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, cluster *clusterv1.Cluster, parsedResources []*unstructured.Unstructured, logger logr.Logger) (err error) {
+	c, err := i.clusterClient(ctx, cluster.Namespace, cluster.Name)
+	if err != nil {
+		logger.Error(err, "failed to get cluster client", "cluster", cluster.Name)
 
-			_, err = c.Resource(gvr).Namespace(resources.GetNamespace()).Apply(ctx, resources.GetName(), resources, applyOpts)
-			if err != nil {
-				logger.Error(err, "failed to apply resource")
+		return err
+	}
 
-				break
+	for _, resource := range parsedResources {
+		resources := resource.DeepCopy()
+		if cdk8sAppProxy.Spec.Sleep {
+			if err = scaleToZero(resources); err != nil {
+				logger.Error(err, "failed to scale resource to zero", "kind", resources.GetKind(), "name", resources.GetName())
+
+				return err
 			}
 		}
+		gvr := resource.GroupVersionKind().GroupVersion().WithResource(getPluralFromKind(resource.GetKind()))
+		applyOpts := metav1.ApplyOptions{FieldManager: fieldManager, Force: true}
+
+		_, err = c.Resource(gvr).Namespace(resources.GetNamespace()).Apply(ctx, resources.GetName(), resources, applyOpts)
+		if err != nil {
+			logger.Error(err, "failed to apply resource", "cluster", cluster.Name)
+
+			return err
+		}
 	}
 
 	return err
@@ -65,87 +98,230 @@ func (i *Implementer) Apply(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.C
 func (i *Implementer) Check(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, parsedResources []*unstructured.Unstructured, logger logr.Logger) (missingResources bool, err error) {
 	missingResources = false
 
-	clusters, err := i.clusterList(ctx, cdk8sAppProxy, logger)
+	clusters, err := i.Clusters(ctx, cdk8sAppProxy, logger)
 	if err != nil {
 		logger.Error(err, "failed to list clusters")
 
 		return missingResources, err
 	}
 
-	for _, cluster := range clusters.Items {
-		c, err := i.clusterClient(ctx, cluster.Namespace, cluster.Name)
+	for idx := range clusters {
+		missing, err := i.CheckCluster(ctx, &clusters[idx], parsedResources, logger)
 		if err != nil {
-			logger.Error(err, "failed to get cluster client")
-
 			return missingResources, err
 		}
+		missingResources = missingResources || missing
+	}
 
-		for _, resource := range parsedResources {
-			gvr := resource.GroupVersionKind().GroupVersion().WithResource(getPluralFromKind(resource.GetKind()))
-			resourceGetter := c.Resource(gvr)
-			ns := resource.GetNamespace()
+	return missingResources, err
+}
 
-			if ns != "" {
-				_, err = resourceGetter.Namespace(ns).Get(ctx, resource.GetName(), metav1.GetOptions{})
-			} else {
-				_, err = resourceGetter.Get(ctx, resource.GetName(), metav1.GetOptions{})
-			}
-			if err != nil {
-				if apierrors.IsNotFound(err) {
-					missingResources = true
+// CheckCluster checks if the provided resources exist on a single target cluster.
+func (i *Implementer) CheckCluster(ctx context.Context, cluster *clusterv1.Cluster, parsedResources []*unstructured.Unstructured, logger logr.Logger) (missingResources bool, err error) {
+	c, err := i.clusterClient(ctx, cluster.Namespace, cluster.Name)
+	if err != nil {
+		logger.Error(err, "failed to get cluster client", "cluster", cluster.Name)
 
-					continue
-				}
-				logger.Error(err, "failed to check if resource exists")
+		return missingResources, err
+	}
 
-				return missingResources, err
+	for _, resource := range parsedResources {
+		gvr := resource.GroupVersionKind().GroupVersion().WithResource(getPluralFromKind(resource.GetKind()))
+		resourceGetter := c.Resource(gvr)
+		ns := resource.GetNamespace()
+
+		if ns != "" {
+			_, err = resourceGetter.Namespace(ns).Get(ctx, resource.GetName(), metav1.GetOptions{})
+		} else {
+			_, err = resourceGetter.Get(ctx, resource.GetName(), metav1.GetOptions{})
+		}
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				missingResources = true
+
+				continue
 			}
+			logger.Error(err, "failed to check if resource exists")
+
+			return missingResources, err
 		}
 	}
 
-	return missingResources, err
+	return missingResources, nil
 }
 
-func (i *Implementer) clusterList(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger) (clusterList clusterv1.ClusterList, err error) {
+// Delete deletes the resources in the inventory of the Cdk8sAppProxy and its target namespace from
+// the selected clusters. Resources the controller does not manage on a cluster, e.g. of the same name
+// but not targeted at it, are kept. Clusters that are being deleted or have no kubeconfig anymore are
+// skipped.
+func (i *Implementer) Delete(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger) (err error) {
+	clusters, err := i.Clusters(ctx, cdk8sAppProxy, logger)
+	if err != nil {
+		logger.Error(err, "failed to list clusters")
+
+		return err
+	}
+
+	entries := cdk8sAppProxy.Status.Inventory
+	if target := cdk8sAppProxy.Spec.TargetNamespace; target != nil {
+		entries = append(slices.Clone(entries), addonsv1alpha1.InventoryEntry{APIVersion: "v1", Kind: "Namespace", Name: target.Name})
+	}
+
+	for idx := range clusters {
+		cluster := &clusters[idx]
+		if !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		c, err := i.clusterClient(ctx, cluster.Namespace, cluster.Name)
+		if apierrors.IsNotFound(err) || (err == nil && c == nil) {
+			logger.Info("Skipping cluster without kubeconfig", "cluster", cluster.Name)
+
+			continue
+		}
+		if err != nil {
+			logger.Error(err, "failed to get cluster client", "cluster", cluster.Name)
+
+			return err
+		}
+
+		if err = deleteEntries(ctx, c, entries); err != nil {
+			logger.Error(err, "failed to delete resources", "cluster", cluster.Name)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteEntries deletes the resources of the entries that are managed by the controller.
+func deleteEntries(ctx context.Context, c dynamic.Interface, entries []addonsv1alpha1.InventoryEntry) (err error) {
+	for _, entry := range entries {
+		gv, err := schema.ParseGroupVersion(entry.APIVersion)
+		if err != nil {
+			return err
+		}
+		resourceClient := c.Resource(gv.WithResource(getPluralFromKind(entry.Kind))).Namespace(entry.Namespace)
+
+		resource, err := resourceClient.Get(ctx, entry.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(resource.GetManagedFields(), func(managed metav1.ManagedFieldsEntry) bool {
+			return managed.Manager == fieldManager
+		}) {
+			continue
+		}
+
+		propagation := metav1.DeletePropagationBackground
+		err = resourceClient.Delete(ctx, entry.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %w", describeEntry(entry), err)
+		}
+	}
+
+	return nil
+}
+
+// PendingControlPlanes splits the clusters into those whose control plane is available and the names
+// of those whose control plane is not available yet, e.g. freshly created preview clusters. Clusters
+// not reporting the condition are not waited for, except for generated preview clusters.
+func PendingControlPlanes(clusters []clusterv1.Cluster) (available []clusterv1.Cluster, pending []string) {
+	for _, cluster := range clusters {
+		reported := conditions.Has(&cluster, clusterv1.ClusterControlPlaneAvailableCondition)
+		_, preview := cluster.Labels[addonsv1alpha1.PreviewClusterLabel]
+		if (reported || preview) && !conditions.IsTrue(&cluster, clusterv1.ClusterControlPlaneAvailableCondition) {
+			pending = append(pending, cluster.Name)
+
+			continue
+		}
+		available = append(available, cluster)
+	}
+
+	return available, pending
+}
+
+// Clusters returns the clusters selected by the Cdk8sAppProxy.
+func (i *Implementer) Clusters(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger) (clusters []clusterv1.Cluster, err error) {
 	selector, err := metav1.LabelSelectorAsSelector(&cdk8sAppProxy.Spec.ClusterSelector)
 	if err != nil {
 		logger.Error(err, "failed to convert label selector to selector")
 
-		return clusterList, err
+		return clusters, err
 	}
 
+	clusterList := clusterv1.ClusterList{}
 	if err := i.List(ctx, &clusterList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
 		logger.Error(err, "failed to list clusters")
 
-		return clusterList, err
+		return clusters, err
 	}
 
-	return clusterList, err
+	return clusterList.Items, err
 }
 
 func (i *Implementer) clusterClient(ctx context.Context, secretNamespace, clusterName string) (dynamicClient dynamic.Interface, err error) {
+	restConfig, err := i.restConfig(ctx, secretNamespace, clusterName)
+	if err != nil || restConfig == nil {
+		return dynamicClient, err
+	}
+
+	return newDynamicClient(restConfig)
+}
+
+// RESTMapper returns a RESTMapper discovering the kinds served by the given cluster.
+func (i *Implementer) RESTMapper(ctx context.Context, cluster *clusterv1.Cluster) (mapper meta.RESTMapper, err error) {
+	restConfig, err := i.restConfig(ctx, cluster.Namespace, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	if restConfig == nil {
+		return nil, fmt.Errorf("kubeconfig of cluster %s is empty", cluster.Name)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)), nil
+}
+
+// restConfig returns the REST config of the kubeconfig Secret of the cluster, nil if the Secret holds
+// no kubeconfig.
+func (i *Implementer) restConfig(ctx context.Context, secretNamespace, clusterName string) (restConfig *rest.Config, err error) {
 	kubeconfigSecretName := clusterName + "-kubeconfig"
 	kubeconfigSecret := &corev1.Secret{}
 	if err = i.Get(ctx, client.ObjectKey{Namespace: secretNamespace, Name: kubeconfigSecretName}, kubeconfigSecret); err != nil {
-		return dynamicClient, err
+		return nil, err
 	}
 
 	kubeconfigData, ok := kubeconfigSecret.Data["value"]
 	if !ok || len(kubeconfigData) == 0 {
-		return dynamicClient, err
+		return nil, nil
 	}
 
-	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfigData)
-	if err != nil {
-		return dynamicClient, err
-	}
+	return clientcmd.RESTConfigFromKubeConfig(kubeconfigData)
+}
 
-	dynamicClient, err = dynamic.NewForConfig(restConfig)
-	if err != nil {
-		return dynamicClient, err
+// sleepingKinds are the workload kinds scaled to zero replicas while a Cdk8sAppProxy sleeps.
+var sleepingKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"ReplicaSet":  true,
+}
+
+// scaleToZero sets the replicas of workload resources to zero. Other resources are left untouched.
+func scaleToZero(resource *unstructured.Unstructured) error {
+	if !sleepingKinds[resource.GetKind()] {
+		return nil
 	}
 
-	return dynamicClient, err
+	return unstructured.SetNestedField(resource.Object, int64(0), "spec", "replicas")
 }
 
 // TODO: This is a naive pluralization and might not work for all kinds.
@@ -1,7 +1,27 @@
 package resourcer
 
 import (
+	"context"
+	"errors"
+	"reflect"
 	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestGetPluralFromKind(t *testing.T) {
@@ -34,3 +54,318 @@ func TestGetPluralFromKind(t *testing.T) {
 		}
 	}
 }
+
+func TestScaleToZero(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web"},
+		"spec":       map[string]any{"replicas": int64(3)},
+	}}
+	service := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]any{"name": "web"},
+		"spec":       map[string]any{},
+	}}
+
+	for _, resource := range []*unstructured.Unstructured{deployment, service} {
+		if err := scaleToZero(resource); err != nil {
+			t.Fatalf("scaleToZero(%s) returned error: %v", resource.GetKind(), err)
+		}
+	}
+
+	if replicas, _, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas"); replicas != 0 {
+		t.Errorf("expected Deployment replicas 0, got %d", replicas)
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(service.Object, "spec", "replicas"); found {
+		t.Errorf("expected Service to stay untouched, got %v", service.Object)
+	}
+}
+
+func TestIsolateNamespace(t *testing.T) {
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			TargetNamespace: &addonsv1alpha1.TargetNamespaceSpec{
+				Name: "app-pr-42",
+				NamespaceIsolation: addonsv1alpha1.NamespaceIsolation{
+					ResourceQuota: &corev1.ResourceQuotaSpec{
+						Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+					},
+					NetworkPolicy: &networkingv1.NetworkPolicySpec{},
+				},
+			},
+		},
+	}
+	parsed := []*unstructured.Unstructured{
+		{Object: map[string]any{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]any{"name": "web"}}},
+		{Object: map[string]any{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web", "namespace": "web"}}},
+		{Object: map[string]any{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": map[string]any{"name": "web"}}},
+		{Object: map[string]any{"apiVersion": "cert-manager.io/v1", "kind": "ClusterIssuer", "metadata": map[string]any{"name": "web"}}},
+		{Object: map[string]any{
+			"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": map[string]any{"name": "tenants.example.com"},
+			"spec": map[string]any{"group": "example.com", "scope": "Cluster", "names": map[string]any{"kind": "Tenant"}},
+		}},
+		{Object: map[string]any{"apiVersion": "example.com/v1", "kind": "Tenant", "metadata": map[string]any{"name": "web"}}},
+		{Object: map[string]any{
+			"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRoleBinding", "metadata": map[string]any{"name": "web"},
+			"subjects": []any{
+				map[string]any{"kind": "ServiceAccount", "name": "web", "namespace": "web"},
+				map[string]any{"kind": "ServiceAccount", "name": "monitoring", "namespace": "monitoring"},
+			},
+		}},
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "ClusterIssuer"}, meta.RESTScopeRoot)
+
+	isolated, err := IsolateNamespace(proxy, parsed, mapper)
+	if err != nil {
+		t.Fatalf("IsolateNamespace returned error: %v", err)
+	}
+
+	want := []struct{ kind, name, namespace string }{
+		{"Namespace", "app-pr-42", ""},
+		{"ResourceQuota", "cdk8s-isolation", "app-pr-42"},
+		{"NetworkPolicy", "cdk8s-isolation", "app-pr-42"},
+		{"Deployment", "web", "app-pr-42"},
+		{"ClusterRole", "web", ""},
+		{"ClusterIssuer", "web", ""},
+		{"CustomResourceDefinition", "tenants.example.com", ""},
+		{"Tenant", "web", ""},
+		{"ClusterRoleBinding", "web", ""},
+	}
+	if len(isolated) != len(want) {
+		t.Fatalf("expected %d resources, got %d", len(want), len(isolated))
+	}
+	for i, w := range want {
+		got := isolated[i]
+		if got.GetKind() != w.kind || got.GetName() != w.name || got.GetNamespace() != w.namespace {
+			t.Errorf("resource %d = %s %s/%s, want %s %s/%s", i, got.GetKind(), got.GetNamespace(), got.GetName(), w.kind, w.namespace, w.name)
+		}
+	}
+	subjects, _, _ := unstructured.NestedSlice(isolated[8].Object, "subjects")
+	if len(subjects) != 2 || subjects[0].(map[string]any)["namespace"] != "app-pr-42" || subjects[1].(map[string]any)["namespace"] != "monitoring" {
+		t.Errorf("expected only the subject of the app namespace to move, got %v", subjects)
+	}
+	if pods, _, _ := unstructured.NestedString(isolated[1].Object, "spec", "hard", "pods"); pods != "10" {
+		t.Errorf("expected ResourceQuota with 10 pods, got %v", isolated[1].Object)
+	}
+	if parsed[1].GetNamespace() != "web" {
+		t.Errorf("expected the parsed resources to stay unchanged")
+	}
+}
+
+func TestCombineSources(t *testing.T) {
+	configMap := func(namespace, value string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1", "kind": "ConfigMap",
+			"metadata": map[string]any{"name": "settings", "namespace": namespace},
+			"data":     map[string]any{"value": value},
+		}}
+	}
+	namespace := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]any{"name": "platform"}}}
+
+	combined, err := CombineSources([]SourceResources{
+		{Resources: []*unstructured.Unstructured{namespace, configMap("platform", "a")}},
+		{Name: "shared", Resources: []*unstructured.Unstructured{namespace.DeepCopy(), configMap("shared", "b")}},
+	})
+	if err != nil {
+		t.Fatalf("CombineSources returned error: %v", err)
+	}
+	want := []string{"Namespace//platform", "ConfigMap/platform/settings", "ConfigMap/shared/settings"}
+	if len(combined) != len(want) {
+		t.Fatalf("expected %d resources, got %d", len(want), len(combined))
+	}
+	for i, w := range want {
+		if got := combined[i].GetKind() + "/" + combined[i].GetNamespace() + "/" + combined[i].GetName(); got != w {
+			t.Errorf("resource %d = %s, want %s", i, got, w)
+		}
+	}
+
+	_, err = CombineSources([]SourceResources{
+		{Name: "ingress", Resources: []*unstructured.Unstructured{configMap("platform", "a")}},
+		{Name: "shared", Resources: []*unstructured.Unstructured{configMap("platform", "b")}},
+	})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Sources != [2]string{"ingress", "shared"} {
+		t.Fatalf("expected a ConflictError of ingress and shared, got %v", err)
+	}
+	if want := "v1/ConfigMap platform/settings is rendered differently by source ingress and source shared"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestAddToInventory(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web", "namespace": "platform"}}}
+	clusterRole := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": map[string]any{"name": "web"}}}
+
+	inventory := AddToInventory(nil, []*unstructured.Unstructured{clusterRole, deployment})
+	// Per-cluster synthesis adds the resources of every cluster.
+	inventory = AddToInventory(inventory, []*unstructured.Unstructured{deployment})
+
+	want := []addonsv1alpha1.InventoryEntry{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "platform", Name: "web"},
+		{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "web"},
+	}
+	if !reflect.DeepEqual(inventory, want) {
+		t.Errorf("inventory = %+v, want %+v", inventory, want)
+	}
+}
+
+func TestTargetCharts(t *testing.T) {
+	chart := func(kind, chart string) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "v1", "kind": kind, "metadata": map[string]any{"name": "app"}}}
+		if chart != "" {
+			resource.SetAnnotations(map[string]string{addonsv1alpha1.ChartAnnotation: chart})
+		}
+
+		return resource
+	}
+	parsed := []*unstructured.Unstructured{
+		chart("ConfigMap", "control-plane.k8s.yaml"),
+		chart("Secret", "workload.k8s.yaml"),
+		chart("Service", ""),
+		chart("ServiceAccount", "monitoring-crds.k8s.yaml"),
+	}
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{Spec: addonsv1alpha1.Cdk8sAppProxySpec{ChartTargets: []addonsv1alpha1.ChartTarget{
+		{Chart: "control-plane.k8s.yaml", ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "management-adjacent"}}},
+		{Chart: "*.k8s.yaml", ClusterSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "role", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"management-adjacent"}},
+		}}},
+	}}}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{name: "management-adjacent cluster", labels: map[string]string{"role": "management-adjacent"}, want: []string{"ConfigMap", "Service"}},
+		{name: "workload cluster", labels: map[string]string{"role": "workload"}, want: []string{"Secret", "Service", "ServiceAccount"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Labels: tt.labels}}
+			targeted, err := TargetCharts(proxy, cluster, parsed)
+			if err != nil {
+				t.Fatalf("TargetCharts returned error: %v", err)
+			}
+			var kinds []string
+			for _, resource := range targeted {
+				kinds = append(kinds, resource.GetKind())
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("targeted %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+
+	targeted, err := TargetCharts(&addonsv1alpha1.Cdk8sAppProxy{}, &clusterv1.Cluster{}, parsed)
+	if err != nil || len(targeted) != len(parsed) {
+		t.Errorf("expected all resources without chart targets, got %d, %v", len(targeted), err)
+	}
+}
+
+func TestPendingControlPlanes(t *testing.T) {
+	cluster := func(name string, labels map[string]string, available *metav1.ConditionStatus) clusterv1.Cluster {
+		c := clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		if available != nil {
+			c.Status.Conditions = []metav1.Condition{{Type: clusterv1.ClusterControlPlaneAvailableCondition, Status: *available}}
+		}
+
+		return c
+	}
+	isTrue, isFalse := metav1.ConditionTrue, metav1.ConditionFalse
+	preview := map[string]string{addonsv1alpha1.PreviewClusterLabel: "app-pr-1"}
+
+	available, pending := PendingControlPlanes([]clusterv1.Cluster{
+		cluster("ready", nil, &isTrue),
+		cluster("starting", nil, &isFalse),
+		cluster("unreported", nil, nil),
+		cluster("preview-new", preview, nil),
+		cluster("preview-ready", preview, &isTrue),
+	})
+
+	names := make([]string, 0, len(available))
+	for _, c := range available {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"ready", "unreported", "preview-ready"}) {
+		t.Errorf("unexpected available clusters %v", names)
+	}
+	if !reflect.DeepEqual(pending, []string{"starting", "preview-new"}) {
+		t.Errorf("unexpected pending clusters %v", pending)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clusterv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	selected := map[string]string{addonsv1alpha1.PreviewClusterLabel: "app-pr-1"}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "default", Labels: selected}}
+	// The kubeconfig of a removed cluster is gone, the cluster is skipped.
+	removed := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default", Labels: selected}}
+	kubeconfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "preview-kubeconfig", Namespace: "default"},
+		Data: map[string][]byte{"value": []byte("apiVersion: v1\nkind: Config\nclusters:\n- name: preview\n  cluster:\n    server: https://preview.example.com\n" +
+			"contexts:\n- name: preview\n  context:\n    cluster: preview\n    user: preview\ncurrent-context: preview\nusers:\n- name: preview\n  user:\n    token: token\n")},
+	}
+
+	managed := []metav1.ManagedFieldsEntry{{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationApply}}
+	resource := func(apiVersion, kind, namespace, name string, managedFields []metav1.ManagedFieldsEntry) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion(apiVersion)
+		resource.SetKind(kind)
+		resource.SetNamespace(namespace)
+		resource.SetName(name)
+		resource.SetManagedFields(managedFields)
+
+		return resource
+	}
+	workload := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		resource("apps/v1", "Deployment", "app-pr-1", "web", managed),
+		resource("v1", "Namespace", "", "app-pr-1", managed),
+		resource("v1", "ResourceQuota", "app-pr-1", "cdk8s-isolation", managed),
+		// A resource of the same name not applied by the controller is kept.
+		resource("v1", "ConfigMap", "kube-system", "web", nil),
+	)
+	previous := newDynamicClient
+	newDynamicClient = func(*rest.Config) (dynamic.Interface, error) { return workload, nil }
+	defer func() { newDynamicClient = previous }()
+
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: selected},
+			TargetNamespace: &addonsv1alpha1.TargetNamespaceSpec{Name: "app-pr-1"},
+		},
+		Status: addonsv1alpha1.Cdk8sAppProxyStatus{Inventory: []addonsv1alpha1.InventoryEntry{
+			{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "app-pr-1", Name: "web"},
+			{APIVersion: "v1", Kind: "ConfigMap", Namespace: "kube-system", Name: "web"},
+			{APIVersion: "v1", Kind: "ResourceQuota", Namespace: "app-pr-1", Name: "cdk8s-isolation"},
+		}},
+	}
+	i := &Implementer{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster, removed, kubeconfig).Build()}
+	if err := i.Delete(context.Background(), proxy, logr.Discard()); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	for _, gone := range []*unstructured.Unstructured{
+		resource("apps/v1", "Deployment", "app-pr-1", "web", nil),
+		resource("v1", "ResourceQuota", "app-pr-1", "cdk8s-isolation", nil),
+		resource("v1", "Namespace", "", "app-pr-1", nil),
+	} {
+		gvr := gone.GroupVersionKind().GroupVersion().WithResource(getPluralFromKind(gone.GetKind()))
+		if _, err := workload.Resource(gvr).Namespace(gone.GetNamespace()).Get(context.Background(), gone.GetName(), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s %s to be deleted, got %v", gone.GetKind(), gone.GetName(), err)
+		}
+	}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if _, err := workload.Resource(configMaps).Namespace("kube-system").Get(context.Background(), "web", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the unmanaged ConfigMap to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcer
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SourceResources are the resources rendered by an app of a Cdk8sAppProxy.
+type SourceResources struct {
+	// Name of the source in spec.sources, empty for the app of spec.gitRepository or spec.ociRepository.
+	Name string
+
+	Resources []*unstructured.Unstructured
+}
+
+// ConflictError reports a resource two apps of a Cdk8sAppProxy rendered differently.
+type ConflictError struct {
+	Resource string
+	Sources  [2]string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s is rendered differently by %s and %s", e.Resource, describeSource(e.Sources[0]), describeSource(e.Sources[1]))
+}
+
+func describeSource(name string) string {
+	if name == "" {
+		return "the app of spec.gitRepository or spec.ociRepository"
+	}
+
+	return "source " + name
+}
+
+// CombineSources returns the resources of the apps in the given order. A resource rendered by several
+// apps is applied once if the apps rendered it identically, and refused with a ConflictError otherwise.
+func CombineSources(sources []SourceResources) (combined []*unstructured.Unstructured, err error) {
+	type rendered struct {
+		source   string
+		resource *unstructured.Unstructured
+	}
+	seen := map[addonsv1alpha1.InventoryEntry]rendered{}
+
+	for _, source := range sources {
+		for _, resource := range source.Resources {
+			entry := inventoryEntry(resource)
+			if previous, ok := seen[entry]; ok {
+				if !reflect.DeepEqual(previous.resource.Object, resource.Object) {
+					return nil, &ConflictError{Resource: describeEntry(entry), Sources: [2]string{previous.source, source.Name}}
+				}
+
+				continue
+			}
+			seen[entry] = rendered{source: source.Name, resource: resource}
+			combined = append(combined, resource)
+		}
+	}
+
+	return combined, nil
+}
+
+// AddToInventory adds the resources to the inventory, keeping it sorted and free of duplicates.
+func AddToInventory(inventory []addonsv1alpha1.InventoryEntry, resources []*unstructured.Unstructured) []addonsv1alpha1.InventoryEntry {
+	for _, resource := range resources {
+		inventory = append(inventory, inventoryEntry(resource))
+	}
+
+	slices.SortFunc(inventory, func(a, b addonsv1alpha1.InventoryEntry) int {
+		return strings.Compare(describeEntry(a), describeEntry(b))
+	})
+
+	return slices.Compact(inventory)
+}
+
+func inventoryEntry(resource *unstructured.Unstructured) addonsv1alpha1.InventoryEntry {
+	return addonsv1alpha1.InventoryEntry{
+		APIVersion: resource.GetAPIVersion(),
+		Kind:       resource.GetKind(),
+		Namespace:  resource.GetNamespace(),
+		Name:       resource.GetName(),
+	}
+}
+
+// describeEntry returns apiVersion/kind namespace/name of the entry, e.g. apps/v1/Deployment web/api.
+func describeEntry(entry addonsv1alpha1.InventoryEntry) string {
+	name := entry.Name
+	if entry.Namespace != "" {
+		name = entry.Namespace + "/" + name
+	}
+
+	return entry.APIVersion + "/" + entry.Kind + " " + name
+}
@@ -120,8 +120,9 @@ var _ = BeforeSuite(func() {
 
 	// Setup Cdk8sAppProxyReconciler
 	err = (&caapccontroller.Reconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: k8sManager.GetScheme(),
+		Client:   k8sManager.GetClient(),
+		Scheme:   k8sManager.GetScheme(),
+		Recorder: k8sManager.GetEventRecorder("cdk8sappproxy-controller"),
 	}).SetupWithManager(k8sManager, controller.Options{})
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,385 @@
+package synthesizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	// namespacesCacheDir holds the partitions of the cache by namespace.
+	namespacesCacheDir = "namespaces"
+
+	// nodeModulesCacheDir holds the cached node_modules directories of a partition by key.
+	nodeModulesCacheDir = "node_modules"
+
+	// evictInterval is the minimum time between two evictions, each walking the whole cache.
+	evictInterval = 5 * time.Minute
+)
+
+// toolCaches are the cache directories of the package managers, relative to the partition of the
+// cache, by the environment variable pointing the tool to them.
+var toolCaches = map[string]string{
+	"GOMODCACHE":       "go/mod",
+	"GOCACHE":          "go/build",
+	"PIP_CACHE_DIR":    "pip",
+	"npm_config_cache": "npm",
+}
+
+// nodeLockfiles are the lockfiles whose content keys the cached node_modules.
+var nodeLockfiles = []string{"package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml"}
+
+// Cache is a persistent dependency cache shared by the syntheses of the controller: node_modules
+// keyed by the hash of the lockfile, and the caches of go, pip and npm. The cache is partitioned by
+// the namespace of the Cdk8sAppProxy, so that apps of one namespace cannot read or poison the
+// dependencies of another. Entries are evicted least recently used first when the cache exceeds
+// MaxBytes.
+type Cache struct {
+	// Dir is the directory of the cache, usually a persistent volume.
+	Dir string
+
+	// MaxBytes bounds the size of the cache. Zero disables eviction.
+	MaxBytes int64
+
+	// namespace is the partition used, the default namespace if empty.
+	namespace string
+	state     *cacheState
+}
+
+// cacheState is shared by the partitions of a cache.
+type cacheState struct {
+	// lock is held for reading while a synthesis uses the cache and for writing while evicting.
+	lock      sync.RWMutex
+	evictLock sync.Mutex
+	lastEvict time.Time
+}
+
+// NewCache returns a cache in dir, creating its directory.
+func NewCache(dir string, maxBytes int64) (cache *Cache, err error) {
+	if err = os.MkdirAll(filepath.Join(dir, namespacesCacheDir), 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Cache{Dir: dir, MaxBytes: maxBytes, state: &cacheState{}}, nil
+}
+
+// forNamespace returns the partition of the cache used by the syntheses of apps in namespace.
+func (c *Cache) forNamespace(namespace string) *Cache {
+	if c == nil {
+		return nil
+	}
+
+	return &Cache{Dir: c.Dir, MaxBytes: c.MaxBytes, namespace: namespace, state: c.state}
+}
+
+// dir returns the directory of the partition.
+func (c *Cache) dir() string {
+	namespace := c.namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	return filepath.Join(c.Dir, namespacesCacheDir, namespace)
+}
+
+// env returns the environment variables pointing the package managers to their caches in the partition.
+func (c *Cache) env() (env []string) {
+	if c == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(toolCaches))
+	for name := range toolCaches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(c.dir(), toolCaches[name])
+		// Mark the cache as used for eviction.
+		_ = os.MkdirAll(path, 0o700)
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		env = append(env, name+"="+path)
+	}
+
+	return env
+}
+
+// use marks the cache as used by a synthesis until the returned function is called, which also
+// evicts entries if the cache grew too large.
+func (c *Cache) use(logger logr.Logger) (done func()) {
+	if c == nil {
+		return func() {}
+	}
+
+	c.state.lock.RLock()
+
+	return func() {
+		c.state.lock.RUnlock()
+		if err := c.evict(); err != nil {
+			logger.Error(err, "Failed to evict dependency cache entries")
+		}
+	}
+}
+
+// nodeModulesKey returns the cache key of the node_modules installed by the command in apiPath,
+// or false if the app has no lockfile and its installs are not reproducible.
+func nodeModulesKey(apiPath, name string, args []string) (key string, ok bool) {
+	hash := sha256.New()
+	_, _ = io.WriteString(hash, stepName(name, args)+"\n")
+
+	for _, lockfile := range nodeLockfiles {
+		content, err := os.ReadFile(filepath.Join(apiPath, lockfile))
+		if err != nil {
+			continue
+		}
+		_, _ = io.WriteString(hash, lockfile+"\n")
+		_, _ = hash.Write(content)
+		ok = true
+	}
+	if !ok {
+		return "", false
+	}
+
+	if content, err := os.ReadFile(filepath.Join(apiPath, "package.json")); err == nil {
+		_, _ = hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// restoreNodeModules copies the cached node_modules of key into apiPath and reports whether the
+// cache held them.
+func (c *Cache) restoreNodeModules(key, apiPath string, logger logr.Logger) bool {
+	if c == nil {
+		return false
+	}
+
+	entry := filepath.Join(c.dir(), nodeModulesCacheDir, key)
+	if _, err := os.Stat(entry); err != nil {
+		return false
+	}
+
+	target := filepath.Join(apiPath, "node_modules")
+	if err := copyTree(entry, target); err != nil {
+		logger.Error(err, "Failed to restore node modules from the cache", "key", key)
+		_ = os.RemoveAll(target)
+
+		return false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(entry, now, now)
+
+	return true
+}
+
+// storeNodeModules adds the node_modules in apiPath to the cache under key. Concurrent stores of
+// the same key keep the first one.
+func (c *Cache) storeNodeModules(key, apiPath string, logger logr.Logger) {
+	if c == nil {
+		return
+	}
+
+	entry := filepath.Join(c.dir(), nodeModulesCacheDir, key)
+	if _, err := os.Stat(entry); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(entry), 0o700); err != nil {
+		logger.Error(err, "Failed to store node modules in the cache", "key", key)
+
+		return
+	}
+
+	staging := entry + ".tmp-" + utilrand.String(8)
+	if err := copyTree(filepath.Join(apiPath, "node_modules"), staging); err != nil {
+		logger.Error(err, "Failed to store node modules in the cache", "key", key)
+		_ = removeTree(staging)
+
+		return
+	}
+	if err := os.Rename(staging, entry); err != nil {
+		_ = removeTree(staging)
+	}
+}
+
+// evict removes the least recently used entries of all partitions until the cache fits MaxBytes.
+// It runs at most once per evictInterval and waits for running syntheses to release the cache.
+func (c *Cache) evict() (err error) {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+
+	c.state.evictLock.Lock()
+	defer c.state.evictLock.Unlock()
+	if time.Since(c.state.lastEvict) < evictInterval {
+		return nil
+	}
+	c.state.lastEvict = time.Now()
+
+	c.state.lock.Lock()
+	defer c.state.lock.Unlock()
+
+	type cacheEntry struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+
+	partitions, err := os.ReadDir(filepath.Join(c.Dir, namespacesCacheDir))
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, partition := range partitions {
+		partitionDir := filepath.Join(c.Dir, namespacesCacheDir, partition.Name())
+		nodeEntries, err := os.ReadDir(filepath.Join(partitionDir, nodeModulesCacheDir))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, nodeEntry := range nodeEntries {
+			paths = append(paths, filepath.Join(partitionDir, nodeModulesCacheDir, nodeEntry.Name()))
+		}
+		for _, dir := range cacheToolDirs() {
+			paths = append(paths, filepath.Join(partitionDir, dir))
+		}
+	}
+
+	var total int64
+	entries := make([]cacheEntry, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		size, err := treeSize(path)
+		if err != nil {
+			return err
+		}
+		total += size
+		entries = append(entries, cacheEntry{path: path, size: size, lastUse: info.ModTime()})
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].lastUse.Before(entries[b].lastUse)
+	})
+	for _, entry := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err = removeTree(entry.path); err != nil {
+			return err
+		}
+		total -= entry.size
+	}
+
+	return nil
+}
+
+// cacheToolDirs returns the cache directories of the package managers.
+func cacheToolDirs() (dirs []string) {
+	for _, dir := range toolCaches {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+// copyTree copies the directory src to dst, keeping file modes and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relative)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode fs.FileMode) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+
+		return err
+	}
+
+	return out.Close()
+}
+
+// treeSize returns the size of the regular files below path.
+func treeSize(path string) (size int64, err error) {
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// removeTree removes path, making directories writable first, as the Go module cache is read-only.
+func removeTree(path string) error {
+	_ = filepath.WalkDir(path, func(dir string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			_ = os.Chmod(dir, 0o700)
+		}
+
+		return nil
+	})
+
+	return os.RemoveAll(path)
+}
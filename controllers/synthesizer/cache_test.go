@@ -0,0 +1,132 @@
+package synthesizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeModulesKey(t *testing.T) {
+	apiPath := t.TempDir()
+
+	_, ok := nodeModulesKey(apiPath, "npm", []string{"install"})
+	assert.False(t, ok)
+
+	writeFiles(t, apiPath, map[string]string{"package-lock.json": `{"lockfileVersion": 3}`})
+	key, ok := nodeModulesKey(apiPath, "npm", []string{"ci"})
+	assert.True(t, ok)
+
+	same, _ := nodeModulesKey(apiPath, "npm", []string{"ci"})
+	assert.Equal(t, key, same)
+
+	writeFiles(t, apiPath, map[string]string{"package-lock.json": `{"lockfileVersion": 2}`})
+	changed, _ := nodeModulesKey(apiPath, "npm", []string{"ci"})
+	assert.NotEqual(t, key, changed)
+}
+
+func TestInstallNodeModulesCache(t *testing.T) {
+	binDir := t.TempDir()
+	npm := "#!/bin/sh\necho \"npm $*\" >> \"$NPM_LOG\"\nmkdir -p node_modules/cdk8s node_modules/.bin\necho 'module.exports = {}' > node_modules/cdk8s/index.js\nln -s ../cdk8s/index.js node_modules/.bin/cdk8s\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "npm"), []byte(npm), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	npmLog := filepath.Join(t.TempDir(), "npm.log")
+	t.Setenv("NPM_LOG", npmLog)
+
+	cache, err := NewCache(t.TempDir(), 0)
+	assert.NoError(t, err)
+	impl := &Implementer{Cache: cache}
+
+	install := func() string {
+		apiPath := t.TempDir()
+		writeFiles(t, apiPath, map[string]string{"package.json": "{}", "package-lock.json": "{}"})
+		_, err := impl.installDependencies(context.Background(), apiPath, string(cdk8sTypescript), cdk8sConfig{}, addonsv1alpha1.ToolchainSpec{}, os.Environ(), logr.Discard())
+		assert.NoError(t, err)
+
+		return apiPath
+	}
+
+	install()
+	apiPath := install()
+
+	log, err := os.ReadFile(npmLog)
+	assert.NoError(t, err)
+	assert.Equal(t, "npm ci\n", string(log))
+
+	content, err := os.ReadFile(filepath.Join(apiPath, "node_modules", ".bin", "cdk8s"))
+	assert.NoError(t, err)
+	assert.Equal(t, "module.exports = {}\n", string(content))
+}
+
+func TestCacheEnv(t *testing.T) {
+	assert.Empty(t, (*Cache)(nil).env())
+
+	cache, err := NewCache(t.TempDir(), 0)
+	assert.NoError(t, err)
+	partition := filepath.Join(cache.Dir, "namespaces", "team-a")
+	assert.Equal(t, []string{
+		"GOCACHE=" + filepath.Join(partition, "go", "build"),
+		"GOMODCACHE=" + filepath.Join(partition, "go", "mod"),
+		"PIP_CACHE_DIR=" + filepath.Join(partition, "pip"),
+		"npm_config_cache=" + filepath.Join(partition, "npm"),
+	}, cache.forNamespace("team-a").env())
+	assert.DirExists(t, filepath.Join(partition, "go", "mod"))
+}
+
+func TestCacheEvict(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), 2500)
+	assert.NoError(t, err)
+
+	entry := func(path string, size int, age time.Duration) {
+		path = filepath.Join(cache.Dir, "namespaces", path)
+		assert.NoError(t, os.MkdirAll(path, 0o700))
+		assert.NoError(t, os.WriteFile(filepath.Join(path, "data"), []byte(strings.Repeat("x", size)), 0o400))
+		// The Go module cache is read-only.
+		assert.NoError(t, os.Chmod(path, 0o500))
+		modified := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	entry("team-a/node_modules/old", 1000, 3*time.Hour)
+	entry("team-b/go/mod/example.com/module@v1.0.0", 1000, 0)
+	entry("team-a/node_modules/recent", 1000, time.Hour)
+	entry("team-b/node_modules/new", 1000, time.Minute)
+	modified := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(cache.Dir, "namespaces", "team-b", "go", "mod"), modified, modified))
+
+	assert.NoError(t, cache.evict())
+
+	for path, exists := range map[string]bool{
+		"team-a/node_modules/old":    false,
+		"team-b/go/mod":              false,
+		"team-a/node_modules/recent": true,
+		"team-b/node_modules/new":    true,
+	} {
+		_, err := os.Stat(filepath.Join(cache.Dir, "namespaces", path))
+		assert.Equal(t, exists, err == nil, path)
+	}
+
+	// Evictions are rate limited.
+	entry("team-a/node_modules/other", 1000, 4*time.Hour)
+	assert.NoError(t, cache.evict())
+	assert.DirExists(t, filepath.Join(cache.Dir, "namespaces", "team-a", "node_modules", "other"))
+}
+
+func TestSynthesizeCachePartitions(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "echo \"$GOMODCACHE\" > gomodcache.txt\nmkdir -p dist\n")
+	proxy.Namespace = "team-a"
+	cache, err := NewCache(t.TempDir(), 0)
+	assert.NoError(t, err)
+
+	_, err = (&Implementer{Cache: cache}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+
+	gomodcache, err := os.ReadFile(filepath.Join(directory, "gomodcache.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cache.Dir, "namespaces", "team-a", "go", "mod")+"\n", string(gomodcache))
+}
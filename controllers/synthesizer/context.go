@@ -0,0 +1,169 @@
+package synthesizer
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+const (
+	// ContextEnv is the environment variable holding the JSON encoded cdk8s context of a synth run.
+	// Apps read it and set its entries as context, e.g. with app.node.setContext.
+	ContextEnv = "CDK8S_CONTEXT_JSON"
+
+	// ClusterContextKey is the cdk8s context key of the cluster an app is synthesized for.
+	ClusterContextKey = "cluster"
+
+	// ValuesContextKey is the cdk8s context key of the input values of an app.
+	ValuesContextKey = "values"
+
+	// ValuesEnv is the environment variable holding the JSON encoded input values of an app.
+	ValuesEnv = "CDK8S_VALUES"
+)
+
+// ClusterInfo describes the cluster an app is synthesized for in per-cluster synthesis.
+type ClusterInfo struct {
+	Name                 string                     `json:"name"`
+	Namespace            string                     `json:"namespace"`
+	Labels               map[string]string          `json:"labels,omitempty"`
+	Annotations          map[string]string          `json:"annotations,omitempty"`
+	KubernetesVersion    string                     `json:"kubernetesVersion,omitempty"`
+	Variables            map[string]json.RawMessage `json:"variables,omitempty"`
+	PodCIDRs             []string                   `json:"podCIDRs,omitempty"`
+	ServiceCIDRs         []string                   `json:"serviceCIDRs,omitempty"`
+	ControlPlaneEndpoint string                     `json:"controlPlaneEndpoint,omitempty"`
+}
+
+// NewClusterInfo collects the information of the cluster handed to the app.
+func NewClusterInfo(cluster *clusterv1.Cluster) (info ClusterInfo) {
+	info = ClusterInfo{
+		Name:              cluster.Name,
+		Namespace:         cluster.Namespace,
+		Labels:            cluster.Labels,
+		Annotations:       cluster.Annotations,
+		KubernetesVersion: cluster.Spec.Topology.Version,
+		PodCIDRs:          cluster.Spec.ClusterNetwork.Pods.CIDRBlocks,
+		ServiceCIDRs:      cluster.Spec.ClusterNetwork.Services.CIDRBlocks,
+	}
+
+	for _, variable := range cluster.Spec.Topology.Variables {
+		if info.Variables == nil {
+			info.Variables = make(map[string]json.RawMessage)
+		}
+		info.Variables[variable.Name] = json.RawMessage(variable.Value.Raw)
+		if len(variable.Value.Raw) == 0 {
+			info.Variables[variable.Name] = json.RawMessage("null")
+		}
+	}
+
+	if endpoint := cluster.Spec.ControlPlaneEndpoint; endpoint.Host != "" {
+		info.ControlPlaneEndpoint = endpoint.Host
+		if endpoint.Port != 0 {
+			info.ControlPlaneEndpoint += ":" + strconv.Itoa(int(endpoint.Port))
+		}
+	}
+
+	return info
+}
+
+// Env returns the environment variables exposing the cluster to the app.
+func (c ClusterInfo) Env() (env map[string]string, err error) {
+	env = map[string]string{
+		"CDK8S_CLUSTER_NAME":                   c.Name,
+		"CDK8S_CLUSTER_NAMESPACE":              c.Namespace,
+		"CDK8S_CLUSTER_KUBERNETES_VERSION":     c.KubernetesVersion,
+		"CDK8S_CLUSTER_POD_CIDRS":              strings.Join(c.PodCIDRs, ","),
+		"CDK8S_CLUSTER_SERVICE_CIDRS":          strings.Join(c.ServiceCIDRs, ","),
+		"CDK8S_CLUSTER_CONTROL_PLANE_ENDPOINT": c.ControlPlaneEndpoint,
+	}
+
+	for name, value := range map[string]any{
+		"CDK8S_CLUSTER_LABELS":      c.Labels,
+		"CDK8S_CLUSTER_ANNOTATIONS": c.Annotations,
+		"CDK8S_CLUSTER_VARIABLES":   c.Variables,
+	} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = string(encoded)
+	}
+
+	return env, nil
+}
+
+// WithCluster hands the cluster to the app as context and environment variables.
+func (i *Implementer) WithCluster(info ClusterInfo) (err error) {
+	env, err := info.Env()
+	if err != nil {
+		return err
+	}
+	i.setContext(ClusterContextKey, info, env)
+
+	return nil
+}
+
+// WithValues hands the input values to the app as context and environment variable.
+// Nil values are not handed to the app.
+func (i *Implementer) WithValues(values map[string]any) (err error) {
+	if values == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	i.setContext(ValuesContextKey, values, map[string]string{ValuesEnv: string(encoded)})
+
+	return nil
+}
+
+// setContext adds the context entry and environment variables to the synth run.
+func (i *Implementer) setContext(key string, value any, env map[string]string) {
+	if i.Context == nil {
+		i.Context = make(map[string]any)
+	}
+	if i.Env == nil {
+		i.Env = make(map[string]string, len(env))
+	}
+
+	i.Context[key] = value
+	for name, v := range env {
+		i.Env[name] = v
+	}
+}
+
+// environ returns the environment of the synth steps: the scrubbed environment of the controller
+// with HOME and the temp dir in the sandbox, extended by the dependency cache, registryEnv, the
+// offline settings, the environment variables and the JSON encoded context of the Implementer.
+// registryEnv is only passed for the install steps.
+func (i *Implementer) environ(s *sandbox, registryEnv []string) (environ []string, err error) {
+	environ = append(scrubbedEnviron(s), i.Cache.env()...)
+	environ = append(environ, registryEnv...)
+	if i.Offline {
+		environ = append(environ, offlineEnv()...)
+	}
+
+	names := make([]string, 0, len(i.Env))
+	for name := range i.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		environ = append(environ, name+"="+i.Env[name])
+	}
+
+	if len(i.Context) > 0 {
+		encoded, err := json.Marshal(i.Context)
+		if err != nil {
+			return nil, err
+		}
+		environ = append(environ, ContextEnv+"="+string(encoded))
+	}
+
+	return environ, nil
+}
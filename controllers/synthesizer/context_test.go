@@ -0,0 +1,91 @@
+package synthesizer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+func TestNewClusterInfo(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "prod-eu",
+			Namespace:   "fleet",
+			Labels:      map[string]string{"env": "prod"},
+			Annotations: map[string]string{"owner": "team-a"},
+		},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "10.0.0.1", Port: 6443},
+			ClusterNetwork: clusterv1.ClusterNetwork{
+				Pods:     clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+				Services: clusterv1.NetworkRanges{CIDRBlocks: []string{"10.96.0.0/12", "fd00::/108"}},
+			},
+			Topology: clusterv1.Topology{
+				Version: "v1.33.1",
+				Variables: []clusterv1.ClusterVariable{
+					{Name: "region", Value: apiextensionsv1.JSON{Raw: []byte(`"eu-west-1"`)}},
+					{Name: "empty"},
+				},
+			},
+		},
+	}
+
+	info := NewClusterInfo(cluster)
+	assert.Equal(t, "10.0.0.1:6443", info.ControlPlaneEndpoint)
+	assert.Equal(t, json.RawMessage(`"eu-west-1"`), info.Variables["region"])
+	assert.Equal(t, json.RawMessage("null"), info.Variables["empty"])
+
+	env, err := info.Env()
+	assert.NoError(t, err)
+	assert.Equal(t, "prod-eu", env["CDK8S_CLUSTER_NAME"])
+	assert.Equal(t, "fleet", env["CDK8S_CLUSTER_NAMESPACE"])
+	assert.Equal(t, "v1.33.1", env["CDK8S_CLUSTER_KUBERNETES_VERSION"])
+	assert.Equal(t, "192.168.0.0/16", env["CDK8S_CLUSTER_POD_CIDRS"])
+	assert.Equal(t, "10.96.0.0/12,fd00::/108", env["CDK8S_CLUSTER_SERVICE_CIDRS"])
+	assert.Equal(t, `{"env":"prod"}`, env["CDK8S_CLUSTER_LABELS"])
+	assert.Equal(t, `{"empty":null,"region":"eu-west-1"}`, env["CDK8S_CLUSTER_VARIABLES"])
+}
+
+func TestSynthesizeWithContext(t *testing.T) {
+	tempDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempDir, "deployments", "dist"), 0755))
+	_, err := os.Create(filepath.Join(tempDir, "main.go"))
+	assert.NoError(t, err)
+
+	// The fake cdk8s writes a ConfigMap named after the cluster and stores the context next to it.
+	fakeBinDir := t.TempDir()
+	script := `#!/bin/sh
+printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n' "$CDK8S_CLUSTER_NAME" > dist/cm.yaml
+printf '%s' "$CDK8S_CONTEXT_JSON" > context.json
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(fakeBinDir, "cdk8s"), []byte(script), 0755))
+	t.Setenv("PATH", fakeBinDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cdk8sAppProxy := &addonsv1alpha1.Cdk8sAppProxy{
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			GitRepository: &addonsv1alpha1.GitRepositorySpec{Path: "deployments"},
+		},
+	}
+	impl := &Implementer{}
+	assert.NoError(t, impl.WithCluster(ClusterInfo{Name: "prod-eu", Namespace: "fleet"}))
+	assert.NoError(t, impl.WithValues(map[string]any{"replicas": 2}))
+	assert.Equal(t, `{"replicas":2}`, impl.Env[ValuesEnv])
+
+	parsed, err := impl.Synthesize(tempDir, cdk8sAppProxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, parsed, 1)
+	assert.Equal(t, "prod-eu", parsed[0].GetName())
+
+	encoded, err := os.ReadFile(filepath.Join(tempDir, "deployments", "context.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cluster":{"name":"prod-eu","namespace":"fleet"},"values":{"replicas":2}}`, string(encoded))
+}
@@ -0,0 +1,36 @@
+package synthesizer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// cueRenderer exports the CUE package in the app path with the cue binary of the controller image.
+type cueRenderer struct{}
+
+func (cueRenderer) Render(ctx context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error) {
+	outFile := filepath.Join(app.TempDir, "cue-export.json")
+	if err = app.Run(ctx, logger, "cue", "export", "--out", "json", "--outfile", outFile, "--force"); err != nil {
+		return nil, err
+	}
+	if err = app.implementer.Limits.checkFileSize("cue export", outFile); err != nil {
+		return nil, err
+	}
+
+	output, err := os.ReadFile(outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err = json.Unmarshal(output, &value); err != nil {
+		return nil, err
+	}
+
+	return chartsFromValue(app, value)
+}
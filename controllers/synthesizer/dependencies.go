@@ -0,0 +1,371 @@
+package synthesizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// virtualenvDir is the per-app Python virtualenv, created within the app path.
+const virtualenvDir = ".venv"
+
+// cdk8sConfig holds the fields of cdk8s.yaml the synthesizer relies on.
+type cdk8sConfig struct {
+	Language string `json:"language,omitempty"`
+	App      string `json:"app,omitempty"`
+}
+
+// readCdk8sConfig reads cdk8s.yaml in the app path. A missing file results in an empty config.
+func readCdk8sConfig(apiPath string) (config cdk8sConfig, err error) {
+	content, err := os.ReadFile(filepath.Join(apiPath, "cdk8s.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+
+		return config, err
+	}
+
+	if err = yaml.Unmarshal(content, &config); err != nil {
+		return config, errors.Wrap(err, "failed to parse cdk8s.yaml")
+	}
+
+	return config, nil
+}
+
+// appCommand returns the first word of the app command of cdk8s.yaml, e.g. "pipenv" or "mvn".
+func (c cdk8sConfig) appCommand() string {
+	fields := strings.Fields(c.App)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return filepath.Base(fields[0])
+}
+
+// installDependencies installs the dependencies of the app in apiPath for its language. It returns
+// environment variables the synth run needs to find them, e.g. to use the virtualenv of a Python app.
+func (i *Implementer) installDependencies(ctx context.Context, apiPath, kind string, config cdk8sConfig, toolchain addonsv1alpha1.ToolchainSpec, environ []string, logger logr.Logger) (env map[string]string, err error) {
+	switch ApplicationType(kind) {
+	case cdk8sTypescript:
+		return nil, i.installNodeModules(ctx, apiPath, toolchain.PackageManager, environ, logger)
+	case cdk8sPython:
+		return i.installPythonDependencies(ctx, apiPath, config, environ, logger)
+	case cdk8sJava:
+		return i.installJavaDependencies(ctx, apiPath, config, environ, logger)
+	case cdk8sGo:
+		// Go modules are resolved by the synth run. Offline, they come from vendor or the cache.
+		if i.Offline && i.Cache == nil && !fileExists(apiPath, filepath.Join("vendor", "modules.txt")) {
+			return nil, &OfflineError{Language: kind, Missing: "no vendor directory and no dependency cache"}
+		}
+		// Modules of private registries are downloaded with their credentials before the synth run.
+		if !i.Offline && hasGoRegistry(i.Registries) && fileExists(apiPath, "go.mod") {
+			return nil, i.runStep(ctx, apiPath, environ, logger, "go", "mod", "download")
+		}
+	}
+
+	return nil, nil
+}
+
+// installNodeModules installs the node modules of a TypeScript app, restoring them from the cache if
+// its lockfile was installed before and adding them to the cache otherwise. Offline, vendored node
+// modules are used as they are.
+func (i *Implementer) installNodeModules(ctx context.Context, apiPath string, packageManager addonsv1alpha1.PackageManager, environ []string, logger logr.Logger) (err error) {
+	if i.Offline {
+		vendored, err := vendorNodeModules(apiPath, logger)
+		if vendored || err != nil {
+			return err
+		}
+	}
+
+	name, args := nodeInstallCommand(apiPath, packageManager)
+
+	key, cacheable := nodeModulesKey(apiPath, name, args)
+	if cacheable && i.Cache.restoreNodeModules(key, apiPath, logger) {
+		logger.Info("Restored node modules from the dependency cache", "key", key)
+
+		return nil
+	}
+	if i.Offline && i.Cache == nil {
+		return &OfflineError{Language: string(cdk8sTypescript), Missing: "no node_modules, no node_modules.tar.gz and no dependency cache"}
+	}
+
+	if err = i.runStep(ctx, apiPath, environ, logger, name, args...); err != nil {
+		return err
+	}
+	if cacheable {
+		i.Cache.storeNodeModules(key, apiPath, logger)
+	}
+
+	return nil
+}
+
+// nodeInstallCommand returns the command installing the node modules of a TypeScript app. Without a
+// package manager, the one of the lockfile in the app path is used, falling back to npm. Installs with
+// a lockfile respect it and fail instead of updating it.
+func nodeInstallCommand(apiPath string, packageManager addonsv1alpha1.PackageManager) (name string, args []string) {
+	if packageManager == "" {
+		switch {
+		case fileExists(apiPath, "pnpm-lock.yaml"):
+			packageManager = addonsv1alpha1.PackageManagerPnpm
+		case fileExists(apiPath, "yarn.lock"):
+			packageManager = addonsv1alpha1.PackageManagerYarn
+		default:
+			packageManager = addonsv1alpha1.PackageManagerNpm
+		}
+	}
+
+	switch packageManager {
+	case addonsv1alpha1.PackageManagerPnpm:
+		if fileExists(apiPath, "pnpm-lock.yaml") {
+			return "pnpm", []string{"install", "--frozen-lockfile"}
+		}
+
+		return "pnpm", []string{"install"}
+	case addonsv1alpha1.PackageManagerYarn:
+		if fileExists(apiPath, "yarn.lock") {
+			return "yarn", []string{"install", "--frozen-lockfile"}
+		}
+
+		return "yarn", []string{"install"}
+	default:
+		if fileExists(apiPath, "package-lock.json") || fileExists(apiPath, "npm-shrinkwrap.json") {
+			return "npm", []string{"ci"}
+		}
+
+		return "npm", []string{"install"}
+	}
+}
+
+// synthCommand returns the command synthesizing the app: the cdk8s binary of the controller image,
+// or the configured cdk8s-cli version run through npx.
+func synthCommand(toolchain addonsv1alpha1.ToolchainSpec) (name string, args []string) {
+	if toolchain.Cdk8sCLIVersion != "" {
+		return "npx", []string{"--yes", "cdk8s-cli@" + toolchain.Cdk8sCLIVersion, "synth"}
+	}
+
+	return "cdk8s", []string{"synth"}
+}
+
+// installPythonDependencies installs the dependencies of a Python app into a virtualenv within the
+// app path. The tool is taken from the app command of cdk8s.yaml, falling back to the files present:
+// Pipfile for pipenv, a pyproject.toml with a [tool.poetry] section for poetry and requirements.txt for pip.
+func (i *Implementer) installPythonDependencies(ctx context.Context, apiPath string, config cdk8sConfig, environ []string, logger logr.Logger) (env map[string]string, err error) {
+	tool := config.appCommand()
+	switch {
+	case tool == "pipenv" || tool == "poetry":
+	case fileExists(apiPath, "Pipfile"):
+		tool = "pipenv"
+	case isPoetryProject(apiPath):
+		tool = "poetry"
+	case fileExists(apiPath, "requirements.txt"):
+		tool = "pip"
+	default:
+		logger.Info("No Python dependency file found, skipping installation", "path", apiPath)
+
+		return nil, nil
+	}
+
+	if i.Offline {
+		if !dirExists(apiPath, wheelhouseDir) {
+			return nil, &OfflineError{Language: string(cdk8sPython), Missing: "no " + wheelhouseDir + " directory"}
+		}
+		environ = withEnv(environ, map[string]string{"PIP_FIND_LINKS": filepath.Join(apiPath, wheelhouseDir)})
+	}
+
+	venv := filepath.Join(apiPath, virtualenvDir)
+	switch tool {
+	case "pipenv":
+		env = map[string]string{"PIPENV_VENV_IN_PROJECT": "1"}
+
+		return env, i.runStep(ctx, apiPath, withEnv(environ, env), logger, "pipenv", "install")
+	case "poetry":
+		env = map[string]string{"POETRY_VIRTUALENVS_IN_PROJECT": "true"}
+
+		return env, i.runStep(ctx, apiPath, withEnv(environ, env), logger, "poetry", "install", "--no-root")
+	default:
+		if err = i.runStep(ctx, apiPath, environ, logger, "python3", "-m", "venv", virtualenvDir); err != nil {
+			return nil, err
+		}
+		if err = i.runStep(ctx, apiPath, environ, logger, filepath.Join(venv, "bin", "pip"), "install", "-r", "requirements.txt"); err != nil {
+			return nil, err
+		}
+
+		// Activate the virtualenv for the app command, e.g. "python main.py".
+		env = map[string]string{
+			"VIRTUAL_ENV": venv,
+			"PATH":        filepath.Join(venv, "bin") + string(os.PathListSeparator) + os.Getenv("PATH"),
+		}
+
+		return env, nil
+	}
+}
+
+// installJavaDependencies compiles a Java app with its dependencies. The build tool is taken from the
+// app command of cdk8s.yaml, falling back to pom.xml for Maven and build.gradle(.kts) for Gradle.
+// The Gradle wrapper of the app is preferred over an installed Gradle. Offline, the build tools use the
+// repository vendored in the app path, .m2/repository for Maven and .gradle for Gradle.
+func (i *Implementer) installJavaDependencies(ctx context.Context, apiPath string, config cdk8sConfig, environ []string, logger logr.Logger) (env map[string]string, err error) {
+	tool := config.appCommand()
+	switch {
+	case tool == "mvn" || tool == "gradle" || tool == "gradlew":
+	case fileExists(apiPath, "pom.xml"):
+		tool = "mvn"
+	case fileExists(apiPath, "build.gradle") || fileExists(apiPath, "build.gradle.kts"):
+		tool = "gradle"
+	default:
+		logger.Info("No Java build file found, skipping installation", "path", apiPath)
+
+		return nil, nil
+	}
+
+	if tool == "mvn" {
+		if i.Offline {
+			repository := filepath.Join(".m2", "repository")
+			if !dirExists(apiPath, repository) {
+				return nil, &OfflineError{Language: string(cdk8sJava), Missing: "no " + repository + " directory"}
+			}
+			// MAVEN_ARGS also applies to the Maven runs of the app command.
+			env = map[string]string{
+				"MAVEN_ARGS": "--offline",
+				"MAVEN_OPTS": "-Dmaven.repo.local=" + filepath.Join(apiPath, repository),
+			}
+		}
+
+		return env, i.runStep(ctx, apiPath, withEnv(environ, env), logger, "mvn", "--batch-mode", "compile")
+	}
+
+	gradle := "gradle"
+	if fileExists(apiPath, "gradlew") {
+		gradle = "./gradlew"
+	}
+
+	args := []string{"--no-daemon", "classes"}
+	if i.Offline {
+		if !dirExists(apiPath, ".gradle") {
+			return nil, &OfflineError{Language: string(cdk8sJava), Missing: "no .gradle directory"}
+		}
+		env = map[string]string{"GRADLE_USER_HOME": filepath.Join(apiPath, ".gradle")}
+		args = append(args, "--offline")
+	}
+
+	return env, i.runStep(ctx, apiPath, withEnv(environ, env), logger, gradle, args...)
+}
+
+// runStep runs a command in dir within the Limits of the Implementer. A failing step is reported as
+// StepError with the tail of its output and the compiler errors in it, wrapping a LimitError if the
+// step exceeded one of the Limits.
+func (i *Implementer) runStep(ctx context.Context, dir string, environ []string, logger logr.Logger, name string, args ...string) (err error) {
+	return i.runOutputStep(ctx, dir, environ, "", logger, name, args...)
+}
+
+// runOutputStep runs a step like runStep. If outputDir is set, the step is killed with a LimitError
+// once the files below outputDir exceed MaxOutputBytes.
+func (i *Implementer) runOutputStep(ctx context.Context, dir string, environ []string, outputDir string, logger logr.Logger, name string, args ...string) (err error) {
+	step := stepName(name, args)
+
+	stepCtx, kill := context.WithCancel(ctx)
+	defer kill()
+	if i.Limits.StepTimeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(stepCtx, i.Limits.StepTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(stepCtx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = environ
+	// Do not wait for descendants holding the output open after the step was killed.
+	cmd.WaitDelay = 10 * time.Second
+	output := &tailBuffer{limit: stepOutputTail}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	limits, err := i.Limits.prepare(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set up limits of %s", step)
+	}
+	defer limits.close()
+	if i.Offline && !isolateNetwork(cmd) {
+		if !i.OfflineEnvOnly {
+			return errors.Errorf("network namespaces are not available to isolate the offline step %s", step)
+		}
+		logger.V(1).Info("Network namespaces are not available, the offline step is only kept offline by its environment", "step", step)
+	}
+
+	if err = cmd.Start(); err != nil {
+		return errors.Wrapf(err, "%s failed", step)
+	}
+
+	var exceededSize atomic.Int64
+	if outputDir != "" && i.Limits.MaxOutputBytes > 0 {
+		watchCtx, stopWatch := context.WithCancel(stepCtx)
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			watchOutputSize(watchCtx, outputDir, outputPollInterval, i.Limits.MaxOutputBytes, &exceededSize, kill)
+		}()
+		defer func() {
+			stopWatch()
+			<-watched
+		}()
+	}
+
+	err = cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	logger.Error(err, "Failed to run "+filepath.Base(name), "args", args, "output", output.String())
+
+	switch {
+	case exceededSize.Load() > 0:
+		err = &LimitError{Step: step, Limit: fmt.Sprintf("output size of %d bytes with %d bytes", i.Limits.MaxOutputBytes, exceededSize.Load())}
+	case errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		err = &LimitError{Step: step, Limit: fmt.Sprintf("timeout of %s", i.Limits.StepTimeout)}
+	case cmd.ProcessState != nil && limits.exceeded(cmd.ProcessState) != "":
+		err = &LimitError{Step: step, Limit: limits.exceeded(cmd.ProcessState)}
+	}
+
+	return &StepError{Step: step, Err: err, Output: output.String(), Diagnostics: parseDiagnostics(output.String())}
+}
+
+// withEnv returns environ extended by env. A nil environ stands for the environment of the controller.
+func withEnv(environ []string, env map[string]string) []string {
+	if len(env) == 0 {
+		return environ
+	}
+	if environ == nil {
+		environ = os.Environ()
+	}
+
+	extended := append([]string{}, environ...)
+	for name, value := range env {
+		extended = append(extended, name+"="+value)
+	}
+
+	return extended
+}
+
+// isPoetryProject reports whether the app path holds a pyproject.toml managed by poetry.
+func isPoetryProject(apiPath string) bool {
+	content, err := os.ReadFile(filepath.Join(apiPath, "pyproject.toml"))
+
+	return err == nil && strings.Contains(string(content), "[tool.poetry]")
+}
+
+// fileExists reports whether the regular file name exists in dir.
+func fileExists(dir, name string) bool {
+	info, err := os.Stat(filepath.Join(dir, name))
+
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,184 @@
+package synthesizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTools puts fake binaries into PATH which append their name and arguments to tools.log in
+// their working directory. The fake python3 creates a virtualenv with a fake pip.
+func fakeTools(t *testing.T) {
+	t.Helper()
+
+	binDir := t.TempDir()
+	record := "#!/bin/sh\necho \"$(basename \"$0\") $*\" >> tools.log\n"
+	for _, tool := range []string{"npm", "pipenv", "poetry", "mvn", "gradle"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(binDir, tool), []byte(record), 0755))
+	}
+	python := record + "mkdir -p .venv/bin\nprintf '" + strings.ReplaceAll(record, "\n", "\\n") + "' > .venv/bin/pip\nchmod +x .venv/bin/pip\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "python3"), []byte(python), 0755))
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestInstallDependencies(t *testing.T) {
+	fakeTools(t)
+
+	tests := []struct {
+		name    string
+		kind    ApplicationType
+		files   map[string]string
+		config  cdk8sConfig
+		wantLog string
+		wantEnv map[string]string
+		// wantVenv expects the environment activating the virtualenv of the app.
+		wantVenv bool
+	}{
+		{
+			name:    "pipenv from app command",
+			kind:    cdk8sPython,
+			files:   map[string]string{"requirements.txt": ""},
+			config:  cdk8sConfig{App: "pipenv run python main.py"},
+			wantLog: "pipenv install\n",
+			wantEnv: map[string]string{"PIPENV_VENV_IN_PROJECT": "1"},
+		},
+		{
+			name:    "poetry from pyproject.toml",
+			kind:    cdk8sPython,
+			files:   map[string]string{"pyproject.toml": "[tool.poetry]\nname = \"app\"\n"},
+			wantLog: "poetry install --no-root\n",
+			wantEnv: map[string]string{"POETRY_VIRTUALENVS_IN_PROJECT": "true"},
+		},
+		{
+			name:     "pip into a virtualenv",
+			kind:     cdk8sPython,
+			files:    map[string]string{"requirements.txt": "cdk8s\n"},
+			config:   cdk8sConfig{App: "python main.py"},
+			wantLog:  "python3 -m venv .venv\npip install -r requirements.txt\n",
+			wantVenv: true,
+		},
+		{
+			name:    "maven from pom.xml",
+			kind:    cdk8sJava,
+			files:   map[string]string{"pom.xml": "<project/>"},
+			wantLog: "mvn --batch-mode compile\n",
+		},
+		{
+			name:    "gradle from app command",
+			kind:    cdk8sJava,
+			files:   map[string]string{"build.gradle.kts": ""},
+			config:  cdk8sConfig{App: "gradle run"},
+			wantLog: "gradle --no-daemon classes\n",
+		},
+		{
+			name:  "no python dependency files",
+			kind:  cdk8sPython,
+			files: map[string]string{"main.py": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiPath := t.TempDir()
+			for name, content := range tt.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(apiPath, name), []byte(content), 0644))
+			}
+
+			env, err := (&Implementer{}).installDependencies(context.Background(), apiPath, string(tt.kind), tt.config, addonsv1alpha1.ToolchainSpec{}, nil, logr.Discard())
+			assert.NoError(t, err)
+
+			log, _ := os.ReadFile(filepath.Join(apiPath, "tools.log"))
+			assert.Equal(t, tt.wantLog, string(log))
+
+			if tt.wantVenv {
+				assert.Equal(t, filepath.Join(apiPath, ".venv"), env["VIRTUAL_ENV"])
+				assert.True(t, strings.HasPrefix(env["PATH"], filepath.Join(apiPath, ".venv", "bin")))
+
+				return
+			}
+			assert.Equal(t, tt.wantEnv, env)
+		})
+	}
+}
+
+func TestInstallDependenciesFailure(t *testing.T) {
+	binDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "mvn"), []byte("#!/bin/sh\necho 'BUILD FAILURE'\nexit 1\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	apiPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(apiPath, "pom.xml"), []byte("<project/>"), 0644))
+
+	_, err := (&Implementer{}).installDependencies(context.Background(), apiPath, string(cdk8sJava), cdk8sConfig{}, addonsv1alpha1.ToolchainSpec{}, nil, logr.Discard())
+	assert.ErrorContains(t, err, "mvn --batch-mode compile failed")
+	assert.Equal(t, "BUILD FAILURE", OutputTail(err, 5))
+}
+
+func TestInstallNodeModulesFailure(t *testing.T) {
+	binDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "npm"), []byte("#!/bin/sh\necho 'npm ERR! code ERESOLVE' >&2\nexit 1\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := (&Implementer{}).installDependencies(context.Background(), t.TempDir(), string(cdk8sTypescript), cdk8sConfig{}, addonsv1alpha1.ToolchainSpec{}, nil, logr.Discard())
+	assert.ErrorContains(t, err, "npm install failed")
+	assert.Equal(t, "npm ERR! code ERESOLVE", OutputTail(err, 5))
+}
+
+func TestReadCdk8sConfig(t *testing.T) {
+	apiPath := t.TempDir()
+
+	config, err := readCdk8sConfig(apiPath)
+	assert.NoError(t, err)
+	assert.Equal(t, cdk8sConfig{}, config)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(apiPath, "cdk8s.yaml"), []byte("language: python\napp: pipenv run python main.py\nimports:\n  - k8s\n"), 0644))
+	config, err = readCdk8sConfig(apiPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "python", config.Language)
+	assert.Equal(t, "pipenv", config.appCommand())
+}
+
+func TestNodeInstallCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		lockfile       string
+		packageManager addonsv1alpha1.PackageManager
+		want           string
+	}{
+		{name: "npm without lockfile", want: "npm install"},
+		{name: "npm with lockfile", lockfile: "package-lock.json", want: "npm ci"},
+		{name: "yarn from lockfile", lockfile: "yarn.lock", want: "yarn install --frozen-lockfile"},
+		{name: "pnpm from lockfile", lockfile: "pnpm-lock.yaml", want: "pnpm install --frozen-lockfile"},
+		{name: "explicit pnpm without lockfile", packageManager: addonsv1alpha1.PackageManagerPnpm, want: "pnpm install"},
+		{name: "explicit npm overrides lockfile", lockfile: "yarn.lock", packageManager: addonsv1alpha1.PackageManagerNpm, want: "npm install"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiPath := t.TempDir()
+			if tt.lockfile != "" {
+				assert.NoError(t, os.WriteFile(filepath.Join(apiPath, tt.lockfile), nil, 0644))
+			}
+
+			name, args := nodeInstallCommand(apiPath, tt.packageManager)
+			assert.Equal(t, tt.want, strings.Join(append([]string{name}, args...), " "))
+		})
+	}
+}
+
+func TestSynthCommand(t *testing.T) {
+	name, args := synthCommand(addonsv1alpha1.ToolchainSpec{})
+	assert.Equal(t, "cdk8s", name)
+	assert.Equal(t, []string{"synth"}, args)
+
+	name, args = synthCommand(addonsv1alpha1.ToolchainSpec{Cdk8sCLIVersion: "2.198.0"})
+	assert.Equal(t, "npx", name)
+	assert.Equal(t, []string{"--yes", "cdk8s-cli@2.198.0", "synth"}, args)
+}
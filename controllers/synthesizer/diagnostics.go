@@ -0,0 +1,130 @@
+package synthesizer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxReportedDiagnostics bounds the number of diagnostics in the message of a StepError.
+const maxReportedDiagnostics = 10
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+	// tscDiagnostic matches errors of tsc and ts-node, e.g. "main.ts(12,5): error TS2322: Type ...".
+	tscDiagnostic = regexp.MustCompile(`^\s*(\S+\.tsx?)\((\d+),(\d+)\): error (TS\d+): (.+)$`)
+
+	// tscPrettyDiagnostic matches errors of tsc with --pretty, e.g. "main.ts:12:5 - error TS2322: Type ...".
+	tscPrettyDiagnostic = regexp.MustCompile(`^\s*(\S+\.tsx?):(\d+):(\d+) - error (TS\d+): (.+)$`)
+
+	// goDiagnostic matches errors of the Go compiler, e.g. "./main.go:12:5: undefined: foo".
+	goDiagnostic = regexp.MustCompile(`^\s*(\S+\.go):(\d+):(\d+): (.+)$`)
+)
+
+// Diagnostic is a compiler error found in the output of a synth step.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Code    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Code != "" {
+		return fmt.Sprintf("%s:%d:%d: %s %s", d.File, d.Line, d.Column, d.Code, d.Message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// StepError reports a failed synth step with the tail of its output and the compiler errors in it.
+type StepError struct {
+	// Step is the command line of the step.
+	Step string
+
+	// Err is the cause, e.g. the exit status or a LimitError.
+	Err error
+
+	// Output is the tail of the combined stdout and stderr of the step.
+	Output string
+
+	// Diagnostics are the compiler errors found in the output.
+	Diagnostics []Diagnostic
+}
+
+func (e *StepError) Error() string {
+	var limitErr *LimitError
+	switch {
+	case errors.As(e.Err, &limitErr):
+		return limitErr.Error()
+	case len(e.Diagnostics) > 0:
+		diagnostics := make([]string, 0, maxReportedDiagnostics)
+		for idx, diagnostic := range e.Diagnostics {
+			if idx == maxReportedDiagnostics {
+				diagnostics = append(diagnostics, fmt.Sprintf("and %d more", len(e.Diagnostics)-idx))
+
+				break
+			}
+			diagnostics = append(diagnostics, diagnostic.String())
+		}
+
+		return fmt.Sprintf("%s failed: %s", e.Step, strings.Join(diagnostics, "; "))
+	case e.Err != nil:
+		return fmt.Sprintf("%s failed: %v", e.Step, e.Err)
+	}
+
+	return e.Step + " failed"
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// OutputTail returns the last lines of the output of the step that failed with err, or an empty
+// string if err is not a StepError.
+func OutputTail(err error, lines int) string {
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Output == "" {
+		return ""
+	}
+
+	return tail([]byte(stepErr.Output), lines)
+}
+
+// parseDiagnostics returns the TypeScript and Go compiler errors in the output of a step.
+func parseDiagnostics(output string) (diagnostics []Diagnostic) {
+	seen := map[Diagnostic]bool{}
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(output, ""), "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		var diagnostic Diagnostic
+		if match := tscDiagnostic.FindStringSubmatch(line); match != nil {
+			diagnostic = newDiagnostic(match[1], match[2], match[3], match[4], match[5])
+		} else if match := tscPrettyDiagnostic.FindStringSubmatch(line); match != nil {
+			diagnostic = newDiagnostic(match[1], match[2], match[3], match[4], match[5])
+		} else if match := goDiagnostic.FindStringSubmatch(line); match != nil {
+			diagnostic = newDiagnostic(match[1], match[2], match[3], "", match[4])
+		} else {
+			continue
+		}
+
+		if !seen[diagnostic] {
+			seen[diagnostic] = true
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	return diagnostics
+}
+
+func newDiagnostic(file, line, column, code, message string) Diagnostic {
+	lineNumber, _ := strconv.Atoi(line)
+	columnNumber, _ := strconv.Atoi(column)
+
+	return Diagnostic{File: file, Line: lineNumber, Column: columnNumber, Code: code, Message: strings.TrimSpace(message)}
+}
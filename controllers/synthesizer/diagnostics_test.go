@@ -0,0 +1,65 @@
+package synthesizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			name:   "ts-node",
+			output: "TSError: ⨯ Unable to compile TypeScript:\nmain.ts(12,5): error TS2322: Type 'string' is not assignable to type 'number'.\n",
+			want:   []Diagnostic{{File: "main.ts", Line: 12, Column: 5, Code: "TS2322", Message: "Type 'string' is not assignable to type 'number'."}},
+		},
+		{
+			name:   "tsc pretty",
+			output: "\x1b[96msrc/chart.ts\x1b[0m:\x1b[93m3\x1b[0m:\x1b[93m10\x1b[0m - \x1b[91merror\x1b[0m\x1b[90m TS2307: \x1b[0mCannot find module 'cdk8s-plus-30'.\n",
+			want:   []Diagnostic{{File: "src/chart.ts", Line: 3, Column: 10, Code: "TS2307", Message: "Cannot find module 'cdk8s-plus-30'."}},
+		},
+		{
+			name:   "go",
+			output: "# example.com/app\n./main.go:12:5: undefined: foo\n./main.go:12:5: undefined: foo\n\tmain.go:20 +0x1d\n",
+			want:   []Diagnostic{{File: "./main.go", Line: 12, Column: 5, Message: "undefined: foo"}},
+		},
+		{
+			name:   "no compiler errors",
+			output: "npm ERR! code ERESOLVE\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseDiagnostics(tt.output))
+		})
+	}
+}
+
+func TestStepError(t *testing.T) {
+	err := &StepError{Step: "cdk8s synth", Err: errors.New("exit status 1"), Output: "a\nb\nc\n"}
+	assert.EqualError(t, err, "cdk8s synth failed: exit status 1")
+	assert.Equal(t, "b\nc", OutputTail(err, 2))
+	assert.Empty(t, OutputTail(errors.New("other"), 2))
+
+	err.Diagnostics = []Diagnostic{{File: "main.ts", Line: 1, Column: 2, Code: "TS2304", Message: "Cannot find name 'x'."}}
+	assert.EqualError(t, err, "cdk8s synth failed: main.ts:1:2: TS2304 Cannot find name 'x'.")
+
+	err.Err = &LimitError{Step: "cdk8s synth", Limit: "timeout of 1s"}
+	assert.EqualError(t, err, "cdk8s synth exceeded the timeout of 1s")
+}
+
+func TestSynthesizeCompilerErrors(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "echo '# example.com/app'\necho './main.go:7:2: undefined: chart' >&2\nexit 1\n")
+
+	_, err := (&Implementer{}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.EqualError(t, err, "cdk8s synth failed: ./main.go:7:2: undefined: chart")
+	assert.Equal(t, "# example.com/app\n./main.go:7:2: undefined: chart", OutputTail(err, 20))
+}
@@ -0,0 +1,662 @@
+package synthesizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	gitoperator "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/git"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// JobLabel is set on synth Jobs, their pods and request Secrets.
+const JobLabel = "addons.cluster.x-k8s.io/synth-job"
+
+// gitDefaultPorts are the ports of the Git protocols without explicit port.
+var gitDefaultPorts = map[string]int{"https": 443, "http": 80, "ssh": 22, "git": 9418}
+
+// lookupIPAddr resolves the Git host of offline synth Jobs.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+const (
+	// JobRequestFile, JobRegistriesFile, JobGitDir and JobWorkDir are the paths the synth Job reads
+	// its request, the registry credentials, the Git credentials and known_hosts from and works in.
+	JobRequestFile    = "/synth/request/request.json"
+	JobRegistriesFile = "/synth/registries/registries.json"
+	JobGitDir         = "/synth/git"
+	JobWorkDir        = "/synth/work"
+
+	jobContainerName      = "synth"
+	jobCloneContainerName = "clone"
+	jobNetworkPolicyName  = "cdk8s-synth-jobs"
+	jobOfflineLabelValue  = "offline"
+	jobRequestKey         = "request.json"
+	jobRegistriesKey      = "registries.json"
+	jobRepositoryDir      = "repository"
+	jobCredentialsKey     = "credentials"
+	jobKnownHostsKey      = "known_hosts"
+	jobLogTailLines       = 20
+
+	manifestsBeginMarker = "----- BEGIN CDK8S MANIFESTS -----"
+	manifestsEndMarker   = "----- END CDK8S MANIFESTS -----"
+)
+
+// JobRequest is handed to a synth Job in its request Secret. The registries are stored under a
+// key of their own, only mounted into the clone container.
+type JobRequest struct {
+	Cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy `json:"cdk8sAppProxy"`
+	Commit        string                        `json:"commit,omitempty"`
+	Context       map[string]any                `json:"context,omitempty"`
+	Env           map[string]string             `json:"env,omitempty"`
+	Registries    []Registry                    `json:"-"`
+	Offline       bool                          `json:"offline,omitempty"`
+}
+
+// JobConfig configures the Jobs synthesizing apps.
+type JobConfig struct {
+	// Clientset creates the Jobs and reads the logs of their pods.
+	Clientset kubernetes.Interface
+
+	// Image runs the synth subcommand of the manager, e.g. the image of the controller.
+	Image string
+
+	// Resources of the synth container.
+	Resources corev1.ResourceRequirements
+
+	// Timeout is the active deadline of a Job.
+	Timeout time.Duration
+
+	// PollInterval is the interval the Job status is checked in.
+	PollInterval time.Duration
+
+	// ExcludedCIDRs are address ranges the Jobs can not reach besides DNS, e.g. the pod and service
+	// CIDRs of the cluster. The linkLocalCIDRs are always excluded.
+	ExcludedCIDRs []string
+}
+
+// linkLocalCIDRs are excluded from the egress of synth Jobs. They hold the metadata endpoints of
+// cloud providers, which hand out the credentials of the node.
+var linkLocalCIDRs = []string{"169.254.0.0/16", "fe80::/10", "fd00:ec2::254/128"}
+
+// JobSynthesizer synthesizes apps in a Kubernetes Job per synthesis instead of the controller process.
+// The pods run without service account token and behind a network policy allowing only egress to DNS,
+// and to HTTP(S), SSH and Git outside of the ExcludedCIDRs, or offline, only to DNS and the Git host. The repository is cloned by an init container, the only one mounting the Git
+// credentials. The rendered manifests are collected from the log of the pod.
+type JobSynthesizer struct {
+	Implementer
+	JobConfig
+}
+
+func (j *JobSynthesizer) Synthesize(directory string, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger, ctx context.Context) (parsedManifests []*unstructured.Unstructured, err error) {
+	// Pin the Job to the commit cloned by the controller.
+	commit := cdk8sAppProxy.Spec.GitRepository.Commit
+	if repo, err := git.PlainOpen(directory); err == nil {
+		if head, err := repo.Head(); err == nil {
+			commit = head.Hash().String()
+		}
+	}
+
+	request, err := json.Marshal(JobRequest{Cdk8sAppProxy: cdk8sAppProxy, Commit: commit, Context: j.Context, Env: j.Env, Registries: j.Registries, Offline: j.Offline})
+	if err != nil {
+		return parsedManifests, errors.Wrap(err, "failed to encode synth request")
+	}
+	registries, err := json.Marshal(j.Registries)
+	if err != nil {
+		return parsedManifests, errors.Wrap(err, "failed to encode registries of synth request")
+	}
+
+	name := jobName(cdk8sAppProxy)
+	if err = j.ensureNetworkPolicy(ctx, cdk8sAppProxy, name); err != nil {
+		logger.Error(err, "Failed to ensure network policy of synth Jobs")
+
+		return parsedManifests, err
+	}
+	if j.Offline {
+		defer func() {
+			if err := j.Clientset.NetworkingV1().NetworkPolicies(cdk8sAppProxy.Namespace).Delete(context.WithoutCancel(ctx), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete network policy of synth Job", "job", name)
+			}
+		}()
+	}
+
+	job, err := j.Clientset.BatchV1().Jobs(cdk8sAppProxy.Namespace).Create(ctx, j.job(cdk8sAppProxy, name), metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "Failed to create synth Job")
+
+		return parsedManifests, err
+	}
+	logger.Info("Created synth Job", "job", job.Name)
+
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		if err := j.Clientset.BatchV1().Jobs(job.Namespace).Delete(context.WithoutCancel(ctx), job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete synth Job", "job", job.Name)
+		}
+	}()
+
+	// The request Secret is garbage collected along with the Job.
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            job.Name,
+			Namespace:       job.Namespace,
+			Labels:          map[string]string{JobLabel: "true"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job"))},
+		},
+		Data: map[string][]byte{jobRequestKey: request, jobRegistriesKey: registries},
+	}
+	if _, err = j.Clientset.CoreV1().Secrets(job.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		logger.Error(err, "Failed to create synth request Secret", "job", job.Name)
+
+		return parsedManifests, err
+	}
+
+	succeeded, err := j.waitForJob(ctx, job)
+	if err != nil {
+		logger.Error(err, "Failed to wait for synth Job", "job", job.Name)
+
+		return parsedManifests, err
+	}
+
+	logs, err := j.jobLogs(ctx, job, succeeded)
+	if err != nil {
+		logger.Error(err, "Failed to read logs of synth Job", "job", job.Name)
+
+		return parsedManifests, err
+	}
+
+	if !succeeded {
+		return parsedManifests, &StepError{Step: "synth Job " + job.Name, Output: tail(logs, jobLogTailLines), Diagnostics: parseDiagnostics(string(logs))}
+	}
+
+	return parseJobOutput(logs)
+}
+
+// jobName returns a random name for a synth Job of the Cdk8sAppProxy, short enough for the job-name label.
+func jobName(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy) string {
+	prefix := cdk8sAppProxy.Name
+	if len(prefix) > 40 {
+		prefix = strings.TrimRight(prefix[:40], "-.")
+	}
+
+	return prefix + "-synth-" + utilrand.String(5)
+}
+
+// job returns the Job synthesizing the app of the Cdk8sAppProxy. The clone init container mounts the
+// Git credentials and registries and hands the checkout and registries to the synth container in
+// the work dir.
+func (j *JobSynthesizer) job(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, name string) *batchv1.Job {
+	labels := map[string]string{JobLabel: "true"}
+	if j.Offline {
+		// Offline pods are not selected by the shared network policy, only by the one of their Job.
+		labels[JobLabel] = jobOfflineLabelValue
+	}
+
+	// The Secret is named after the Job and created right after it, the kubelet retries mounting it.
+	volumes := []corev1.Volume{
+		{
+			Name: "request",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: name,
+				Items:      []corev1.KeyToPath{{Key: jobRequestKey, Path: filepath.Base(JobRequestFile)}},
+			}},
+		},
+		{Name: "work", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{
+			Name: "registries",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: name,
+				Items:      []corev1.KeyToPath{{Key: jobRegistriesKey, Path: filepath.Base(JobRegistriesFile)}},
+			}},
+		},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "request", MountPath: filepath.Dir(JobRequestFile), ReadOnly: true},
+		{Name: "work", MountPath: JobWorkDir},
+	}
+	cloneMounts := append([]corev1.VolumeMount{}, mounts...)
+	cloneMounts = append(cloneMounts, corev1.VolumeMount{Name: "registries", MountPath: filepath.Dir(JobRegistriesFile), ReadOnly: true})
+
+	if repo := cdk8sAppProxy.Spec.GitRepository; repo.SecretRef != "" {
+		items := []corev1.KeyToPath{{Key: repo.SecretKey, Path: jobCredentialsKey}}
+		if repo.KnownHostsKey != "" {
+			items = append(items, corev1.KeyToPath{Key: repo.KnownHostsKey, Path: jobKnownHostsKey})
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name:         "git",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: repo.SecretRef, Items: items}},
+		})
+		cloneMounts = append(cloneMounts, corev1.VolumeMount{Name: "git", MountPath: JobGitDir, ReadOnly: true})
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "HOME", Value: filepath.Join(JobWorkDir, "home")},
+		{Name: "TMPDIR", Value: filepath.Join(JobWorkDir, "tmp")},
+	}
+	securityContext := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cdk8sAppProxy.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](0),
+			ActiveDeadlineSeconds:   ptr.To(int64(j.Timeout.Seconds())),
+			TTLSecondsAfterFinished: ptr.To[int32](600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: ptr.To(false),
+					EnableServiceLinks:           ptr.To(false),
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot:   ptr.To(true),
+						SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+					},
+					InitContainers: []corev1.Container{{
+						Name:            jobCloneContainerName,
+						Image:           j.Image,
+						Args:            []string{"synth", "--clone", "--request", JobRequestFile, "--registries", JobRegistriesFile, "--git-dir", JobGitDir, "--work-dir", JobWorkDir},
+						Env:             env,
+						Resources:       j.Resources,
+						VolumeMounts:    cloneMounts,
+						SecurityContext: securityContext,
+					}},
+					Containers: []corev1.Container{{
+						Name:            jobContainerName,
+						Image:           j.Image,
+						Args:            []string{"synth", "--request", JobRequestFile, "--work-dir", JobWorkDir},
+						Env:             env,
+						Resources:       j.Resources,
+						VolumeMounts:    mounts,
+						SecurityContext: securityContext,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// ensureNetworkPolicy creates or updates the network policy of the synth Job name in the namespace of
+// the Cdk8sAppProxy. It denies all ingress and allows egress to DNS, and to HTTP(S), SSH and Git
+// outside of the ExcludedCIDRs and the linkLocalCIDRs only. Offline,
+// the Job gets a network policy of its own, allowing egress only to DNS and the Git host of the
+// Cdk8sAppProxy, which is deleted along with the Job.
+func (j *JobSynthesizer) ensureNetworkPolicy(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, name string) (err error) {
+	policies := j.Clientset.NetworkingV1().NetworkPolicies(cdk8sAppProxy.Namespace)
+
+	if j.Offline {
+		policy, err := offlineNetworkPolicy(ctx, cdk8sAppProxy, name)
+		if err != nil {
+			return err
+		}
+		_, err = policies.Create(ctx, policy, metav1.CreateOptions{})
+
+		return err
+	}
+
+	policy, err := jobNetworkPolicy(cdk8sAppProxy.Namespace, j.ExcludedCIDRs)
+	if err != nil {
+		return err
+	}
+
+	existing, err := policies.Get(ctx, jobNetworkPolicyName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = policies.Create(ctx, policy, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Roll out changes of the policy, e.g. of the ExcludedCIDRs.
+	if equality.Semantic.DeepEqual(existing.Spec, policy.Spec) && equality.Semantic.DeepEqual(existing.Labels, policy.Labels) {
+		return nil
+	}
+	existing.Spec = policy.Spec
+	existing.Labels = policy.Labels
+	_, err = policies.Update(ctx, existing, metav1.UpdateOptions{})
+
+	return err
+}
+
+// jobNetworkPolicy returns the network policy of the synth Jobs in namespace, excluding the
+// excludedCIDRs and the linkLocalCIDRs from the egress beyond DNS.
+func jobNetworkPolicy(namespace string, excludedCIDRs []string) (policy *networkingv1.NetworkPolicy, err error) {
+	var ports []networkingv1.NetworkPolicyPort
+	for _, port := range []int{80, 443, 22, 9418} {
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt(port))})
+	}
+
+	ipv4 := &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}
+	ipv6 := &networkingv1.IPBlock{CIDR: "::/0"}
+	for _, cidr := range append(slices.Clone(linkLocalCIDRs), excludedCIDRs...) {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid excluded CIDR of synth Jobs")
+		}
+		if network.IP.To4() != nil {
+			ipv4.Except = append(ipv4.Except, network.String())
+		} else {
+			ipv6.Except = append(ipv6.Except, network.String())
+		}
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobNetworkPolicyName,
+			Namespace: namespace,
+			Labels:    map[string]string{JobLabel: "true"},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{JobLabel: "true"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{Ports: dnsPorts()},
+				{To: []networkingv1.NetworkPolicyPeer{{IPBlock: ipv4}, {IPBlock: ipv6}}, Ports: ports},
+			},
+		},
+	}, nil
+}
+
+// offlineNetworkPolicy returns the network policy of the offline synth Job name. The Git host is
+// resolved to the addresses it has when the Job is created.
+func offlineNetworkPolicy(ctx context.Context, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, name string) (policy *networkingv1.NetworkPolicy, err error) {
+	endpoint, err := transport.NewEndpoint(cdk8sAppProxy.Spec.GitRepository.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the Git repository URL")
+	}
+	port := endpoint.Port
+	if port == 0 {
+		port = gitDefaultPorts[endpoint.Protocol]
+	}
+	if port == 0 {
+		return nil, errors.Errorf("unsupported Git protocol %q for offline synth Jobs", endpoint.Protocol)
+	}
+
+	var addresses []net.IP
+	if ip := net.ParseIP(endpoint.Host); ip != nil {
+		addresses = []net.IP{ip}
+	} else {
+		resolved, err := lookupIPAddr(ctx, endpoint.Host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve the Git host %s", endpoint.Host)
+		}
+		for _, address := range resolved {
+			addresses = append(addresses, address.IP)
+		}
+	}
+
+	peers := make([]networkingv1.NetworkPolicyPeer, 0, len(addresses))
+	for _, address := range addresses {
+		bits := 128
+		if address.To4() != nil {
+			bits = 32
+		}
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: fmt.Sprintf("%s/%d", address, bits)}})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cdk8sAppProxy.Namespace,
+			Labels:    map[string]string{JobLabel: jobOfflineLabelValue},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{batchv1.JobNameLabel: name}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{Ports: dnsPorts()},
+				{To: peers, Ports: []networkingv1.NetworkPolicyPort{{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt(port))}}},
+			},
+		},
+	}, nil
+}
+
+// dnsPorts returns the DNS ports synth Jobs may reach.
+func dnsPorts() []networkingv1.NetworkPolicyPort {
+	return []networkingv1.NetworkPolicyPort{
+		{Protocol: ptr.To(corev1.ProtocolUDP), Port: ptr.To(intstr.FromInt(53))},
+		{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt(53))},
+	}
+}
+
+// waitForJob waits until the Job succeeded or failed.
+func (j *JobSynthesizer) waitForJob(ctx context.Context, job *batchv1.Job) (succeeded bool, err error) {
+	// The Job fails itself once its active deadline is exceeded, the grace covers scheduling.
+	err = wait.PollUntilContextTimeout(ctx, j.PollInterval, j.Timeout+time.Minute, false, func(ctx context.Context) (bool, error) {
+		current, err := j.Clientset.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		succeeded = current.Status.Succeeded > 0
+
+		return succeeded || current.Status.Failed > 0, nil
+	})
+
+	return succeeded, err
+}
+
+// jobLogs returns the log of the synth container of the Job's pod. The log of a failed Job is the one
+// of the clone container if the synth container never started.
+func (j *JobSynthesizer) jobLogs(ctx context.Context, job *batchv1.Job, succeeded bool) (logs []byte, err error) {
+	pods, err := j.Clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: batchv1.JobNameLabel + "=" + job.Name})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, errors.Errorf("no pod found for synth Job %s", job.Name)
+	}
+
+	pod := pods.Items[0]
+
+	container := jobContainerName
+	if !succeeded {
+		for _, status := range pod.Status.InitContainerStatuses {
+			if status.Name == jobCloneContainerName && status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+				container = jobCloneContainerName
+			}
+		}
+	}
+
+	return j.Clientset.CoreV1().Pods(job.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container}).DoRaw(ctx)
+}
+
+// parseJobOutput parses the manifests written between the markers of the Job output.
+func parseJobOutput(output []byte) (parsedManifests []*unstructured.Unstructured, err error) {
+	begin := bytes.LastIndex(output, []byte(manifestsBeginMarker))
+	if begin < 0 {
+		return nil, errors.New("synth Job output contains no manifests")
+	}
+	rest := output[begin+len(manifestsBeginMarker):]
+	end := bytes.Index(rest, []byte(manifestsEndMarker))
+	if end < 0 {
+		return nil, errors.New("synth Job output is truncated")
+	}
+
+	var objects []map[string]any
+	if err = json.Unmarshal(rest[:end], &objects); err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifests of synth Job")
+	}
+	for _, object := range objects {
+		parsedManifests = append(parsedManifests, &unstructured.Unstructured{Object: object})
+	}
+
+	return parsedManifests, nil
+}
+
+// writeJobOutput writes the manifests between the markers parsed by parseJobOutput.
+func writeJobOutput(out io.Writer, parsedManifests []*unstructured.Unstructured) (err error) {
+	objects := make([]map[string]any, 0, len(parsedManifests))
+	for _, manifest := range parsedManifests {
+		objects = append(objects, manifest.Object)
+	}
+
+	encoded, err := json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\n%s\n%s\n%s\n", manifestsBeginMarker, encoded, manifestsEndMarker)
+
+	return err
+}
+
+// CloneJob is run by the clone init container of the synth Job: it clones the repository of the
+// request into the work dir and copies the registries there, for the synth container, which mounts
+// neither the Git credentials nor the registries.
+func CloneJob(ctx context.Context, requestFile, registriesFile, gitDir, workDir string, logger logr.Logger) (err error) {
+	request, err := readJobRequest(requestFile)
+	if err != nil {
+		return err
+	}
+	repo := request.Cdk8sAppProxy.Spec.GitRepository
+
+	secretRef, err := readOptional(filepath.Join(gitDir, jobCredentialsKey))
+	if err != nil {
+		return err
+	}
+	knownHosts, err := readOptional(filepath.Join(gitDir, jobKnownHostsKey))
+	if err != nil {
+		return err
+	}
+
+	gitImpl := &gitoperator.Implementer{KnownHosts: knownHosts}
+	if secretRef != nil {
+		_, requiredAuth, err := gitImpl.CheckAccess(repo.URL, secretRef, logger)
+		if err != nil {
+			return err
+		}
+		if !requiredAuth {
+			secretRef = nil
+		}
+	}
+
+	if err = gitImpl.Clone(repo.URL, secretRef, repo.Reference, request.Commit, filepath.Join(workDir, jobRepositoryDir), logger); err != nil {
+		return err
+	}
+
+	registries, err := readOptional(registriesFile)
+	if err != nil || registries == nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(workDir, jobRegistriesKey), registries, 0o600)
+}
+
+// RunJob is run by the synth container of the synth Job: it synthesizes the app cloned by CloneJob
+// in-process and writes the manifests to out. The registries copied by CloneJob are removed before
+// any step runs and only handed to the install steps.
+func RunJob(ctx context.Context, requestFile, workDir string, out io.Writer, logger logr.Logger) (err error) {
+	request, err := readJobRequest(requestFile)
+	if err != nil {
+		return err
+	}
+
+	// HOME and TMPDIR of the Job point into the empty work dir.
+	for _, dir := range []string{os.Getenv("HOME"), os.TempDir()} {
+		if dir == "" {
+			continue
+		}
+		if err = os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	registriesFile := filepath.Join(workDir, jobRegistriesKey)
+	registries, err := readOptional(registriesFile)
+	if err != nil {
+		return err
+	}
+	if registries != nil {
+		if err = os.Remove(registriesFile); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(registries, &request.Registries); err != nil {
+			return errors.Wrap(err, "failed to decode registries of synth request")
+		}
+	}
+
+	// Offline Jobs are isolated by their network policy, pods usually cannot create network namespaces.
+	impl := &Implementer{Context: request.Context, Env: request.Env, Registries: request.Registries, Offline: request.Offline, OfflineEnvOnly: true}
+	parsedManifests, err := impl.Synthesize(filepath.Join(workDir, jobRepositoryDir), request.Cdk8sAppProxy, logger, ctx)
+	if err != nil {
+		// Print the output of the failed step unquoted, for the controller to find compiler errors in the logs.
+		var stepErr *StepError
+		if errors.As(err, &stepErr) {
+			_, _ = io.WriteString(out, stepErr.Output)
+		}
+
+		return err
+	}
+
+	return writeJobOutput(out, parsedManifests)
+}
+
+// readJobRequest reads the request of a synth Job.
+func readJobRequest(requestFile string) (request JobRequest, err error) {
+	content, err := os.ReadFile(requestFile)
+	if err != nil {
+		return request, err
+	}
+	if err = json.Unmarshal(content, &request); err != nil {
+		return request, errors.Wrap(err, "failed to decode synth request")
+	}
+	if request.Cdk8sAppProxy == nil || request.Cdk8sAppProxy.Spec.GitRepository == nil {
+		return request, errors.New("synth request has no git repository")
+	}
+
+	return request, nil
+}
+
+// readOptional returns the content of the file, or nil if it does not exist.
+func readOptional(path string) (content []byte, err error) {
+	content, err = os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return content, err
+}
+
+// tail returns the last lines of the output.
+func tail(output []byte, lines int) string {
+	all := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+
+	return strings.Join(all, "\n")
+}
@@ -0,0 +1,204 @@
+package synthesizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newJobTestProxy() *addonsv1alpha1.Cdk8sAppProxy {
+	return &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			GitRepository: &addonsv1alpha1.GitRepositorySpec{
+				URL:           "git@github.com:owner/repo.git",
+				Reference:     "main",
+				SecretRef:     "git",
+				SecretKey:     "ssh",
+				KnownHostsKey: "known_hosts",
+			},
+		},
+	}
+}
+
+func TestJob(t *testing.T) {
+	synth := &JobSynthesizer{JobConfig: JobConfig{Image: "caapc:dev", Timeout: 5 * time.Minute}}
+
+	job := synth.job(newJobTestProxy(), "app-synth-abcde")
+	pod := job.Spec.Template.Spec
+
+	assert.Equal(t, "app-synth-abcde", job.Name)
+	assert.Equal(t, int64(300), *job.Spec.ActiveDeadlineSeconds)
+	assert.False(t, *pod.AutomountServiceAccountToken)
+	assert.Equal(t, "true", job.Spec.Template.Labels[JobLabel])
+	assert.Equal(t, "caapc:dev", pod.Containers[0].Image)
+	assert.Equal(t, "synth", pod.Containers[0].Args[0])
+	assert.Equal(t, "app-synth-abcde", pod.Volumes[0].Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "request.json", Path: "request.json"}}, pod.Volumes[0].Secret.Items)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "registries.json", Path: "registries.json"}}, pod.Volumes[2].Secret.Items)
+	assert.Equal(t, "git", pod.Volumes[3].Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "ssh", Path: "credentials"}, {Key: "known_hosts", Path: "known_hosts"}}, pod.Volumes[3].Secret.Items)
+
+	// Only the clone container mounts the Git credentials and the registries.
+	assert.Equal(t, "--clone", pod.InitContainers[0].Args[1])
+	cloneMounts := []string{}
+	for _, mount := range pod.InitContainers[0].VolumeMounts {
+		cloneMounts = append(cloneMounts, mount.Name)
+	}
+	assert.Equal(t, []string{"request", "work", "registries", "git"}, cloneMounts)
+	synthMounts := []string{}
+	for _, mount := range pod.Containers[0].VolumeMounts {
+		synthMounts = append(synthMounts, mount.Name)
+	}
+	assert.Equal(t, []string{"request", "work"}, synthMounts)
+
+	policy, err := jobNetworkPolicy("default", []string{"10.96.0.0/12", "fd00:10::/108"})
+	assert.NoError(t, err)
+	assert.Empty(t, policy.Spec.Ingress)
+	assert.Len(t, policy.Spec.Egress[0].Ports, 2)
+	assert.Empty(t, policy.Spec.Egress[0].To)
+	assert.Len(t, policy.Spec.Egress[1].Ports, 4)
+	// Beyond DNS, the metadata endpoints and the excluded CIDRs can not be reached.
+	assert.Equal(t, []networkingv1.NetworkPolicyPeer{
+		{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0", Except: []string{"169.254.0.0/16", "10.96.0.0/12"}}},
+		{IPBlock: &networkingv1.IPBlock{CIDR: "::/0", Except: []string{"fe80::/10", "fd00:ec2::254/128", "fd00:10::/108"}}},
+	}, policy.Spec.Egress[1].To)
+	_, err = jobNetworkPolicy("default", []string{"10.96.0.0"})
+	assert.Error(t, err)
+
+	// Offline pods are only selected by the network policy of their Job.
+	synth.Offline = true
+	offline := synth.job(newJobTestProxy(), "app-synth-abcde")
+	assert.Equal(t, "offline", offline.Spec.Template.Labels[JobLabel])
+}
+
+func TestEnsureNetworkPolicy(t *testing.T) {
+	outdated, err := jobNetworkPolicy("default", nil)
+	assert.NoError(t, err)
+	outdated.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{Ports: dnsPorts()}}
+	clientset := fake.NewClientset(outdated)
+	synth := &JobSynthesizer{JobConfig: JobConfig{Clientset: clientset, ExcludedCIDRs: []string{"10.96.0.0/12"}}}
+
+	// The existing policy is updated to the current one.
+	assert.NoError(t, synth.ensureNetworkPolicy(context.Background(), newJobTestProxy(), "app-synth-abcde"))
+	policy, err := clientset.NetworkingV1().NetworkPolicies("default").Get(context.Background(), jobNetworkPolicyName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	want, err := jobNetworkPolicy("default", synth.ExcludedCIDRs)
+	assert.NoError(t, err)
+	assert.Equal(t, want.Spec, policy.Spec)
+}
+
+func TestOfflineNetworkPolicy(t *testing.T) {
+	lookup := lookupIPAddr
+	lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		assert.Equal(t, "github.com", host)
+
+		return []net.IPAddr{{IP: net.ParseIP("140.82.121.4")}, {IP: net.ParseIP("2001:db8::1")}}, nil
+	}
+	defer func() { lookupIPAddr = lookup }()
+
+	proxy := newJobTestProxy()
+	policy, err := offlineNetworkPolicy(context.Background(), proxy, "app-synth-abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, "app-synth-abcde", policy.Name)
+	assert.Equal(t, map[string]string{batchv1.JobNameLabel: "app-synth-abcde"}, policy.Spec.PodSelector.MatchLabels)
+	assert.Empty(t, policy.Spec.Ingress)
+	assert.Len(t, policy.Spec.Egress, 2)
+	assert.Len(t, policy.Spec.Egress[0].Ports, 2)
+	assert.Empty(t, policy.Spec.Egress[0].To, "DNS")
+	assert.Equal(t, []networkingv1.NetworkPolicyPeer{
+		{IPBlock: &networkingv1.IPBlock{CIDR: "140.82.121.4/32"}},
+		{IPBlock: &networkingv1.IPBlock{CIDR: "2001:db8::1/128"}},
+	}, policy.Spec.Egress[1].To)
+	assert.Equal(t, 22, policy.Spec.Egress[1].Ports[0].Port.IntValue())
+
+	proxy.Spec.GitRepository.URL = "https://192.0.2.10:8443/owner/repo.git"
+	policy, err = offlineNetworkPolicy(context.Background(), proxy, "app-synth-abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.10/32", policy.Spec.Egress[1].To[0].IPBlock.CIDR)
+	assert.Equal(t, 8443, policy.Spec.Egress[1].Ports[0].Port.IntValue())
+}
+
+func TestJobOutput(t *testing.T) {
+	var out bytes.Buffer
+	out.WriteString("npm WARN deprecated\n")
+	manifests := []*unstructured.Unstructured{{Object: map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "cm"}}}}
+	assert.NoError(t, writeJobOutput(&out, manifests))
+	out.WriteString("done\n")
+
+	parsed, err := parseJobOutput(out.Bytes())
+	assert.NoError(t, err)
+	assert.Len(t, parsed, 1)
+	assert.Equal(t, "cm", parsed[0].GetName())
+
+	_, err = parseJobOutput([]byte("Error: Cannot find module 'cdk8s'"))
+	assert.ErrorContains(t, err, "contains no manifests")
+}
+
+func TestRunJobRemovesRegistries(t *testing.T) {
+	_, proxy := fakeCdk8s(t, "test ! -e \"$WORK_DIR/registries.json\" || exit 1\nmkdir -p dist\n")
+	workDir := t.TempDir()
+	t.Setenv("WORK_DIR", workDir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(workDir, "repository"), 0o755))
+
+	request, err := json.Marshal(JobRequest{Cdk8sAppProxy: proxy, Env: map[string]string{"WORK_DIR": workDir}})
+	assert.NoError(t, err)
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	assert.NoError(t, os.WriteFile(requestFile, request, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "registries.json"), []byte(`[{"kind":"npm","url":"https://npm.example.com/","token":"npm-token"}]`), 0o600))
+
+	var out bytes.Buffer
+	assert.NoError(t, RunJob(context.Background(), requestFile, workDir, &out, logr.Discard()))
+	assert.NoFileExists(t, filepath.Join(workDir, "registries.json"))
+	assert.Contains(t, out.String(), manifestsBeginMarker)
+}
+
+func TestJobSynthesizeFailure(t *testing.T) {
+	clientset := fake.NewClientset()
+	synth := &JobSynthesizer{JobConfig: JobConfig{Clientset: clientset, Image: "caapc:dev", Timeout: time.Minute, PollInterval: 10 * time.Millisecond}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Play the job controller: fail the Job and create its pod.
+	go func() {
+		for ctx.Err() == nil {
+			jobs, _ := clientset.BatchV1().Jobs("default").List(ctx, metav1.ListOptions{})
+			for i := range jobs.Items {
+				job := &jobs.Items[i]
+				pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-pod", Namespace: "default", Labels: map[string]string{batchv1.JobNameLabel: job.Name}}}
+				_, _ = clientset.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{})
+				job.Status.Failed = 1
+				_, _ = clientset.BatchV1().Jobs("default").UpdateStatus(ctx, job, metav1.UpdateOptions{})
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	_, err := synth.Synthesize(t.TempDir(), newJobTestProxy(), logr.Discard(), ctx)
+	assert.ErrorContains(t, err, "failed")
+	assert.Equal(t, "fake logs", OutputTail(err, 5))
+
+	jobs, err := clientset.BatchV1().Jobs("default").List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+
+	secrets, err := clientset.CoreV1().Secrets("default").List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, secrets.Items, 1)
+	assert.Equal(t, "Job", secrets.Items[0].OwnerReferences[0].Kind)
+}
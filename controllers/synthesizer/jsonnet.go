@@ -0,0 +1,127 @@
+package synthesizer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// jsonnetMain is the entry point of a Jsonnet app.
+const jsonnetMain = "main.jsonnet"
+
+// JsonnetCommand is the subcommand of the manager evaluating Jsonnet for the jsonnet renderer.
+const JsonnetCommand = "jsonnet"
+
+// executable returns the path of the manager binary running the JsonnetCommand.
+var executable = os.Executable
+
+// jsonnetRenderer evaluates main.jsonnet in the app path. The context of the app is available as
+// external variables, e.g. std.extVar('values'). Imports are resolved relative to the importing
+// file, then in the vendor and lib directories of the app path, and must stay in the repository.
+// The evaluation runs in the JsonnetCommand of the manager as a step within the Limits.
+type jsonnetRenderer struct{}
+
+func (jsonnetRenderer) Render(ctx context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error) {
+	manager, err := executable()
+	if err != nil {
+		return nil, err
+	}
+
+	outFile := filepath.Join(app.TempDir, "jsonnet-output.json")
+	if err = app.Run(ctx, logger, manager, JsonnetCommand, app.Root, jsonnetMain, outFile); err != nil {
+		logger.Error(err, "Failed to evaluate Jsonnet")
+
+		return nil, renameStep(err, JsonnetCommand+" "+jsonnetMain)
+	}
+	if err = app.implementer.Limits.checkFileSize(JsonnetCommand+" "+jsonnetMain, outFile); err != nil {
+		return nil, err
+	}
+
+	output, err := os.ReadFile(outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err = json.Unmarshal(output, &value); err != nil {
+		return nil, err
+	}
+
+	return chartsFromValue(app, value)
+}
+
+// RunJsonnet is run by the JsonnetCommand with the repository root, the file to evaluate relative
+// to the working directory and the output file as args. The context is read from ContextEnv.
+func RunJsonnet(args []string) (err error) {
+	if len(args) != 3 {
+		return errors.Errorf("expected the repository root, the Jsonnet file and the output file, got %d args", len(args))
+	}
+	root, file, outFile := args[0], args[1], args[2]
+
+	apiPath, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.Importer(&rootedImporter{
+		root:     root,
+		importer: &jsonnet.FileImporter{JPaths: []string{filepath.Join(apiPath, "vendor"), filepath.Join(apiPath, "lib")}},
+	})
+
+	vm.ExtCode(ValuesContextKey, "{}")
+	if encoded := os.Getenv(ContextEnv); encoded != "" {
+		entries := map[string]json.RawMessage{}
+		if err = json.Unmarshal([]byte(encoded), &entries); err != nil {
+			return errors.Wrap(err, "failed to decode the synth context")
+		}
+		for key, value := range entries {
+			vm.ExtCode(key, string(value))
+		}
+	}
+
+	output, err := vm.EvaluateFile(filepath.Join(apiPath, file))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(outFile, []byte(output), 0o600)
+}
+
+// renameStep names the failed step of err, e.g. instead of the command line of the manager.
+func renameStep(err error, step string) error {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		stepErr.Step = step
+	}
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		limitErr.Step = step
+	}
+
+	return err
+}
+
+// rootedImporter refuses Jsonnet imports from outside of root.
+type rootedImporter struct {
+	root     string
+	importer *jsonnet.FileImporter
+}
+
+func (r *rootedImporter) Import(importedFrom, importedPath string) (contents jsonnet.Contents, foundAt string, err error) {
+	contents, foundAt, err = r.importer.Import(importedFrom, importedPath)
+	if err != nil {
+		return contents, foundAt, err
+	}
+	if err = checkWithin(r.root, foundAt); err != nil {
+		return jsonnet.Contents{}, "", err
+	}
+
+	return contents, foundAt, nil
+}
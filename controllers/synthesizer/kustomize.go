@@ -0,0 +1,173 @@
+package synthesizer
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/krusty"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// overlayDir is the directory of the overlay kustomization in its in-memory file system.
+	overlayDir = "/overlay"
+	// overlayResources is the file holding the synthesized resources in the overlay directory.
+	overlayResources = "resources.yaml"
+)
+
+// kustomizeRoots returns the directories of the kustomizations in dist which are not below the
+// directory of another kustomization, i.e. the ones that are not part of a larger build.
+func kustomizeRoots(kustomizationFiles []string) (roots []string) {
+	dirs := make([]string, 0, len(kustomizationFiles))
+	for _, file := range kustomizationFiles {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		nested := false
+		for _, root := range roots {
+			if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+				nested = true
+
+				break
+			}
+		}
+		if !nested {
+			roots = append(roots, dir)
+		}
+	}
+
+	return roots
+}
+
+// kustomizeBuild runs a complete kustomize build of the kustomization in dir, including patches,
+// generators, transformers and nested kustomizations. Files can only be loaded below dir, bases
+// only below root.
+func kustomizeBuild(root, dir string, logger logr.Logger) (parsedResources []*unstructured.Unstructured, err error) {
+	return runKustomize(rootedFs{FileSystem: filesys.MakeFsOnDisk(), root: root}, dir, logger)
+}
+
+// rootedFs is a file system refusing to read files outside of root, e.g. through bases or symlinks
+// leaving the repository.
+type rootedFs struct {
+	filesys.FileSystem
+	root string
+}
+
+func (r rootedFs) Open(path string) (filesys.File, error) {
+	if err := checkWithin(r.root, path); err != nil {
+		return nil, err
+	}
+
+	return r.FileSystem.Open(path)
+}
+
+func (r rootedFs) ReadFile(path string) ([]byte, error) {
+	if err := checkWithin(r.root, path); err != nil {
+		return nil, err
+	}
+
+	return r.FileSystem.ReadFile(path)
+}
+
+func (r rootedFs) ReadDir(path string) ([]string, error) {
+	if err := checkWithin(r.root, path); err != nil {
+		return nil, err
+	}
+
+	return r.FileSystem.ReadDir(path)
+}
+
+func (r rootedFs) Walk(path string, walkFn filepath.WalkFunc) error {
+	if err := checkWithin(r.root, path); err != nil {
+		return err
+	}
+
+	return r.FileSystem.Walk(path, walkFn)
+}
+
+// ApplyOverlay applies the kustomize overlay of the Cdk8sAppProxy to the synthesized resources.
+func ApplyOverlay(parsedResources []*unstructured.Unstructured, overlay *addonsv1alpha1.KustomizeSpec, logger logr.Logger) (overlaid []*unstructured.Unstructured, err error) {
+	var resources []byte
+	for _, resource := range parsedResources {
+		content, err := yaml.Marshal(resource.Object)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, "---\n"...)
+		resources = append(resources, content...)
+	}
+
+	kustomization := kustypes.Kustomization{
+		TypeMeta:  kustypes.TypeMeta{APIVersion: kustypes.KustomizationVersion, Kind: kustypes.KustomizationKind},
+		Resources: []string{overlayResources},
+		Namespace: overlay.Namespace,
+	}
+	for _, patch := range overlay.Patches {
+		kustomizePatch := kustypes.Patch{Patch: patch.Patch}
+		if target := patch.Target; target != nil {
+			kustomizePatch.Target = &kustypes.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Group: target.Group, Version: target.Version, Kind: target.Kind},
+					Name:      target.Name,
+					Namespace: target.Namespace,
+				},
+				LabelSelector:      target.LabelSelector,
+				AnnotationSelector: target.AnnotationSelector,
+			}
+		}
+		kustomization.Patches = append(kustomization.Patches, kustomizePatch)
+	}
+	for _, image := range overlay.Images {
+		kustomization.Images = append(kustomization.Images, kustypes.Image{
+			Name:    image.Name,
+			NewName: image.NewName,
+			NewTag:  image.NewTag,
+			Digest:  image.Digest,
+		})
+	}
+
+	content, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := filesys.MakeFsInMemory()
+	if err = fs.MkdirAll(overlayDir); err != nil {
+		return nil, err
+	}
+	if err = fs.WriteFile(filepath.Join(overlayDir, "kustomization.yaml"), content); err != nil {
+		return nil, err
+	}
+	if err = fs.WriteFile(filepath.Join(overlayDir, overlayResources), resources); err != nil {
+		return nil, err
+	}
+
+	return runKustomize(fs, overlayDir, logger)
+}
+
+// runKustomize builds the kustomization in dir of fs without plugins and parses the result.
+func runKustomize(fs filesys.FileSystem, dir string, logger logr.Logger) (parsedResources []*unstructured.Unstructured, err error) {
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, dir)
+	if err != nil {
+		logger.Error(err, "Failed to build kustomization", "directory", dir)
+
+		return nil, errors.Wrap(err, "kustomize build failed")
+	}
+
+	content, err := resMap.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeManifests(content, logger)
+}
@@ -0,0 +1,116 @@
+package synthesizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const deploymentManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestKustomizeRoots(t *testing.T) {
+	roots := kustomizeRoots([]string{
+		"/dist/overlay/kustomization.yaml",
+		"/dist/overlay/base/kustomization.yaml",
+		"/dist/other/kustomization.yaml",
+		"/dist/overlay-2/kustomization.yaml",
+	})
+	assert.Equal(t, []string{"/dist/other", "/dist/overlay", "/dist/overlay-2"}, roots)
+}
+
+func TestKustomizeBuild(t *testing.T) {
+	dist := t.TempDir()
+	writeFiles(t, dist, map[string]string{
+		"base/kustomization.yaml": "resources:\n  - deployment.yaml\n",
+		"base/deployment.yaml":    deploymentManifest,
+		"kustomization.yaml": `resources:
+  - base
+namePrefix: prod-
+labels:
+  - pairs:
+      tier: web
+configMapGenerator:
+  - name: settings
+    literals:
+      - mode=production
+patches:
+  - patch: |
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: web
+      spec:
+        replicas: 3
+`,
+	})
+
+	resources, err := kustomizeBuild(dist, dist, logr.Discard())
+	assert.NoError(t, err)
+	assert.Len(t, resources, 2)
+
+	byKind := map[string]*unstructured.Unstructured{}
+	for _, resource := range resources {
+		byKind[resource.GetKind()] = resource
+	}
+	assert.Contains(t, byKind["ConfigMap"].GetName(), "prod-settings-")
+	assert.Equal(t, "prod-web", byKind["Deployment"].GetName())
+	assert.Equal(t, map[string]string{"tier": "web"}, byKind["Deployment"].GetLabels())
+	replicas, _, _ := unstructured.NestedInt64(byKind["Deployment"].Object, "spec", "replicas")
+	assert.Equal(t, int64(3), replicas)
+
+	writeFiles(t, dist, map[string]string{"kustomization.yaml": "resources:\n  - ../outside.yaml\n"})
+	_, err = kustomizeBuild(dist, dist, logr.Discard())
+	assert.ErrorContains(t, err, "kustomize build failed")
+}
+
+func TestApplyOverlay(t *testing.T) {
+	resources, err := decodeManifests([]byte(deploymentManifest+"---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: web\n"), logr.Discard())
+	assert.NoError(t, err)
+
+	overlay := &addonsv1alpha1.KustomizeSpec{
+		Namespace: "apps",
+		Images:    []addonsv1alpha1.KustomizeImage{{Name: "nginx", NewName: "registry.example.com/nginx", NewTag: "1.27"}},
+		Patches: []addonsv1alpha1.KustomizePatch{{
+			Patch:  "- op: add\n  path: /metadata/annotations\n  value:\n    team: platform\n",
+			Target: &addonsv1alpha1.KustomizeSelector{Kind: "Deployment"},
+		}},
+	}
+
+	overlaid, err := ApplyOverlay(resources, overlay, logr.Discard())
+	assert.NoError(t, err)
+	assert.Len(t, overlaid, 2)
+
+	deployment := overlaid[1]
+	if overlaid[0].GetKind() == "Deployment" {
+		deployment = overlaid[0]
+	}
+	assert.Equal(t, "apps", deployment.GetNamespace())
+	assert.Equal(t, map[string]string{"team": "platform"}, deployment.GetAnnotations())
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	assert.Equal(t, "registry.example.com/nginx:1.27", containers[0].(map[string]any)["image"])
+}
@@ -0,0 +1,220 @@
+package synthesizer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stepOutputTail is the number of trailing bytes of the output of a step kept for logs and errors.
+const stepOutputTail = 64 * 1024
+
+// outputPollInterval is the interval the output of a running synth step is measured in.
+var outputPollInterval = 500 * time.Millisecond
+
+// allowedEnv lists the environment variables of the controller handed to synth steps. All other
+// variables, e.g. credentials of the controller, are scrubbed.
+var allowedEnv = []string{
+	"PATH", "LANG", "LC_ALL", "TZ",
+	"GOROOT", "GOPROXY", "GONOSUMDB", "GOFLAGS",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "NODE_EXTRA_CA_CERTS", "JAVA_HOME",
+}
+
+// Limits bound the resources of the steps of an in-process synthesis. Zero values disable a limit.
+type Limits struct {
+	// StepTimeout bounds the duration of each step, e.g. the dependency installation and cdk8s synth.
+	StepTimeout time.Duration
+
+	// MaxOutputBytes bounds the size of the manifests written to dist. It is measured while cdk8s
+	// synth runs, which is killed once dist exceeds it, and checked again after the step.
+	MaxOutputBytes int64
+
+	// CPUTime bounds the CPU time of each process of a step (RLIMIT_CPU).
+	CPUTime time.Duration
+
+	// CgroupParent is a cgroup v2 directory delegated to the controller with the memory and cpu
+	// controllers enabled for its children. Each step runs in a child cgroup limited by Memory and
+	// CPU. Without it, Memory and CPU are not enforced.
+	CgroupParent string
+
+	// Memory bounds the memory of each step in bytes (memory.max).
+	Memory int64
+
+	// MilliCPU bounds the CPU bandwidth of each step in thousandths of a CPU (cpu.max).
+	MilliCPU int64
+}
+
+// LimitError reports a synth step exceeding one of its Limits.
+type LimitError struct {
+	// Step is the command line of the step.
+	Step string
+
+	// Limit describes the exceeded limit, e.g. "timeout of 10m0s".
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded the %s", e.Step, e.Limit)
+}
+
+// tailBuffer is an io.Writer keeping the last limit bytes written to it.
+type tailBuffer struct {
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (n int, err error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = append([]byte{}, b.data[len(b.data)-b.limit:]...)
+		b.truncated = true
+	}
+
+	return len(p), nil
+}
+
+// String returns the kept output, marked if earlier output was dropped.
+func (b *tailBuffer) String() string {
+	if b.truncated {
+		return "[output truncated]\n" + string(b.data)
+	}
+
+	return string(b.data)
+}
+
+// sandbox is the isolated HOME and temp dir of a synthesis.
+type sandbox struct {
+	dir string
+}
+
+// newSandbox creates the HOME and temp dir of a synthesis below the temp dir of the controller.
+func newSandbox() (s *sandbox, err error) {
+	dir, err := os.MkdirTemp("", "cdk8s-synth-")
+	if err != nil {
+		return nil, err
+	}
+
+	s = &sandbox{dir: dir}
+	for _, sub := range []string{s.home(), s.tmp()} {
+		if err = os.Mkdir(sub, 0o700); err != nil {
+			s.remove()
+
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *sandbox) home() string {
+	return filepath.Join(s.dir, "home")
+}
+
+func (s *sandbox) tmp() string {
+	return filepath.Join(s.dir, "tmp")
+}
+
+func (s *sandbox) remove() {
+	_ = os.RemoveAll(s.dir)
+}
+
+// scrubbedEnviron returns the allowlisted environment of the controller with HOME and the temp dir
+// pointing into the sandbox.
+func scrubbedEnviron(s *sandbox) (environ []string) {
+	for _, name := range allowedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			environ = append(environ, name+"="+value)
+		}
+	}
+
+	return append(environ, "HOME="+s.home(), "TMPDIR="+s.tmp(), "TMP="+s.tmp(), "TEMP="+s.tmp())
+}
+
+// checkOutputSize fails with a LimitError if the manifests in dist exceed MaxOutputBytes.
+func (l Limits) checkOutputSize(apiPath string) (err error) {
+	if l.MaxOutputBytes <= 0 {
+		return nil
+	}
+
+	size, err := outputSize(filepath.Join(apiPath, "dist"))
+	if err != nil {
+		return err
+	}
+
+	if size > l.MaxOutputBytes {
+		return &LimitError{Step: "cdk8s synth", Limit: fmt.Sprintf("output size of %d bytes with %d bytes", l.MaxOutputBytes, size)}
+	}
+
+	return nil
+}
+
+// outputSize returns the size of the files below dir, zero if dir does not exist.
+func outputSize(dir string) (size int64, err error) {
+	err = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return size, err
+	}
+
+	return size, nil
+}
+
+// watchOutputSize checks the size of the files below dir every interval until ctx is done. Once they
+// exceed limit, it stores their size in exceeded and calls kill.
+func watchOutputSize(ctx context.Context, dir string, interval time.Duration, limit int64, exceeded *atomic.Int64, kill func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if size, err := outputSize(dir); err == nil && size > limit {
+				exceeded.Store(size)
+				kill()
+
+				return
+			}
+		}
+	}
+}
+
+// checkFileSize returns a LimitError if the output file of the step exceeds MaxOutputBytes.
+func (l Limits) checkFileSize(step, path string) (err error) {
+	if l.MaxOutputBytes <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() > l.MaxOutputBytes {
+		return &LimitError{Step: step, Limit: fmt.Sprintf("output size of %d bytes with %d bytes", l.MaxOutputBytes, info.Size())}
+	}
+
+	return nil
+}
+
+// stepName returns the command line of a step for logs and errors.
+func stepName(name string, args []string) string {
+	return strings.Join(append([]string{filepath.Base(name)}, args...), " ")
+}
@@ -0,0 +1,177 @@
+//go:build linux
+
+package synthesizer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	// cpuPeriod is the cgroup CPU bandwidth period in microseconds.
+	cpuPeriod = 100000
+
+	// shell sets the CPU time limit of the steps.
+	shell = "/bin/sh"
+)
+
+// stepLimits enforces the Limits on the processes of a single step.
+type stepLimits struct {
+	limits Limits
+	cgroup string
+	fd     *os.File
+}
+
+// prepare configures cmd to run in its own process group, which is killed as a whole on timeouts,
+// with the CPU time limit and, with a cgroup parent, in a child cgroup bounding its memory and CPU.
+func (l Limits) prepare(cmd *exec.Cmd) (s *stepLimits, err error) {
+	s = &stepLimits{limits: l}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if l.CPUTime > 0 && cmd.Err == nil {
+		limitCPUTime(cmd, l.CPUTime)
+	}
+
+	if l.CgroupParent == "" || (l.Memory <= 0 && l.MilliCPU <= 0) {
+		return s, nil
+	}
+
+	s.cgroup = filepath.Join(l.CgroupParent, "cdk8s-synth-"+utilrand.String(8))
+	if err = os.Mkdir(s.cgroup, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	if l.Memory > 0 {
+		if err = os.WriteFile(filepath.Join(s.cgroup, "memory.max"), []byte(strconv.FormatInt(l.Memory, 10)), 0o644); err != nil {
+			s.close()
+
+			return nil, fmt.Errorf("failed to set memory limit: %w", err)
+		}
+	}
+	if l.MilliCPU > 0 {
+		quota := l.MilliCPU * cpuPeriod / 1000
+		if err = os.WriteFile(filepath.Join(s.cgroup, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, cpuPeriod)), 0o644); err != nil {
+			s.close()
+
+			return nil, fmt.Errorf("failed to set CPU limit: %w", err)
+		}
+	}
+
+	if s.fd, err = os.Open(s.cgroup); err != nil {
+		s.close()
+
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(s.fd.Fd())
+
+	return s, nil
+}
+
+// isolateNetwork runs cmd in a network namespace of its own, which has no interfaces besides a
+// loopback device that is down. It reports whether network namespaces are available.
+func isolateNetwork(cmd *exec.Cmd) bool {
+	if !networkNamespaces() {
+		return false
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	withNetworkNamespace(cmd.SysProcAttr)
+
+	return true
+}
+
+// networkNamespaces reports whether the controller can create network namespaces, e.g. they are
+// not blocked by seccomp or disabled user namespaces, by running true in one.
+var networkNamespaces = sync.OnceValue(func() bool {
+	path, err := exec.LookPath("true")
+	if err != nil {
+		return false
+	}
+
+	cmd := exec.Command(path)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	withNetworkNamespace(cmd.SysProcAttr)
+
+	return cmd.Run() == nil
+})
+
+// withNetworkNamespace lets the process start in a new network namespace. Without root, it is owned
+// by a new user namespace mapping the user of the controller.
+func withNetworkNamespace(attr *syscall.SysProcAttr) {
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+	if os.Geteuid() == 0 {
+		return
+	}
+
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+}
+
+// limitCPUTime runs cmd through sh, which sets the CPU time limit before executing the command, so
+// that no process of the step runs without it. Processes it forks inherit the limit.
+func limitCPUTime(cmd *exec.Cmd, cpuTime time.Duration) {
+	seconds := int64(cpuTime.Seconds())
+	// The process receives SIGXCPU at the soft limit and SIGKILL at the hard limit.
+	script := fmt.Sprintf(`ulimit -S -t %d && ulimit -H -t %d && exec "$0" "$@"`, seconds, seconds+5)
+
+	cmd.Args = append([]string{shell, "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+}
+
+// exceeded returns the description of the limit the finished process exceeded, if any.
+func (s *stepLimits) exceeded(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+
+	if s.limits.CPUTime > 0 && (status.Signal() == syscall.SIGXCPU || state.UserTime()+state.SystemTime() >= s.limits.CPUTime) {
+		return fmt.Sprintf("CPU time limit of %s", s.limits.CPUTime)
+	}
+
+	if s.cgroup != "" && s.limits.Memory > 0 {
+		events, err := os.ReadFile(filepath.Join(s.cgroup, "memory.events"))
+		if err == nil && oomKilled(events) {
+			return fmt.Sprintf("memory limit of %d bytes", s.limits.Memory)
+		}
+	}
+
+	return ""
+}
+
+// close removes the cgroup of the step.
+func (s *stepLimits) close() {
+	if s.fd != nil {
+		_ = s.fd.Close()
+	}
+	if s.cgroup != "" {
+		_ = os.Remove(s.cgroup)
+	}
+}
+
+// oomKilled reports whether memory.events counts an OOM kill.
+func oomKilled(events []byte) bool {
+	for _, line := range bytes.Split(events, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) == 2 && string(fields[0]) == "oom_kill" && string(fields[1]) != "0" {
+			return true
+		}
+	}
+
+	return false
+}
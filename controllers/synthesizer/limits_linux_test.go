@@ -0,0 +1,71 @@
+package synthesizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSynthesizeCPUTime(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "while :; do :; done\n")
+
+	_, err := (&Implementer{Limits: Limits{CPUTime: time.Second}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.EqualError(t, err, "cdk8s synth exceeded the CPU time limit of 1s")
+}
+
+func TestSynthesizeCPUTimeBeforeExec(t *testing.T) {
+	// The limit is set before the step runs, not after it started.
+	directory, proxy := fakeCdk8s(t, "ulimit -S -t > soft.txt\nulimit -H -t > hard.txt\nmkdir -p dist\n")
+
+	_, err := (&Implementer{Limits: Limits{CPUTime: 10 * time.Second}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+
+	soft, err := os.ReadFile(filepath.Join(directory, "soft.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "10\n", string(soft))
+	hard, err := os.ReadFile(filepath.Join(directory, "hard.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "15\n", string(hard))
+}
+
+func TestOOMKilled(t *testing.T) {
+	assert.True(t, oomKilled([]byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n")))
+	assert.False(t, oomKilled([]byte("low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n")))
+}
+
+func TestSynthesizeOfflineNetworkNamespace(t *testing.T) {
+	if !networkNamespaces() {
+		t.Skip("network namespaces are not available")
+	}
+
+	// The network namespace of the step has the loopback device only.
+	directory, proxy := fakeCdk8s(t, "grep -c : /proc/net/dev > interfaces.txt\nmkdir -p dist\n")
+	writeFiles(t, directory, map[string]string{"vendor/modules.txt": ""})
+
+	_, err := (&Implementer{Offline: true}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+
+	interfaces, err := os.ReadFile(filepath.Join(directory, "interfaces.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n", string(interfaces))
+}
+
+func TestSynthesizeOfflineWithoutNetworkNamespaces(t *testing.T) {
+	available := networkNamespaces
+	networkNamespaces = func() bool { return false }
+	defer func() { networkNamespaces = available }()
+
+	directory, proxy := fakeCdk8s(t, "mkdir -p dist\n")
+	writeFiles(t, directory, map[string]string{"vendor/modules.txt": ""})
+
+	_, err := (&Implementer{Offline: true}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.EqualError(t, err, "network namespaces are not available to isolate the offline step cdk8s synth")
+
+	_, err = (&Implementer{Offline: true, OfflineEnvOnly: true}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package synthesizer
+
+import (
+	"os"
+	"os/exec"
+)
+
+// stepLimits enforces the step timeout only, resource limits need Linux.
+type stepLimits struct{}
+
+func (l Limits) prepare(_ *exec.Cmd) (s *stepLimits, err error) {
+	return &stepLimits{}, nil
+}
+
+// isolateNetwork reports that network namespaces need Linux.
+func isolateNetwork(_ *exec.Cmd) bool {
+	return false
+}
+
+func (s *stepLimits) exceeded(_ *os.ProcessState) string {
+	return ""
+}
+
+func (s *stepLimits) close() {}
@@ -0,0 +1,104 @@
+package synthesizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+const configMapManifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"
+
+// fakeCdk8s puts a fake cdk8s binary running script into PATH and returns a Go app directory and proxy.
+func fakeCdk8s(t *testing.T, script string) (directory string, proxy *addonsv1alpha1.Cdk8sAppProxy) {
+	t.Helper()
+
+	binDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "cdk8s"), []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	proxy = &addonsv1alpha1.Cdk8sAppProxy{Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+		GitRepository: &addonsv1alpha1.GitRepositorySpec{},
+		Synth:         &addonsv1alpha1.SynthSpec{Language: addonsv1alpha1.LanguageGo},
+	}}
+
+	return t.TempDir(), proxy
+}
+
+func TestSynthesizeScrubsEnvironment(t *testing.T) {
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	directory, proxy := fakeCdk8s(t, "env > env.txt\nmkdir -p dist\nprintf '"+strings.ReplaceAll(configMapManifest, "\n", "\\n")+"' > dist/app.k8s.yaml\n")
+
+	manifests, err := (&Implementer{Env: map[string]string{"CDK8S_CLUSTER_NAME": "workload"}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 1)
+
+	env, err := os.ReadFile(filepath.Join(directory, "env.txt"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(env), "AWS_SECRET_ACCESS_KEY")
+	assert.Contains(t, string(env), "CDK8S_CLUSTER_NAME=workload")
+
+	var home string
+	for _, line := range strings.Split(string(env), "\n") {
+		if value, ok := strings.CutPrefix(line, "HOME="); ok {
+			home = value
+		}
+	}
+	assert.Contains(t, home, "cdk8s-synth-")
+	assert.NoDirExists(t, home, "the sandbox is removed after the synthesis")
+}
+
+func TestSynthesizeStepTimeout(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "sleep 30\n")
+
+	start := time.Now()
+	_, err := (&Implementer{Limits: Limits{StepTimeout: 200 * time.Millisecond}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.EqualError(t, err, "cdk8s synth exceeded the timeout of 200ms")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestSynthesizeOutputSize(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "mkdir -p dist\nprintf '"+strings.ReplaceAll(configMapManifest, "\n", "\\n")+"' > dist/app.k8s.yaml\n")
+
+	_, err := (&Implementer{Limits: Limits{MaxOutputBytes: 10}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.ErrorContains(t, err, "exceeded the output size of 10 bytes")
+}
+
+func TestSynthesizeOutputSizeWhileRunning(t *testing.T) {
+	previous := outputPollInterval
+	outputPollInterval = 10 * time.Millisecond
+	defer func() { outputPollInterval = previous }()
+
+	// The synth step never finishes on its own, it is killed once dist is too large.
+	directory, proxy := fakeCdk8s(t, "mkdir -p dist\nwhile true; do printf '0123456789' >> dist/app.k8s.yaml; sleep 0.01; done\n")
+
+	start := time.Now()
+	_, err := (&Implementer{Limits: Limits{MaxOutputBytes: 100, StepTimeout: time.Minute}}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.ErrorContains(t, err, "exceeded the output size of 100 bytes")
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestTailBuffer(t *testing.T) {
+	buffer := &tailBuffer{limit: 4}
+	_, _ = buffer.Write([]byte("ab"))
+	assert.Equal(t, "ab", buffer.String())
+
+	_, _ = buffer.Write([]byte("cdef"))
+	assert.Equal(t, "[output truncated]\ncdef", buffer.String())
+}
@@ -0,0 +1,172 @@
+package synthesizer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// closedProxy is the proxy of offline syntheses, a closed port refusing connections immediately.
+	closedProxy = "http://127.0.0.1:9"
+
+	// wheelhouseDir holds the vendored wheels of a Python app.
+	wheelhouseDir = "wheelhouse"
+)
+
+// nodeModulesTarballs are the vendored node_modules archives of a TypeScript app.
+var nodeModulesTarballs = []string{"node_modules.tar.gz", "node_modules.tgz"}
+
+// maxNodeModulesBytes bounds the extracted size of a node_modules tarball.
+var maxNodeModulesBytes int64 = 1 << 30
+
+// OfflineError reports dependencies an offline synthesis cannot install without network access.
+type OfflineError struct {
+	// Language is the language of the app.
+	Language string
+
+	// Missing describes the vendored dependencies the app lacks.
+	Missing string
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("offline synthesis of the %s app requires vendored dependencies: %s", e.Language, e.Missing)
+}
+
+// offlineEnv returns the environment variables keeping the package managers offline. Other
+// traffic is sent to a closed proxy, so steps fail fast instead of waiting for registry timeouts.
+func offlineEnv() []string {
+	env := []string{
+		"npm_config_offline=true",
+		"YARN_ENABLE_OFFLINE_MODE=1",
+		"GOPROXY=off",
+		"GOSUMDB=off",
+		"GOTOOLCHAIN=local",
+		"PIP_NO_INDEX=1",
+		"NO_PROXY=",
+		"no_proxy=",
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"} {
+		env = append(env, name+"="+closedProxy)
+	}
+
+	return env
+}
+
+// vendorNodeModules provides the vendored node modules of an offline synthesis: a committed
+// node_modules directory, or an extracted node_modules tarball. It reports whether the app vendors
+// its node modules.
+func vendorNodeModules(apiPath string, logger logr.Logger) (vendored bool, err error) {
+	if dirExists(apiPath, "node_modules") {
+		logger.Info("Using vendored node modules")
+
+		return true, nil
+	}
+
+	for _, tarball := range nodeModulesTarballs {
+		if !fileExists(apiPath, tarball) {
+			continue
+		}
+		logger.Info("Extracting vendored node modules", "tarball", tarball)
+
+		return true, extractNodeModules(filepath.Join(apiPath, tarball), apiPath)
+	}
+
+	return false, nil
+}
+
+// extractNodeModules extracts the gzipped tarball of node_modules into apiPath. Entries outside of
+// node_modules are refused, and symlinks are created last, so no entry is written through them. The
+// extraction fails once the files exceed maxNodeModulesBytes.
+func extractNodeModules(tarball, apiPath string) (err error) {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(tarball), err)
+	}
+	defer gz.Close()
+
+	root := filepath.Join(apiPath, "node_modules")
+	links := map[string]string{}
+	remaining := maxNodeModulesBytes
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(tarball), err)
+		}
+
+		target := filepath.Join(apiPath, header.Name)
+		if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return fmt.Errorf("%s contains %s outside of node_modules", filepath.Base(tarball), header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			var written int64
+			written, err = extractFile(io.LimitReader(reader, remaining+1), target, header.FileInfo().Mode().Perm())
+			remaining -= written
+			if err == nil && remaining < 0 {
+				err = fmt.Errorf("%s exceeds %d bytes when extracted", filepath.Base(tarball), maxNodeModulesBytes)
+			}
+		case tar.TypeSymlink:
+			links[target] = header.Linkname
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for target, link := range links {
+		if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err = os.Symlink(link, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractFile(reader io.Reader, target string, mode os.FileMode) (written int64, err error) {
+	if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return 0, err
+	}
+	if written, err = io.Copy(out, reader); err != nil {
+		_ = out.Close()
+
+		return written, err
+	}
+
+	return written, out.Close()
+}
+
+// dirExists reports whether name is a directory in dir.
+func dirExists(dir, name string) bool {
+	info, err := os.Stat(filepath.Join(dir, name))
+
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,201 @@
+package synthesizer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTarball writes a gzipped tarball of the files to path. Contents starting with "->" are symlinks.
+func writeTarball(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(content))}
+		if link, ok := bytes.CutPrefix([]byte(content), []byte("->")); ok {
+			header = &tar.Header{Name: name, Mode: 0o777, Typeflag: tar.TypeSymlink, Linkname: string(link)}
+		}
+		assert.NoError(t, writer.WriteHeader(header))
+		if header.Typeflag == tar.TypeReg {
+			_, err := writer.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+}
+
+func TestInstallDependenciesOffline(t *testing.T) {
+	fakeTools(t)
+
+	tests := []struct {
+		name        string
+		kind        ApplicationType
+		files       map[string]string
+		tarball     map[string]string
+		cache       bool
+		wantLog     string
+		wantMissing string
+		wantEnv     map[string]string
+	}{
+		{
+			name:  "committed node_modules",
+			kind:  cdk8sTypescript,
+			files: map[string]string{"package-lock.json": "{}", "node_modules/cdk8s/index.js": ""},
+		},
+		{
+			name:    "node_modules tarball",
+			kind:    cdk8sTypescript,
+			files:   map[string]string{"package-lock.json": "{}"},
+			tarball: map[string]string{"node_modules/cdk8s/index.js": "module.exports = {}\n", "node_modules/.bin/cdk8s": "->../cdk8s/index.js"},
+		},
+		{
+			name:    "npm cache",
+			kind:    cdk8sTypescript,
+			files:   map[string]string{"package-lock.json": "{}"},
+			cache:   true,
+			wantLog: "npm ci\n",
+		},
+		{
+			name:        "no node modules",
+			kind:        cdk8sTypescript,
+			files:       map[string]string{"package-lock.json": "{}"},
+			wantMissing: "no node_modules, no node_modules.tar.gz and no dependency cache",
+		},
+		{
+			name:    "wheelhouse",
+			kind:    cdk8sPython,
+			files:   map[string]string{"Pipfile": "", "wheelhouse/cdk8s-2.0.0-py3-none-any.whl": ""},
+			wantLog: "pipenv install\n",
+			wantEnv: map[string]string{"PIPENV_VENV_IN_PROJECT": "1"},
+		},
+		{
+			name:        "no wheelhouse",
+			kind:        cdk8sPython,
+			files:       map[string]string{"Pipfile": ""},
+			wantMissing: "no wheelhouse directory",
+		},
+		{
+			name:  "go vendor",
+			kind:  cdk8sGo,
+			files: map[string]string{"go.mod": "module app\n", "vendor/modules.txt": ""},
+		},
+		{
+			name:  "go cache",
+			kind:  cdk8sGo,
+			files: map[string]string{"go.mod": "module app\n"},
+			cache: true,
+		},
+		{
+			name:        "no go vendor",
+			kind:        cdk8sGo,
+			files:       map[string]string{"go.mod": "module app\n"},
+			wantMissing: "no vendor directory and no dependency cache",
+		},
+		{
+			name:    "maven repository",
+			kind:    cdk8sJava,
+			files:   map[string]string{"pom.xml": "", ".m2/repository/org/cdk8s/cdk8s.pom": ""},
+			wantLog: "mvn --batch-mode compile\n",
+		},
+		{
+			name:        "no gradle home",
+			kind:        cdk8sJava,
+			files:       map[string]string{"build.gradle": ""},
+			wantMissing: "no .gradle directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiPath := t.TempDir()
+			writeFiles(t, apiPath, tt.files)
+			if tt.tarball != nil {
+				writeTarball(t, filepath.Join(apiPath, "node_modules.tar.gz"), tt.tarball)
+			}
+			impl := &Implementer{Offline: true, OfflineEnvOnly: true}
+			if tt.cache {
+				cache, err := NewCache(t.TempDir(), 0)
+				assert.NoError(t, err)
+				impl.Cache = cache
+			}
+
+			env, err := impl.installDependencies(context.Background(), apiPath, string(tt.kind), cdk8sConfig{}, addonsv1alpha1.ToolchainSpec{}, nil, logr.Discard())
+			if tt.wantMissing != "" {
+				var offlineErr *OfflineError
+				assert.True(t, errors.As(err, &offlineErr))
+				assert.Equal(t, tt.wantMissing, offlineErr.Missing)
+
+				return
+			}
+			assert.NoError(t, err)
+
+			log, _ := os.ReadFile(filepath.Join(apiPath, "tools.log"))
+			assert.Equal(t, tt.wantLog, string(log))
+			if tt.kind == cdk8sJava {
+				assert.Equal(t, "--offline", env["MAVEN_ARGS"])
+				assert.Equal(t, "-Dmaven.repo.local="+filepath.Join(apiPath, ".m2", "repository"), env["MAVEN_OPTS"])
+
+				return
+			}
+			assert.Equal(t, tt.wantEnv, env)
+
+			if tt.tarball != nil {
+				content, err := os.ReadFile(filepath.Join(apiPath, "node_modules", ".bin", "cdk8s"))
+				assert.NoError(t, err)
+				assert.Equal(t, "module.exports = {}\n", string(content))
+			}
+		})
+	}
+}
+
+func TestExtractNodeModulesOutside(t *testing.T) {
+	apiPath := t.TempDir()
+	tarball := filepath.Join(apiPath, "node_modules.tar.gz")
+	writeTarball(t, tarball, map[string]string{"node_modules/../main.ts": "evil"})
+
+	assert.ErrorContains(t, extractNodeModules(tarball, apiPath), "outside of node_modules")
+	assert.NoFileExists(t, filepath.Join(apiPath, "main.ts"))
+}
+
+func TestExtractNodeModulesTooLarge(t *testing.T) {
+	apiPath := t.TempDir()
+	tarball := filepath.Join(apiPath, "node_modules.tar.gz")
+	writeTarball(t, tarball, map[string]string{
+		"node_modules/a.js": strings.Repeat("a", 600),
+		"node_modules/b.js": strings.Repeat("b", 600),
+	})
+	previous := maxNodeModulesBytes
+	maxNodeModulesBytes = 1000
+	defer func() { maxNodeModulesBytes = previous }()
+
+	assert.EqualError(t, extractNodeModules(tarball, apiPath), "node_modules.tar.gz exceeds 1000 bytes when extracted")
+}
+
+func TestSynthesizeOffline(t *testing.T) {
+	directory, proxy := fakeCdk8s(t, "env > env.txt\nmkdir -p dist\n")
+	writeFiles(t, directory, map[string]string{"vendor/modules.txt": ""})
+
+	_, err := (&Implementer{Offline: true, OfflineEnvOnly: true}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+
+	env, err := os.ReadFile(filepath.Join(directory, "env.txt"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(env), "GOPROXY=off\n")
+	assert.Contains(t, string(env), "npm_config_offline=true\n")
+	assert.Contains(t, string(env), "HTTPS_PROXY="+closedProxy+"\n")
+}
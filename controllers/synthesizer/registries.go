@@ -0,0 +1,199 @@
+package synthesizer
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+// defaultGoProxy is the module proxy of the go command if the controller sets none.
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+// Registry is a private package registry with the credentials of a synth run.
+type Registry struct {
+	addonsv1alpha1.RegistrySpec `json:",inline"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// login returns the user name and password of the registry. Tokens are sent as password of
+// defaultUser unless a user name is set.
+func (r Registry) login(defaultUser string) (username, password string) {
+	username, password = r.Username, r.Password
+	if r.Token != "" {
+		password = r.Token
+		if username == "" {
+			username = defaultUser
+		}
+	}
+
+	return username, password
+}
+
+// hasCredentials reports whether the Secret of the registry held credentials.
+func (r Registry) hasCredentials() bool {
+	return r.Token != "" || r.Username != "" || r.Password != ""
+}
+
+// writeRegistryConfig writes the .npmrc, pip.conf and .netrc of the registries into the sandbox
+// and returns the environment variables pointing npm, pip, git and go to them along with the files
+// written. The files are only readable by the controller and removed after the install steps.
+func writeRegistryConfig(registries []Registry, s *sandbox) (env, files []string, err error) {
+	var npmrc, pipIndexes, netrc, goProxies, goPrivate, goNoSumDB []string
+
+	for _, registry := range registries {
+		switch registry.Kind {
+		case addonsv1alpha1.RegistryKindNpm:
+			lines, err := npmrcLines(registry)
+			if err != nil {
+				return nil, nil, err
+			}
+			npmrc = append(npmrc, lines...)
+		case addonsv1alpha1.RegistryKindPyPI:
+			index, err := url.Parse(registry.URL)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "invalid pypi registry URL %q", registry.URL)
+			}
+			if registry.hasCredentials() {
+				index.User = url.UserPassword(registry.login("__token__"))
+			}
+			pipIndexes = append(pipIndexes, index.String())
+		case addonsv1alpha1.RegistryKindGo:
+			hosts := make([]string, 0, len(registry.Modules))
+			if registry.URL != "" {
+				proxy, err := url.Parse(registry.URL)
+				if err != nil {
+					return nil, nil, errors.Wrapf(err, "invalid go registry URL %q", registry.URL)
+				}
+				goProxies = append(goProxies, registry.URL)
+				hosts = append(hosts, proxy.Hostname())
+			} else {
+				goPrivate = append(goPrivate, registry.Modules...)
+				for _, module := range registry.Modules {
+					if host, _, _ := strings.Cut(module, "/"); !strings.ContainsAny(host, "*?[") {
+						hosts = append(hosts, host)
+					}
+				}
+			}
+			goNoSumDB = append(goNoSumDB, registry.Modules...)
+
+			if registry.hasCredentials() {
+				username, password := registry.login("token")
+				for _, host := range hosts {
+					netrc = append(netrc, "machine "+host+" login "+username+" password "+password)
+				}
+			}
+		}
+	}
+
+	if len(npmrc) > 0 {
+		path := filepath.Join(s.home(), ".npmrc")
+		if err = writePrivate(path, npmrc); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, path)
+		env = append(env, "NPM_CONFIG_USERCONFIG="+path)
+	}
+
+	if len(pipIndexes) > 0 {
+		lines := []string{"[global]", "index-url = " + pipIndexes[0]}
+		if len(pipIndexes) > 1 {
+			lines = append(lines, "extra-index-url = "+strings.Join(pipIndexes[1:], " "))
+		}
+		path := filepath.Join(s.home(), "pip.conf")
+		if err = writePrivate(path, lines); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, path)
+		env = append(env, "PIP_CONFIG_FILE="+path)
+	}
+
+	if len(netrc) > 0 {
+		path := filepath.Join(s.home(), ".netrc")
+		if err = writePrivate(path, netrc); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, path)
+		// git reads .netrc from HOME, which is the sandbox, go from NETRC.
+		env = append(env, "NETRC="+path, "GIT_TERMINAL_PROMPT=0")
+	}
+
+	if len(goProxies) > 0 {
+		env = append(env, "GOPROXY="+strings.Join(append(goProxies, envOr("GOPROXY", defaultGoProxy)), ","))
+	}
+	if len(goPrivate) > 0 {
+		env = append(env, "GOPRIVATE="+joinEnvList("GOPRIVATE", goPrivate))
+	}
+	if len(goNoSumDB) > 0 {
+		env = append(env, "GONOSUMDB="+joinEnvList("GONOSUMDB", goNoSumDB))
+	}
+
+	return env, files, nil
+}
+
+// hasGoRegistry reports whether one of the registries serves Go modules.
+func hasGoRegistry(registries []Registry) bool {
+	for _, registry := range registries {
+		if registry.Kind == addonsv1alpha1.RegistryKindGo {
+			return true
+		}
+	}
+
+	return false
+}
+
+// npmrcLines returns the .npmrc lines selecting the registry and authenticating against it.
+func npmrcLines(registry Registry) (lines []string, err error) {
+	registryURL, err := url.Parse(registry.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid npm registry URL %q", registry.URL)
+	}
+
+	base := strings.TrimSuffix(registryURL.String(), "/") + "/"
+	if registry.Scope != "" {
+		lines = append(lines, registry.Scope+":registry="+base)
+	} else {
+		lines = append(lines, "registry="+base)
+	}
+
+	// Credentials are bound to the registry URL without scheme.
+	nerfDart := "//" + registryURL.Host + strings.TrimSuffix(registryURL.Path, "/") + "/"
+	switch {
+	case registry.Token != "":
+		lines = append(lines, nerfDart+":_authToken="+registry.Token)
+	case registry.Username != "":
+		lines = append(lines, nerfDart+":_auth="+base64.StdEncoding.EncodeToString([]byte(registry.Username+":"+registry.Password)))
+	}
+
+	return lines, nil
+}
+
+// writePrivate writes the lines to a file only readable by the controller.
+func writePrivate(path string, lines []string) error {
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// envOr returns the environment variable of the controller, or fallback if it is not set.
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// joinEnvList appends values to the comma separated list in the environment variable of the controller.
+func joinEnvList(name string, values []string) string {
+	if value := os.Getenv(name); value != "" {
+		values = append([]string{value}, values...)
+	}
+
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,259 @@
+package synthesizer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Renderer renders the resources of an app.
+type Renderer interface {
+	Render(ctx context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error)
+}
+
+// App is an app checked out for rendering.
+type App struct {
+	// Root is the directory of the checked out repository.
+	Root string
+
+	// Path is the directory of the app below Root.
+	Path string
+
+	// TempDir is a directory for temporary files, removed after rendering.
+	TempDir string
+
+	// Cdk8sAppProxy is the proxy of the app.
+	Cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy
+
+	// Context holds the input values and, in per-cluster synthesis, the cluster handed to the app.
+	Context map[string]any
+
+	// Environ is the scrubbed environment of the commands run for the app.
+	Environ []string
+
+	// installEnviron extends Environ by the configuration of the registries for the install steps.
+	installEnviron []string
+	registryFiles  []string
+
+	implementer *Implementer
+}
+
+// removeRegistryConfig removes the registry configuration with the credentials once the
+// dependencies are installed, before code of the app runs.
+func (a *App) removeRegistryConfig() (err error) {
+	for _, file := range a.registryFiles {
+		if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run runs a command in the app path within the limits of the synthesis.
+func (a *App) Run(ctx context.Context, logger logr.Logger, name string, args ...string) (err error) {
+	return a.implementer.runStep(ctx, a.Path, a.Environ, logger, name, args...)
+}
+
+var (
+	renderersLock sync.RWMutex
+	renderers     = map[addonsv1alpha1.Renderer]Renderer{
+		addonsv1alpha1.RendererCdk8s:     cdk8sRenderer{},
+		addonsv1alpha1.RendererYAML:      yamlRenderer{},
+		addonsv1alpha1.RendererKustomize: kustomizeRenderer{},
+		addonsv1alpha1.RendererJsonnet:   jsonnetRenderer{},
+		addonsv1alpha1.RendererCUE:       cueRenderer{},
+	}
+)
+
+// RegisterRenderer adds the renderer of name to the registry, replacing a registered one.
+func RegisterRenderer(name addonsv1alpha1.Renderer, renderer Renderer) {
+	renderersLock.Lock()
+	defer renderersLock.Unlock()
+
+	renderers[name] = renderer
+}
+
+// lookupRenderer returns the registered renderer of name, defaulting to cdk8s.
+func lookupRenderer(name addonsv1alpha1.Renderer) (renderer Renderer, err error) {
+	if name == "" {
+		name = addonsv1alpha1.RendererCdk8s
+	}
+
+	renderersLock.RLock()
+	defer renderersLock.RUnlock()
+
+	renderer, ok := renderers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown renderer %q", name)
+	}
+
+	return renderer, nil
+}
+
+// yamlRenderer reads the YAML and JSON manifests in the app path and its subdirectories. Manifests
+// must stay in the repository.
+type yamlRenderer struct{}
+
+func (yamlRenderer) Render(_ context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error) {
+	var manifests []string
+	err = filepath.WalkDir(app.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != app.Path && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		switch filepath.Ext(d.Name()) {
+		case ".yaml", ".yml", ".json":
+			if isKustomization(d.Name()) {
+				return nil
+			}
+			// Symlinks must not let the controller read files outside of the repository.
+			if err := checkWithin(app.Root, path); err != nil {
+				return err
+			}
+			manifests = append(manifests, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "Failed to walk app directory")
+
+		return nil, err
+	}
+
+	return parseCharts(app, app.Path, manifests, logger)
+}
+
+// kustomizeRenderer builds the kustomization in the app path. Bases can be anywhere in the repository.
+// For spec.chartTargets, its resources belong to the chart ".", unless they are annotated.
+type kustomizeRenderer struct{}
+
+func (kustomizeRenderer) Render(_ context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error) {
+	parsedManifests, err = kustomizeBuild(app.Root, app.Path, logger)
+	if err != nil {
+		return nil, err
+	}
+	annotateChart(app, ".", parsedManifests)
+
+	return parsedManifests, nil
+}
+
+// chartsFromValue returns the manifests in value like manifestsFromValue. For spec.chartTargets, the
+// manifests in a field of an object at the top level that is no manifest itself are annotated
+// with the name of the field as their chart.
+func chartsFromValue(app *App, value any) (parsedManifests []*unstructured.Unstructured, err error) {
+	fields, ok := value.(map[string]any)
+	if !ok || len(app.Cdk8sAppProxy.Spec.ChartTargets) == 0 {
+		return manifestsFromValue(value)
+	}
+	if _, ok := fields["kind"].(string); ok {
+		if _, ok := fields["apiVersion"].(string); ok {
+			return manifestsFromValue(value)
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		manifests, err := manifestsFromValue(fields[key])
+		if err != nil {
+			return nil, errors.Wrap(err, key)
+		}
+		annotateChart(app, key, manifests)
+		parsedManifests = append(parsedManifests, manifests...)
+	}
+
+	return parsedManifests, nil
+}
+
+// manifestsFromValue returns the manifests in the evaluated output of a configuration language: a
+// manifest, a List, or arrays and objects of them, which are traversed in key order.
+func manifestsFromValue(value any) (parsedManifests []*unstructured.Unstructured, err error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		for _, item := range typed {
+			manifests, err := manifestsFromValue(item)
+			if err != nil {
+				return nil, err
+			}
+			parsedManifests = append(parsedManifests, manifests...)
+		}
+
+		return parsedManifests, nil
+	case map[string]any:
+		if _, ok := typed["kind"].(string); ok {
+			if _, ok := typed["apiVersion"].(string); ok {
+				manifest := &unstructured.Unstructured{Object: typed}
+				if manifest.IsList() {
+					return manifestsFromValue(typed["items"])
+				}
+
+				return []*unstructured.Unstructured{manifest}, nil
+			}
+		}
+
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			manifests, err := manifestsFromValue(typed[key])
+			if err != nil {
+				return nil, errors.Wrap(err, key)
+			}
+			parsedManifests = append(parsedManifests, manifests...)
+		}
+
+		return parsedManifests, nil
+	}
+
+	return nil, fmt.Errorf("expected manifests, arrays or objects, got %T", value)
+}
+
+// checkWithin fails if path, after resolving symlinks, is not below root.
+func checkWithin(root, path string) (err error) {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if evaluated, err := filepath.EvalSymlinks(resolved); err == nil {
+		resolved = evaluated
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	relative, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return errors.Errorf("%s is outside of the repository", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package synthesizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newRendererProxy(renderer addonsv1alpha1.Renderer, path string) *addonsv1alpha1.Cdk8sAppProxy {
+	return &addonsv1alpha1.Cdk8sAppProxy{Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+		GitRepository: &addonsv1alpha1.GitRepositorySpec{Path: path},
+		Renderer:      renderer,
+	}}
+}
+
+func names(manifests []*unstructured.Unstructured) (result []string) {
+	for _, manifest := range manifests {
+		result = append(result, manifest.GetKind()+"/"+manifest.GetName())
+	}
+
+	return result
+}
+
+func TestYAMLRenderer(t *testing.T) {
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		"app/deployment.yaml":        deploymentManifest,
+		"app/config/cm.yml":          configMapManifest,
+		"app/config/service.json":    `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "web"}}`,
+		"app/kustomization.yaml":     "resources: []\n",
+		"app/.github/workflow.yaml":  "on: push\n",
+		"app/node_modules/pkg/x.yml": "x: 1\n",
+	})
+
+	manifests, err := (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererYAML, "app"), logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/cm", "Service/web", "Deployment/web"}, names(manifests))
+
+	// Symlinks within the repository are read, those leaving it are not.
+	assert.NoError(t, os.Symlink(filepath.Join(repo, "app", "deployment.yaml"), filepath.Join(repo, "app", "linked.yaml")))
+	_, err = (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererYAML, "app"), logr.Discard(), context.Background())
+	assert.NoError(t, err)
+
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret.yaml": configMapManifest})
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.yaml"), filepath.Join(repo, "app", "secret.yaml")))
+	_, err = (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererYAML, "app"), logr.Discard(), context.Background())
+	assert.ErrorContains(t, err, "is outside of the repository")
+}
+
+func TestKustomizeRenderer(t *testing.T) {
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		"base/kustomization.yaml":          "resources:\n  - deployment.yaml\n",
+		"base/deployment.yaml":             deploymentManifest,
+		"overlays/prod/kustomization.yaml": "resources:\n  - ../../base\nnameSuffix: -prod\n",
+	})
+
+	manifests, err := (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererKustomize, "overlays/prod"), logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Deployment/web-prod"}, names(manifests))
+
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"kustomization.yaml": "resources:\n  - cm.yaml\n", "cm.yaml": configMapManifest})
+	assert.NoError(t, os.Symlink(outside, filepath.Join(repo, "outside")))
+	writeFiles(t, repo, map[string]string{"overlays/prod/kustomization.yaml": "resources:\n  - ../../outside\n"})
+
+	_, err = (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererKustomize, "overlays/prod"), logr.Discard(), context.Background())
+	assert.ErrorContains(t, err, "kustomize build failed", "the kustomization outside of the repository is not read")
+}
+
+func TestMain(m *testing.M) {
+	// The jsonnet renderer runs the test binary in place of the manager.
+	if len(os.Args) > 1 && os.Args[1] == JsonnetCommand {
+		if err := RunJsonnet(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestJsonnetRenderer(t *testing.T) {
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		"app/lib/labels.libsonnet": "{ app: 'web' }",
+		"app/main.jsonnet": `local labels = import 'labels.libsonnet';
+local values = std.extVar('values');
+{
+  config: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'web', labels: labels }, data: { replicas: std.toString(values.replicas) } },
+  list: { apiVersion: 'v1', kind: 'List', items: [{ apiVersion: 'v1', kind: 'Service', metadata: { name: 'web' } }] },
+}
+`,
+	})
+
+	impl := &Implementer{}
+	assert.NoError(t, impl.WithValues(map[string]any{"replicas": 3}))
+	manifests, err := impl.Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererJsonnet, "app"), logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/web", "Service/web"}, names(manifests))
+	assert.Equal(t, map[string]string{"app": "web"}, manifests[0].GetLabels())
+	replicas, _, _ := unstructured.NestedString(manifests[0].Object, "data", "replicas")
+	assert.Equal(t, "3", replicas)
+
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret.jsonnet": "{}"})
+	writeFiles(t, repo, map[string]string{"app/main.jsonnet": "import '" + filepath.Join(outside, "secret.jsonnet") + "'"})
+	_, err = (&Implementer{}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererJsonnet, "app"), logr.Discard(), context.Background())
+	assert.EqualError(t, err, "jsonnet main.jsonnet failed: exit status 1")
+	assert.Contains(t, OutputTail(err, 5), "is outside of the repository")
+
+	// The evaluation is a step bounded by the step timeout.
+	writeFiles(t, repo, map[string]string{"app/main.jsonnet": "local loop(n) = if n == 0 then {} else loop(n - 1) tailstrict; loop(1000000000)"})
+	_, err = (&Implementer{Limits: Limits{StepTimeout: time.Second}}).Synthesize(repo, newRendererProxy(addonsv1alpha1.RendererJsonnet, "app"), logr.Discard(), context.Background())
+	assert.EqualError(t, err, "jsonnet main.jsonnet exceeded the timeout of 1s")
+}
+
+func TestCUERenderer(t *testing.T) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != --outfile ]; do shift; done\nprintf '%s' '{\"web\": {\"apiVersion\": \"v1\", \"kind\": \"ConfigMap\", \"metadata\": {\"name\": \"web\"}}}' > \"$2\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "cue"), []byte(script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	manifests, err := (&Implementer{}).Synthesize(t.TempDir(), newRendererProxy(addonsv1alpha1.RendererCUE, ""), logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/web"}, names(manifests))
+}
+
+func TestManifestsFromValue(t *testing.T) {
+	_, err := manifestsFromValue(map[string]any{"replicas": 3.0})
+	assert.ErrorContains(t, err, "replicas: expected manifests, arrays or objects, got float64")
+
+	_, err = lookupRenderer("helm")
+	assert.EqualError(t, err, `unknown renderer "helm"`)
+}
+
+func TestSynthesizeOCIArtifact(t *testing.T) {
+	artifact := t.TempDir()
+	writeFiles(t, artifact, map[string]string{"dist/app.k8s.yaml": configMapManifest})
+
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+		OCIRepository: &addonsv1alpha1.OCIRepositorySpec{URL: "oci://ghcr.io/example/app-manifests", Path: "dist"},
+	}}
+
+	manifests, err := (&Implementer{}).Synthesize(artifact, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/cm"}, names(manifests))
+}
+
+func TestSynthesizeChartAnnotation(t *testing.T) {
+	annotated := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: token\n  annotations:\n    addons.cluster.x-k8s.io/chart: shared\n"
+	directory, proxy := fakeCdk8s(t, "mkdir -p dist\n"+
+		"printf '"+strings.ReplaceAll(configMapManifest, "\n", "\\n")+"' > dist/control-plane.k8s.yaml\n"+
+		"printf '"+strings.ReplaceAll(annotated, "\n", "\\n")+"' > dist/workload.k8s.yaml\n")
+
+	charts := func(manifests []*unstructured.Unstructured) (result []string) {
+		for _, manifest := range manifests {
+			result = append(result, manifest.GetAnnotations()[addonsv1alpha1.ChartAnnotation])
+		}
+
+		return result
+	}
+
+	// Without chart targets, the resources stay unchanged.
+	manifests, err := (&Implementer{}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "shared"}, charts(manifests))
+
+	proxy.Spec.ChartTargets = []addonsv1alpha1.ChartTarget{{Chart: "control-plane.k8s.yaml"}}
+	manifests, err = (&Implementer{}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"control-plane.k8s.yaml", "shared"}, charts(manifests))
+
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{"dist/crds/cm.yaml": configMapManifest})
+	yamlProxy := newRendererProxy(addonsv1alpha1.RendererYAML, "dist")
+	yamlProxy.Spec.ChartTargets = proxy.Spec.ChartTargets
+	manifests, err = (&Implementer{}).Synthesize(repo, yamlProxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"crds/cm.yaml"}, charts(manifests))
+
+	// The kustomizations in dist are charts named after their directory.
+	directory, proxy = fakeCdk8s(t, "mkdir -p dist/control-plane\n"+
+		"printf 'resources:\\n  - cm.yaml\\n' > dist/control-plane/kustomization.yaml\n"+
+		"printf '"+strings.ReplaceAll(configMapManifest, "\n", "\\n")+"' > dist/control-plane/cm.yaml\n")
+	proxy.Spec.ChartTargets = yamlProxy.Spec.ChartTargets
+	manifests, err = (&Implementer{}).Synthesize(directory, proxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"control-plane"}, charts(manifests))
+
+	writeFiles(t, repo, map[string]string{"app/kustomization.yaml": "resources:\n  - cm.yaml\n", "app/cm.yaml": configMapManifest})
+	kustomizeProxy := newRendererProxy(addonsv1alpha1.RendererKustomize, "app")
+	kustomizeProxy.Spec.ChartTargets = proxy.Spec.ChartTargets
+	manifests, err = (&Implementer{}).Synthesize(repo, kustomizeProxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"."}, charts(manifests))
+
+	// Jsonnet and CUE output charts as the fields of the top-level object.
+	writeFiles(t, repo, map[string]string{"app/main.jsonnet": "{ 'control-plane': [{ apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'web' } }] }"})
+	jsonnetProxy := newRendererProxy(addonsv1alpha1.RendererJsonnet, "app")
+	jsonnetProxy.Spec.ChartTargets = proxy.Spec.ChartTargets
+	manifests, err = (&Implementer{}).Synthesize(repo, jsonnetProxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"control-plane"}, charts(manifests))
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != --outfile ]; do shift; done\nprintf '%s' '{\"workload\": {\"apiVersion\": \"v1\", \"kind\": \"ConfigMap\", \"metadata\": {\"name\": \"web\"}}}' > \"$2\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "cue"), []byte(script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cueProxy := newRendererProxy(addonsv1alpha1.RendererCUE, "")
+	cueProxy.Spec.ChartTargets = proxy.Spec.ChartTargets
+	manifests, err = (&Implementer{}).Synthesize(t.TempDir(), cueProxy, logr.Discard(), context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"workload"}, charts(manifests))
+}
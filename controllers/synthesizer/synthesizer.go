@@ -5,7 +5,6 @@ import (
 	"context"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -22,46 +21,167 @@ const (
 	cdk8sGo         ApplicationType = "go"
 	cdk8sTypescript ApplicationType = "typescript"
 	cdk8sPython     ApplicationType = "python"
+	cdk8sJava       ApplicationType = "java"
 )
 
-type KustomizationFile struct {
-	APIVersion string `yaml:"apiVersion"`
-	Kind       string `yaml:"kind"`
-	Metadata   struct {
-		Name      string `yaml:"name"`
-		Namespace string `yaml:"namespace,omitempty"`
-	} `yaml:"metadata"`
-	Resources []string `yaml:"resources"`
-}
-
 type Synthesizer interface {
 	Synthesize(directory string, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger, ctx context.Context) (parsedManifests []*unstructured.Unstructured, err error)
 }
 
 // Implementer implements the Synthesizer method.
-type Implementer struct{}
+type Implementer struct {
+	// Context is handed to the app JSON encoded in the CDK8S_CONTEXT_JSON environment variable.
+	Context map[string]any
+
+	// Env holds additional environment variables of the synth run.
+	Env map[string]string
+
+	// Limits bound the resources of the synth steps.
+	Limits Limits
 
+	// Registries are the private package registries of the synth run.
+	Registries []Registry
+
+	// Cache is the dependency cache shared by the synth runs, nil if dependencies are not cached.
+	Cache *Cache
+
+	// Offline denies the synth steps network access. Dependencies must be vendored in the app or
+	// held by the Cache.
+	Offline bool
+
+	// OfflineEnvOnly lets offline steps run if network namespaces are not available, kept offline by
+	// their environment only. Without it, such steps fail.
+	OfflineEnvOnly bool
+}
+
+// Synthesize renders the app of the Cdk8sAppProxy in directory with its renderer. The kustomize
+// overlay of the Cdk8sAppProxy is applied by the caller with ApplyOverlay, once for all its sources.
 func (i *Implementer) Synthesize(directory string, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logger logr.Logger, ctx context.Context) (parsedManifests []*unstructured.Unstructured, err error) {
-	apiPath := filepath.Join(directory, cdk8sAppProxy.Spec.GitRepository.Path)
+	rendererName := cdk8sAppProxy.Spec.Renderer
+	if rendererName == "" && cdk8sAppProxy.Spec.OCIRepository != nil {
+		// OCI artifacts hold pre-synthesized manifests.
+		rendererName = addonsv1alpha1.RendererYAML
+	}
+	renderer, err := lookupRenderer(rendererName)
+	if err != nil {
+		logger.Error(err, "Failed to find renderer")
 
-	kind := cdk8sType(directory, logger)
+		return parsedManifests, err
+	}
 
-	if kind == string(cdk8sTypescript) {
-		npmInstall := exec.CommandContext(ctx, "npm", "install")
-		npmInstall.Dir = apiPath
-		output, err := npmInstall.CombinedOutput()
-		if err != nil {
-			logger.Error(err, "npm installation failed", "msg:", string(output))
-		}
+	// The app only reads and writes the partition of the dependency cache of its namespace.
+	scoped := *i
+	scoped.Cache = i.Cache.forNamespace(cdk8sAppProxy.Namespace)
+	i = &scoped
+
+	sandbox, err := newSandbox()
+	if err != nil {
+		logger.Error(err, "Failed to create the synth sandbox")
+
+		return parsedManifests, err
 	}
+	defer sandbox.remove()
 
-	synth := exec.CommandContext(ctx, "cdk8s", "synth")
-	synth.Dir = apiPath
-	var stdout, stderr bytes.Buffer
-	synth.Stdout = &stdout
-	synth.Stderr = &stderr
-	if err := synth.Run(); err != nil {
-		logger.Error(err, "Failed to synth cdk8s application", "stdout", stdout.String(), "stderr", stderr.String())
+	done := i.Cache.use(logger)
+	defer done()
+
+	// The registry credentials are only handed to the install steps, not to the code of the app.
+	registryEnv, registryFiles, err := writeRegistryConfig(i.Registries, sandbox)
+	if err != nil {
+		logger.Error(err, "Failed to write the registry configuration")
+
+		return parsedManifests, err
+	}
+	environ, err := i.environ(sandbox, nil)
+	if err != nil {
+		logger.Error(err, "Failed to encode the synth context")
+
+		return parsedManifests, err
+	}
+	installEnviron, err := i.environ(sandbox, registryEnv)
+	if err != nil {
+		logger.Error(err, "Failed to encode the synth context")
+
+		return parsedManifests, err
+	}
+
+	app := &App{
+		Root:           directory,
+		Path:           filepath.Join(directory, sourcePath(cdk8sAppProxy)),
+		TempDir:        sandbox.tmp(),
+		Cdk8sAppProxy:  cdk8sAppProxy,
+		Context:        i.Context,
+		Environ:        environ,
+		installEnviron: installEnviron,
+		registryFiles:  registryFiles,
+		implementer:    i,
+	}
+	parsedManifests, err = renderer.Render(ctx, app, logger)
+	if err != nil {
+		logger.Error(err, "Failed to render app", "renderer", rendererName)
+
+		return nil, err
+	}
+
+	return parsedManifests, err
+}
+
+// sourcePath returns the path of the app within its Git repository or OCI artifact.
+func sourcePath(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy) string {
+	if cdk8sAppProxy.Spec.OCIRepository != nil {
+		return cdk8sAppProxy.Spec.OCIRepository.Path
+	}
+
+	return cdk8sAppProxy.Spec.GitRepository.Path
+}
+
+// cdk8sRenderer synthesizes a cdk8s app and reads the manifests it writes to dist.
+type cdk8sRenderer struct{}
+
+func (cdk8sRenderer) Render(ctx context.Context, app *App, logger logr.Logger) (parsedManifests []*unstructured.Unstructured, err error) {
+	apiPath := app.Path
+
+	config, err := readCdk8sConfig(apiPath)
+	if err != nil {
+		logger.Error(err, "Failed to read cdk8s.yaml")
+
+		return parsedManifests, err
+	}
+
+	synthSpec := addonsv1alpha1.SynthSpec{}
+	if app.Cdk8sAppProxy.Spec.Synth != nil {
+		synthSpec = *app.Cdk8sAppProxy.Spec.Synth
+	}
+
+	kind := string(synthSpec.Language)
+	if kind == "" {
+		kind = config.Language
+	}
+	if kind == "" {
+		kind = cdk8sType(apiPath, logger)
+	}
+
+	toolEnv, err := app.implementer.installDependencies(ctx, apiPath, kind, config, synthSpec.Toolchain, app.installEnviron, logger)
+	if err != nil {
+		logger.Error(err, "Failed to install dependencies", "language", kind)
+
+		return parsedManifests, err
+	}
+	if err = app.removeRegistryConfig(); err != nil {
+		logger.Error(err, "Failed to remove the registry configuration")
+
+		return parsedManifests, err
+	}
+
+	name, args := synthCommand(synthSpec.Toolchain)
+	if err = app.implementer.runOutputStep(ctx, apiPath, withEnv(app.Environ, toolEnv), filepath.Join(apiPath, "dist"), logger, name, args...); err != nil {
+		logger.Error(err, "Failed to synth cdk8s application")
+
+		return parsedManifests, err
+	}
+
+	if err = app.implementer.Limits.checkOutputSize(apiPath); err != nil {
+		logger.Error(err, "Synthesized manifests are too large")
 
 		return parsedManifests, err
 	}
@@ -74,30 +194,27 @@ func (i *Implementer) Synthesize(directory string, cdk8sAppProxy *addonsv1alpha1
 	}
 
 	if len(foundManifests) > 0 && isKustomization(filepath.Base(foundManifests[0])) {
-		var allManifests []string
-
-		for _, kustomizationFile := range foundManifests {
-			manifestPaths, err := parseKustomization(kustomizationFile, logger)
-
+		for _, root := range kustomizeRoots(foundManifests) {
+			built, err := kustomizeBuild(app.Root, root, logger)
 			if err != nil {
-				logger.Error(err, "Failed to parse kustomization file")
+				logger.Error(err, "Failed to build kustomization", "directory", root)
 
-				return parsedManifests, err
+				return nil, err
 			}
-			allManifests = append(allManifests, manifestPaths...)
+			chart, err := filepath.Rel(filepath.Join(apiPath, "dist"), root)
+			if err != nil {
+				return nil, err
+			}
+			annotateChart(app, filepath.ToSlash(chart), built)
+			parsedManifests = append(parsedManifests, built...)
 		}
 
-		parsedManifests, err = parseManifests(allManifests, logger)
-		if err != nil {
-			logger.Error(err, "Failed to parse kustomization manifests")
+		return parsedManifests, nil
+	}
 
-			return parsedManifests, err
-		}
-	} else {
-		parsedManifests, err = parseManifests(foundManifests, logger)
-		if err != nil {
-			logger.Error(err, "Failed to parse manifests")
-		}
+	parsedManifests, err = parseCharts(app, filepath.Join(apiPath, "dist"), foundManifests, logger)
+	if err != nil {
+		logger.Error(err, "Failed to parse manifests")
 	}
 
 	return parsedManifests, err
@@ -153,63 +270,88 @@ func parseManifests(manifests []string, logger logr.Logger) (parsedResources []*
 			return parsedResources, err
 		}
 
-		decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifestContent), 1024)
+		resources, err := decodeManifests(manifestContent, logger)
+		if err != nil {
+			return parsedResources, err
+		}
+		parsedResources = append(parsedResources, resources...)
+	}
 
-		for {
-			var rawObj runtime.RawExtension
-			if err = decoder.Decode(&rawObj); err != nil {
-				if err.Error() == "EOF" {
-					break
-				}
-				logger.Error(err, "Failed to decode YAML from manifest file")
+	return parsedResources, err
+}
 
-				return parsedResources, err
-			}
+// parseCharts parses the manifests like parseManifests. For spec.chartTargets, resources without a
+// ChartAnnotation are annotated with the path of their manifest relative to dir.
+func parseCharts(app *App, dir string, manifests []string, logger logr.Logger) (parsedResources []*unstructured.Unstructured, err error) {
+	if len(app.Cdk8sAppProxy.Spec.ChartTargets) == 0 {
+		return parseManifests(manifests, logger)
+	}
 
-			if rawObj.Raw == nil {
-				continue
-			}
+	for _, manifest := range manifests {
+		resources, err := parseManifests([]string{manifest}, logger)
+		if err != nil {
+			return parsedResources, err
+		}
+		chart, err := filepath.Rel(dir, manifest)
+		if err != nil {
+			return parsedResources, err
+		}
+		annotateChart(app, filepath.ToSlash(chart), resources)
+		parsedResources = append(parsedResources, resources...)
+	}
 
-			u := &unstructured.Unstructured{}
-			if _, _, err := unstructured.UnstructuredJSONScheme.Decode(rawObj.Raw, nil, u); err != nil {
-				logger.Error(err, "Failed to decode RawExtension to Unstructured")
+	return parsedResources, nil
+}
 
-				return parsedResources, err
-			}
+// annotateChart sets the ChartAnnotation of the resources without one to chart if
+// spec.chartTargets is given.
+func annotateChart(app *App, chart string, resources []*unstructured.Unstructured) {
+	if len(app.Cdk8sAppProxy.Spec.ChartTargets) == 0 {
+		return
+	}
 
-			parsedResources = append(parsedResources, u)
+	for _, resource := range resources {
+		annotations := resource.GetAnnotations()
+		if _, ok := annotations[addonsv1alpha1.ChartAnnotation]; !ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[addonsv1alpha1.ChartAnnotation] = chart
+			resource.SetAnnotations(annotations)
 		}
 	}
-
-	return parsedResources, err
 }
 
-// parseKustomization reads a kustomization file and returns the referenced manifest files.
-func parseKustomization(kustomizationPath string, logger logr.Logger) (manifestPaths []string, err error) {
-	content, err := os.ReadFile(kustomizationPath)
-	if err != nil {
-		logger.Error(err, "Failed to read kustomization file", "path", kustomizationPath)
+// decodeManifests decodes the YAML or JSON documents of content.
+func decodeManifests(content []byte, logger logr.Logger) (parsedResources []*unstructured.Unstructured, err error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 1024)
 
-		return manifestPaths, err
-	}
+	for {
+		var rawObj runtime.RawExtension
+		if err = decoder.Decode(&rawObj); err != nil {
+			if err.Error() == "EOF" {
+				break
+			}
+			logger.Error(err, "Failed to decode YAML from manifest file")
 
-	var kustomization KustomizationFile
-	if err := yaml.Unmarshal(content, &kustomization); err != nil {
-		logger.Error(err, "Failed to parse kustomization file", "path", kustomizationPath)
+			return parsedResources, err
+		}
 
-		return manifestPaths, err
-	}
+		if rawObj.Raw == nil {
+			continue
+		}
 
-	// Get the directory containing the kustomization file
-	kustomizeDir := filepath.Dir(kustomizationPath)
+		u := &unstructured.Unstructured{}
+		if _, _, err := unstructured.UnstructuredJSONScheme.Decode(rawObj.Raw, nil, u); err != nil {
+			logger.Error(err, "Failed to decode RawExtension to Unstructured")
 
-	// Resolve resource paths relative to the kustomization file directory
-	for _, resource := range kustomization.Resources {
-		resourcePath := filepath.Join(kustomizeDir, resource)
-		manifestPaths = append(manifestPaths, resourcePath)
+			return parsedResources, err
+		}
+
+		parsedResources = append(parsedResources, u)
 	}
 
-	return manifestPaths, nil
+	return parsedResources, nil
 }
 
 func cdk8sType(directory string, logger logr.Logger) (kind string) {
@@ -238,6 +380,10 @@ func cdk8sType(directory string, logger logr.Logger) (kind string) {
 		case strings.HasSuffix(fileName, ".py"):
 			kind = string(cdk8sPython)
 
+			return kind
+		case strings.HasSuffix(fileName, ".java"), fileName == "pom.xml", strings.HasPrefix(fileName, "build.gradle"):
+			kind = string(cdk8sJava)
+
 			return kind
 		}
 	}
@@ -155,6 +155,15 @@ func TestCdk8sType(t *testing.T) {
 		assert.Equal(t, "python", kind)
 	})
 
+	t.Run("should detect Java application", func(t *testing.T) {
+		tempDir := t.TempDir()
+		_, err := os.Create(filepath.Join(tempDir, "pom.xml"))
+		assert.NoError(t, err)
+
+		kind := cdk8sType(tempDir, logger)
+		assert.Equal(t, "java", kind)
+	})
+
 	t.Run("should return empty string for unknown type", func(t *testing.T) {
 		tempDir := t.TempDir()
 		_, err := os.Create(filepath.Join(tempDir, "readme.txt"))
@@ -188,74 +197,6 @@ func TestCdk8sType(t *testing.T) {
 	})
 }
 
-func TestParseKustomization(t *testing.T) {
-	logger := logr.Discard()
-
-	t.Run("should parse kustomization file and return resource paths", func(t *testing.T) {
-		content := `apiVersion: kustomize.config.k8s.io/v1beta1
-kind: Kustomization
-metadata:
-  name: kustomization
-  namespace: default
-resources:
-  - headlamp-deployment.k8s.yaml
-  - nginx-deployment.k8s.yaml`
-
-		tempFile, err := os.CreateTemp("", "kustomization.yaml")
-		assert.NoError(t, err)
-		defer os.Remove(tempFile.Name())
-		_, err = tempFile.WriteString(content)
-		assert.NoError(t, err)
-		tempFile.Close()
-
-		manifestPaths, err := parseKustomization(tempFile.Name(), logger)
-		assert.NoError(t, err)
-		assert.Len(t, manifestPaths, 2)
-
-		expectedDir := filepath.Dir(tempFile.Name())
-		assert.Equal(t, filepath.Join(expectedDir, "headlamp-deployment.k8s.yaml"), manifestPaths[0])
-		assert.Equal(t, filepath.Join(expectedDir, "nginx-deployment.k8s.yaml"), manifestPaths[1])
-	})
-
-	t.Run("should handle empty resources list", func(t *testing.T) {
-		content := `apiVersion: kustomize.config.k8s.io/v1beta1
-kind: Kustomization
-metadata:
-  name: kustomization
-resources: []`
-
-		tempFile, err := os.CreateTemp("", "kustomization.yaml")
-		assert.NoError(t, err)
-		defer os.Remove(tempFile.Name())
-		_, err = tempFile.WriteString(content)
-		assert.NoError(t, err)
-		tempFile.Close()
-
-		manifestPaths, err := parseKustomization(tempFile.Name(), logger)
-		assert.NoError(t, err)
-		assert.Len(t, manifestPaths, 0)
-	})
-
-	t.Run("should return error for non-existent file", func(t *testing.T) {
-		_, err := parseKustomization("/non/existent/kustomization.yaml", logger)
-		assert.Error(t, err)
-	})
-
-	t.Run("should return error for invalid YAML", func(t *testing.T) {
-		content := `invalid yaml content: [}`
-
-		tempFile, err := os.CreateTemp("", "kustomization.yaml")
-		assert.NoError(t, err)
-		defer os.Remove(tempFile.Name())
-		_, err = tempFile.WriteString(content)
-		assert.NoError(t, err)
-		tempFile.Close()
-
-		_, err = parseKustomization(tempFile.Name(), logger)
-		assert.Error(t, err)
-	})
-}
-
 func TestImplementer_Synthesize(t *testing.T) {
 	logger := logr.Discard()
 	impl := &Implementer{}
@@ -317,7 +258,7 @@ metadata:
 		assert.NoError(t, os.WriteFile(manifestPath, []byte(manifestContent), 0644))
 
 		// Create a Go file so cdk8sType returns "go"
-		_, err = os.Create(filepath.Join(tempDir, "main.go"))
+		_, err = os.Create(filepath.Join(deploymentsDir, "main.go"))
 		assert.NoError(t, err)
 
 		// Create a fake cdk8s binary in PATH that just exits 0
@@ -378,7 +319,7 @@ metadata:
 		assert.NoError(t, os.WriteFile(cmPath, []byte(cmContent), 0644))
 
 		// Create a Go file so cdk8sType returns "go"
-		_, err = os.Create(filepath.Join(tempDir, "main.go"))
+		_, err = os.Create(filepath.Join(deploymentsDir, "main.go"))
 		assert.NoError(t, err)
 
 		// Fake cdk8s binary
@@ -414,7 +355,7 @@ metadata:
 		err := os.MkdirAll(deploymentsDir, 0755)
 		assert.NoError(t, err)
 
-		_, err = os.Create(filepath.Join(tempDir, "main.ts"))
+		_, err = os.Create(filepath.Join(deploymentsDir, "main.ts"))
 		assert.NoError(t, err)
 
 		// Fake npm and cdk8s binaries
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/oci"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FetchOCIPuller returns the puller of the OCI artifact of spec with the registry credentials read
+// from its Secret in namespace, a kubernetes.io/dockerconfigjson Secret or one holding username
+// and password keys.
+func FetchOCIPuller(ctx context.Context, c client.Client, namespace string, spec *addonsv1alpha1.OCIRepositorySpec, logs logr.Logger) (puller *oci.Implementer, err error) {
+	puller = &oci.Implementer{Insecure: spec.Insecure}
+	if spec.SecretRef == "" {
+		return puller, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: spec.SecretRef}, secret); err != nil {
+		logs.Error(err, "failed to read OCI registry credentials", "secret", spec.SecretRef)
+
+		return nil, err
+	}
+
+	if config, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+		puller.Username, puller.Password, err = oci.DockerConfigCredentials(config, oci.Registry(spec.URL))
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", spec.SecretRef, err)
+		}
+
+		return puller, nil
+	}
+
+	puller.Username = string(secret.Data[RegistryUsernameKey])
+	puller.Password = string(secret.Data[RegistryPasswordKey])
+	if puller.Username == "" && puller.Password == "" {
+		return nil, fmt.Errorf("secret %q of the OCI repository %s holds neither %s nor %s", spec.SecretRef, spec.URL, corev1.DockerConfigJsonKey, RegistryUsernameKey)
+	}
+
+	return puller, nil
+}
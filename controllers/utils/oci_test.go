@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFetchOCIPuller(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths": {"ghcr.io": {"username": "ci", "password": "secret"}}}`)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "basic", Namespace: "default"},
+			Data:       map[string][]byte{"username": []byte("robot"), "password": []byte("s3cr3t")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"},
+		},
+	).Build()
+
+	tests := []struct {
+		name         string
+		secretRef    string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{name: "anonymous"},
+		{name: "docker config", secretRef: "pull", wantUsername: "ci", wantPassword: "secret"},
+		{name: "username and password", secretRef: "basic", wantUsername: "robot", wantPassword: "s3cr3t"},
+		{name: "no credentials", secretRef: "empty", wantErr: true},
+		{name: "missing secret", secretRef: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &addonsv1alpha1.Cdk8sAppProxy{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: addonsv1alpha1.Cdk8sAppProxySpec{OCIRepository: &addonsv1alpha1.OCIRepositorySpec{
+					URL: "oci://ghcr.io/example/app-manifests", SecretRef: tt.secretRef, Insecure: true,
+				}},
+			}
+
+			puller, err := FetchOCIPuller(context.Background(), c, proxy.Namespace, proxy.Spec.OCIRepository, logr.Discard())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchOCIPuller returned error: %v", err)
+			}
+			if puller.Username != tt.wantUsername || puller.Password != tt.wantPassword || !puller.Insecure {
+				t.Errorf("unexpected puller %+v", puller)
+			}
+			if tt.secretRef != "" && !References(proxy, addonsv1alpha1.ValuesKindSecret, tt.secretRef) {
+				t.Error("expected the pull Secret to be referenced")
+			}
+		})
+	}
+}
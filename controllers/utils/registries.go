@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/synthesizer"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keys of the credentials in the Secret of a package registry.
+const (
+	RegistryTokenKey    = "token"
+	RegistryUsernameKey = "username"
+	RegistryPasswordKey = "password"
+)
+
+// FetchRegistries returns the package registries of spec.synth.registries with the credentials
+// read from their Secrets.
+func FetchRegistries(ctx context.Context, c client.Client, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logs logr.Logger) (registries []synthesizer.Registry, err error) {
+	if cdk8sAppProxy.Spec.Synth == nil {
+		return nil, nil
+	}
+
+	for _, spec := range cdk8sAppProxy.Spec.Synth.Registries {
+		registry := synthesizer.Registry{RegistrySpec: spec}
+
+		if spec.SecretRef != "" {
+			secret := &corev1.Secret{}
+			if err = c.Get(ctx, types.NamespacedName{Namespace: cdk8sAppProxy.Namespace, Name: spec.SecretRef}, secret); err != nil {
+				logs.Error(err, "failed to read registry credentials", "secret", spec.SecretRef)
+
+				return nil, err
+			}
+
+			registry.Token = string(secret.Data[RegistryTokenKey])
+			registry.Username = string(secret.Data[RegistryUsernameKey])
+			registry.Password = string(secret.Data[RegistryPasswordKey])
+			if registry.Token == "" && registry.Username == "" {
+				return nil, fmt.Errorf("secret %q of the %s registry %s holds neither %s nor %s", spec.SecretRef, spec.Kind, spec.URL, RegistryTokenKey, RegistryUsernameKey)
+			}
+		}
+
+		registries = append(registries, registry)
+	}
+
+	return registries, nil
+}
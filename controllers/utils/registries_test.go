@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFetchRegistries(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "npm", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("npm-token")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		},
+	).Build()
+
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{Synth: &addonsv1alpha1.SynthSpec{Registries: []addonsv1alpha1.RegistrySpec{
+			{Kind: addonsv1alpha1.RegistryKindNpm, URL: "https://npm.example.com/", Scope: "@example", SecretRef: "npm"},
+			{Kind: addonsv1alpha1.RegistryKindGo, Modules: []string{"github.com/example/*"}},
+		}}},
+	}
+
+	registries, err := FetchRegistries(context.Background(), c, proxy, logr.Discard())
+	if err != nil {
+		t.Fatalf("FetchRegistries returned error: %v", err)
+	}
+	if len(registries) != 2 || registries[0].Token != "npm-token" || registries[0].Scope != "@example" || registries[1].Token != "" {
+		t.Errorf("unexpected registries %+v", registries)
+	}
+
+	if !References(proxy, addonsv1alpha1.ValuesKindSecret, "npm") || References(proxy, addonsv1alpha1.ValuesKindConfigMap, "npm") {
+		t.Error("expected the registry Secret to be referenced")
+	}
+
+	proxy.Spec.Synth.Registries[1].SecretRef = "empty"
+	if _, err = FetchRegistries(context.Background(), c, proxy, logr.Discard()); err == nil || !strings.Contains(err.Error(), "holds neither token nor username") {
+		t.Errorf("expected an error for a Secret without credentials, got %v", err)
+	}
+
+	proxy.Spec.Synth.Registries[1].SecretRef = "missing"
+	if _, err = FetchRegistries(context.Background(), c, proxy, logr.Discard()); err == nil {
+		t.Error("expected an error for a missing Secret")
+	}
+}
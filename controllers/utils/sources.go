@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+)
+
+// SourceApp is an app of a Cdk8sAppProxy.
+type SourceApp struct {
+	// Name of the source in spec.sources, empty for the app of spec.gitRepository or spec.ociRepository.
+	Name string
+
+	// Cdk8sAppProxy is the Cdk8sAppProxy the app is synthesized as. For spec.sources, it is a copy
+	// with the repository, renderer and synth settings of the source and without the kustomize
+	// overlay, which applies to the combined resources of all sources.
+	Cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy
+}
+
+// SourceApps returns the apps of the Cdk8sAppProxy in the order they are applied: the app of
+// spec.gitRepository or spec.ociRepository, followed by the apps of spec.sources.
+func SourceApps(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy) (apps []SourceApp) {
+	if cdk8sAppProxy.Spec.GitRepository != nil || cdk8sAppProxy.Spec.OCIRepository != nil {
+		apps = append(apps, SourceApp{Cdk8sAppProxy: cdk8sAppProxy})
+	}
+
+	for _, source := range cdk8sAppProxy.Spec.Sources {
+		app := cdk8sAppProxy.DeepCopy()
+		app.Spec.GitRepository = source.GitRepository
+		app.Spec.OCIRepository = source.OCIRepository
+		app.Spec.Renderer = source.Renderer
+		app.Spec.Synth = source.Synth
+		app.Spec.Kustomize = nil
+		app.Spec.Sources = nil
+		apps = append(apps, SourceApp{Name: source.Name, Cdk8sAppProxy: app})
+	}
+
+	return apps
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSourceApps(t *testing.T) {
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform", Namespace: "default"},
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			GitRepository: &addonsv1alpha1.GitRepositorySpec{URL: "https://github.com/example/platform", Path: "apps/ingress"},
+			Synth:         &addonsv1alpha1.SynthSpec{Language: addonsv1alpha1.LanguageTypeScript},
+			Kustomize:     &addonsv1alpha1.KustomizeSpec{Namespace: "platform"},
+			Sources: []addonsv1alpha1.SourceSpec{
+				{
+					Name:          "shared",
+					GitRepository: &addonsv1alpha1.GitRepositorySpec{URL: "https://github.com/example/shared"},
+					Synth:         &addonsv1alpha1.SynthSpec{Registries: []addonsv1alpha1.RegistrySpec{{Kind: addonsv1alpha1.RegistryKindPyPI, SecretRef: "pypi"}}},
+				},
+				{
+					Name:          "crds",
+					OCIRepository: &addonsv1alpha1.OCIRepositorySpec{URL: "oci://ghcr.io/example/crds", SecretRef: "ghcr"},
+				},
+			},
+		},
+	}
+
+	apps := SourceApps(proxy)
+	if len(apps) != 3 {
+		t.Fatalf("expected 3 apps, got %d", len(apps))
+	}
+	if apps[0].Name != "" || apps[0].Cdk8sAppProxy != proxy {
+		t.Errorf("expected the app of spec.gitRepository first, got %q", apps[0].Name)
+	}
+
+	shared := apps[1].Cdk8sAppProxy
+	if apps[1].Name != "shared" || shared.Spec.GitRepository.URL != "https://github.com/example/shared" || shared.Spec.OCIRepository != nil {
+		t.Errorf("unexpected app %q of %+v", apps[1].Name, shared.Spec.GitRepository)
+	}
+	if shared.Spec.Synth.Language != "" || len(shared.Spec.Sources) != 0 || shared.Namespace != "default" {
+		t.Errorf("expected the synth settings of the source, got %+v", shared.Spec)
+	}
+	if shared.Spec.Kustomize != nil {
+		t.Error("expected the kustomize overlay to be applied to the combined resources only")
+	}
+
+	crds := apps[2].Cdk8sAppProxy
+	if apps[2].Name != "crds" || crds.Spec.GitRepository != nil || crds.Spec.Synth != nil {
+		t.Errorf("unexpected app %q of %+v", apps[2].Name, crds.Spec)
+	}
+	if proxy.Spec.GitRepository.Path != "apps/ingress" || len(proxy.Spec.Sources) != 2 {
+		t.Error("expected the Cdk8sAppProxy to stay unchanged")
+	}
+
+	for _, name := range []string{"pypi", "ghcr"} {
+		if !References(proxy, addonsv1alpha1.ValuesKindSecret, name) {
+			t.Errorf("expected Secret %s of a source to be referenced", name)
+		}
+	}
+	if len(SourceApps(&addonsv1alpha1.Cdk8sAppProxy{})) != 0 {
+		t.Error("expected no apps without sources")
+	}
+}
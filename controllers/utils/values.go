@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// FetchValues merges the values read from spec.valuesFrom in order and spec.values on top of them.
+// Nested objects are merged, all other values are replaced. It returns nil if no values are configured.
+func FetchValues(ctx context.Context, c client.Client, cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, logs logr.Logger) (values map[string]any, err error) {
+	for _, ref := range cdk8sAppProxy.Spec.ValuesFrom {
+		data, err := fetchValuesData(ctx, c, cdk8sAppProxy.Namespace, ref)
+		if err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				logs.Info("skipping optional values reference", "kind", ref.Kind, "name", ref.Name)
+
+				continue
+			}
+			logs.Error(err, "failed to read values", "kind", ref.Kind, "name", ref.Name)
+
+			return nil, err
+		}
+
+		refValues := make(map[string]any, len(data))
+		if ref.Key == "" {
+			for key, value := range data {
+				refValues[key] = value
+			}
+		} else {
+			value, ok := data[ref.Key]
+			if !ok {
+				if ref.Optional {
+					continue
+				}
+				err = fmt.Errorf("%s %q does not contain key %q", ref.Kind, ref.Name, ref.Key)
+				logs.Error(err, "values key not found", "kind", ref.Kind, "name", ref.Name, "key", ref.Key)
+
+				return nil, err
+			}
+			if err = yaml.Unmarshal([]byte(value), &refValues); err != nil {
+				return nil, fmt.Errorf("failed to parse key %q of %s %q: %w", ref.Key, ref.Kind, ref.Name, err)
+			}
+		}
+
+		values = mergeValues(values, refValues)
+	}
+
+	if cdk8sAppProxy.Spec.Values != nil && len(cdk8sAppProxy.Spec.Values.Raw) > 0 {
+		specValues := map[string]any{}
+		if err = json.Unmarshal(cdk8sAppProxy.Spec.Values.Raw, &specValues); err != nil {
+			return nil, fmt.Errorf("spec.values must be a JSON object: %w", err)
+		}
+		values = mergeValues(values, specValues)
+	}
+
+	return values, nil
+}
+
+// ValuesHash returns the hex encoded SHA-256 hash of the JSON encoding of the values,
+// or an empty string if there are no values.
+func ValuesHash(values map[string]any) (hash string, err error) {
+	if values == nil {
+		return "", nil
+	}
+
+	// Maps are encoded with sorted keys, so equal values give equal hashes.
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// References reports whether the Cdk8sAppProxy reads values or registry credentials from the object
+// of the given kind and name.
+func References(cdk8sAppProxy *addonsv1alpha1.Cdk8sAppProxy, kind addonsv1alpha1.ValuesKind, name string) bool {
+	for _, ref := range cdk8sAppProxy.Spec.ValuesFrom {
+		if ref.Kind == kind && ref.Name == name {
+			return true
+		}
+	}
+	if kind != addonsv1alpha1.ValuesKindSecret {
+		return false
+	}
+
+	if referencesSecret(cdk8sAppProxy.Spec.Synth, cdk8sAppProxy.Spec.OCIRepository, name) {
+		return true
+	}
+	for _, source := range cdk8sAppProxy.Spec.Sources {
+		if referencesSecret(source.Synth, source.OCIRepository, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// referencesSecret reports whether the registries of synth or the OCI repository read credentials from the Secret.
+func referencesSecret(synth *addonsv1alpha1.SynthSpec, ociRepository *addonsv1alpha1.OCIRepositorySpec, name string) bool {
+	if synth != nil {
+		for _, registry := range synth.Registries {
+			if registry.SecretRef == name {
+				return true
+			}
+		}
+	}
+
+	return ociRepository != nil && ociRepository.SecretRef == name
+}
+
+// fetchValuesData returns the data of the referenced ConfigMap or Secret.
+func fetchValuesData(ctx context.Context, c client.Client, namespace string, ref addonsv1alpha1.ValuesReference) (data map[string]string, err error) {
+	key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	switch ref.Kind {
+	case addonsv1alpha1.ValuesKindConfigMap:
+		configMap := &corev1.ConfigMap{}
+		if err = c.Get(ctx, key, configMap); err != nil {
+			return nil, err
+		}
+
+		return configMap.Data, nil
+	case addonsv1alpha1.ValuesKindSecret:
+		secret := &corev1.Secret{}
+		if err = c.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		data = make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported values kind %q", ref.Kind)
+	}
+}
+
+// mergeValues merges src into dst, recursing into objects present in both.
+func mergeValues(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = make(map[string]any, len(src))
+	}
+
+	for key, value := range src {
+		srcObject, srcIsObject := value.(map[string]any)
+		dstObject, dstIsObject := dst[key].(map[string]any)
+		if srcIsObject && dstIsObject {
+			dst[key] = mergeValues(dstObject, srcObject)
+
+			continue
+		}
+		dst[key] = value
+	}
+
+	return dst
+}
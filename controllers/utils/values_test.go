@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFetchValues(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "default"},
+			Data:       map[string]string{"values.yaml": "image:\n  repository: nginx\n  tag: \"1.27\"\nreplicas: 1\n"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		},
+	).Build()
+
+	proxy := &addonsv1alpha1.Cdk8sAppProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: addonsv1alpha1.Cdk8sAppProxySpec{
+			Values: &apiextensionsv1.JSON{Raw: []byte(`{"image":{"tag":"1.28"},"replicas":3}`)},
+			ValuesFrom: []addonsv1alpha1.ValuesReference{
+				{Kind: addonsv1alpha1.ValuesKindConfigMap, Name: "defaults", Key: "values.yaml"},
+				{Kind: addonsv1alpha1.ValuesKindSecret, Name: "credentials"},
+				{Kind: addonsv1alpha1.ValuesKindConfigMap, Name: "missing", Optional: true},
+			},
+		},
+	}
+
+	values, err := FetchValues(context.Background(), c, proxy, logr.Discard())
+	if err != nil {
+		t.Fatalf("FetchValues returned error: %v", err)
+	}
+
+	want := map[string]any{
+		"image":    map[string]any{"repository": "nginx", "tag": "1.28"},
+		"replicas": float64(3),
+		"password": "s3cr3t",
+	}
+	if !equality.Semantic.DeepEqual(values, want) {
+		t.Errorf("expected values %v, got %v", want, values)
+	}
+
+	hash, err := ValuesHash(values)
+	if err != nil || len(hash) != 64 {
+		t.Errorf("expected a SHA-256 hash, got %q (%v)", hash, err)
+	}
+
+	proxy.Spec.ValuesFrom = append(proxy.Spec.ValuesFrom, addonsv1alpha1.ValuesReference{Kind: addonsv1alpha1.ValuesKindSecret, Name: "credentials", Key: "token"})
+	if _, err = FetchValues(context.Background(), c, proxy, logr.Discard()); err == nil || !strings.Contains(err.Error(), `key "token"`) {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+}
+
+func TestFetchValuesNone(t *testing.T) {
+	values, err := FetchValues(context.Background(), fake.NewClientBuilder().Build(), &addonsv1alpha1.Cdk8sAppProxy{}, logr.Discard())
+	if err != nil || values != nil {
+		t.Fatalf("expected no values, got %v (%v)", values, err)
+	}
+
+	hash, err := ValuesHash(values)
+	if err != nil || hash != "" {
+		t.Errorf("expected empty hash, got %q (%v)", hash, err)
+	}
+}
@@ -19,17 +19,23 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"time"
 
 	addonsv1alpha1 "github.com/eitco/cluster-api-addon-provider-cdk8s/api/v1alpha1"
 	caapccontroller "github.com/eitco/cluster-api-addon-provider-cdk8s/controllers"
+	"github.com/eitco/cluster-api-addon-provider-cdk8s/controllers/synthesizer"
 	"github.com/eitco/cluster-api-addon-provider-cdk8s/version"
 	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
 	"k8s.io/component-base/logs"
 	logsv1 "k8s.io/component-base/logs/api/v1"
 	_ "k8s.io/component-base/logs/json/register"
@@ -66,6 +72,22 @@ var (
 	healthAddr                  string
 	webhookPort                 int
 	webhookCertDir              string
+	synthBackend                string
+	synthJobImage               string
+	synthJobCPU                 string
+	synthJobMemory              string
+	synthJobTimeout             time.Duration
+	synthJobExcludedCIDRs       []string
+	synthStepTimeout            time.Duration
+	synthMaxOutputBytes         int64
+	synthCPUTime                time.Duration
+	synthCgroupParent           string
+	synthCPU                    string
+	synthMemory                 string
+	synthCacheDir               string
+	synthCacheMaxSize           string
+	synthOffline                bool
+	synthOfflineEnvOnly         bool
 	managerOptions              = flags.ManagerOptions{}
 	logOptions                  = logs.NewOptions()
 )
@@ -123,6 +145,54 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&healthAddr, "health-addr", ":9440",
 		"Address the health endpoint binds to.")
 
+	fs.StringVar(&synthBackend, "synth-backend", synthBackendInProcess,
+		fmt.Sprintf("Backend synthesizing cdk8s apps: %q runs the synthesis in the controller process, %q in a Kubernetes Job per synthesis.", synthBackendInProcess, synthBackendJob))
+
+	fs.StringVar(&synthJobImage, "synth-job-image", "",
+		"Image of the synth Jobs, usually the image of the controller. Required for the job synth backend.")
+
+	fs.StringVar(&synthJobCPU, "synth-job-cpu", "1",
+		"CPU request and limit of the synth Jobs.")
+
+	fs.StringVar(&synthJobMemory, "synth-job-memory", "2Gi",
+		"Memory request and limit of the synth Jobs.")
+
+	fs.DurationVar(&synthJobTimeout, "synth-job-timeout", 10*time.Minute,
+		"Active deadline of the synth Jobs.")
+
+	fs.StringSliceVar(&synthJobExcludedCIDRs, "synth-job-excluded-cidrs", nil,
+		"Address ranges the synth Jobs can not reach besides DNS, e.g. the pod and service CIDRs of the cluster. Link-local addresses are always excluded.")
+
+	fs.DurationVar(&synthStepTimeout, "synth-step-timeout", 10*time.Minute,
+		"Timeout of each step of an in-process synthesis, e.g. the dependency installation and cdk8s synth. 0 disables the timeout.")
+
+	fs.Int64Var(&synthMaxOutputBytes, "synth-max-output-bytes", 50<<20,
+		"Maximum size of the manifests written by an in-process synthesis, measured while cdk8s synth runs, which is killed once it is exceeded. 0 disables the limit.")
+
+	fs.DurationVar(&synthCPUTime, "synth-cpu-time", 0,
+		"CPU time limit of each process of an in-process synthesis. 0 disables the limit.")
+
+	fs.StringVar(&synthCgroupParent, "synth-cgroup-parent", "",
+		"Delegated cgroup v2 directory in which each in-process synth step runs in a child cgroup limited by --synth-cpu and --synth-memory.")
+
+	fs.StringVar(&synthCPU, "synth-cpu", "",
+		"CPU limit of each in-process synth step. Requires --synth-cgroup-parent.")
+
+	fs.StringVar(&synthMemory, "synth-memory", "",
+		"Memory limit of each in-process synth step. Requires --synth-cgroup-parent.")
+
+	fs.StringVar(&synthCacheDir, "synth-cache-dir", "",
+		"Directory of the dependency cache of in-process syntheses, usually a persistent volume. Empty disables the cache.")
+
+	fs.StringVar(&synthCacheMaxSize, "synth-cache-max-size", "10Gi",
+		"Size above which the least recently used entries of the dependency cache are evicted. 0 disables eviction.")
+
+	fs.BoolVar(&synthOffline, "synth-offline", false,
+		"Deny syntheses network access. Apps must vendor their dependencies or find them in the dependency cache.")
+
+	fs.BoolVar(&synthOfflineEnvOnly, "synth-offline-env-only", false,
+		"Let offline in-process syntheses run if network namespaces are not available, kept offline by their environment only.")
+
 	flags.AddManagerOptions(fs, &managerOptions)
 
 	feature.MutableGates.AddFlag(fs)
@@ -132,7 +202,25 @@ func InitFlags(fs *pflag.FlagSet) {
 // +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
 // +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 
+const (
+	synthBackendInProcess = "in-process"
+	synthBackendJob       = "job"
+)
+
 func main() {
+	// The synth Jobs run the manager image with the synth subcommand.
+	if len(os.Args) > 1 && os.Args[1] == "synth" {
+		os.Exit(runSynthJob(os.Args[2:]))
+	}
+	// The jsonnet renderer evaluates Jsonnet in a step running the manager with the jsonnet subcommand.
+	if len(os.Args) > 1 && os.Args[1] == synthesizer.JsonnetCommand {
+		if err := synthesizer.RunJsonnet(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	InitFlags(pflag.CommandLine)
 	klog.InitFlags(flag.CommandLine)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -204,10 +292,33 @@ func main() {
 
 	ctx := ctrl.SetupSignalHandler()
 
+	synthJobs, err := synthJobConfig(restConfig)
+	if err != nil {
+		setupLog.Error(err, "invalid synth backend configuration")
+		os.Exit(1)
+	}
+
+	synthLimits, err := synthLimitsConfig()
+	if err != nil {
+		setupLog.Error(err, "invalid synth limits")
+		os.Exit(1)
+	}
+
+	synthCache, err := synthCacheConfig()
+	if err != nil {
+		setupLog.Error(err, "invalid synth cache configuration")
+		os.Exit(1)
+	}
+
 	if err = (&caapccontroller.Reconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorder(controllerName),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Recorder:            mgr.GetEventRecorder(controllerName),
+		SynthJobs:           synthJobs,
+		SynthLimits:         synthLimits,
+		SynthCache:          synthCache,
+		SynthOffline:        synthOffline,
+		SynthOfflineEnvOnly: synthOfflineEnvOnly,
 	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: cdk8sAppProxyConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cdk8sAppProxy")
 		os.Exit(1)
@@ -225,6 +336,10 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Cdk8sAppProxy")
 		os.Exit(1)
 	}
+	if err = (&addonsv1alpha1.Cdk8sAppProxyGenerator{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Cdk8sAppProxyGenerator")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -242,3 +357,126 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// synthLimitsConfig returns the limits of in-process syntheses.
+func synthLimitsConfig() (synthesizer.Limits, error) {
+	limits := synthesizer.Limits{
+		StepTimeout:    synthStepTimeout,
+		MaxOutputBytes: synthMaxOutputBytes,
+		CPUTime:        synthCPUTime,
+		CgroupParent:   synthCgroupParent,
+	}
+
+	if (synthCPU != "" || synthMemory != "") && synthCgroupParent == "" {
+		return limits, fmt.Errorf("--synth-cpu and --synth-memory require --synth-cgroup-parent")
+	}
+	if synthCPU != "" {
+		cpu, err := resource.ParseQuantity(synthCPU)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --synth-cpu: %w", err)
+		}
+		limits.MilliCPU = cpu.MilliValue()
+	}
+	if synthMemory != "" {
+		memory, err := resource.ParseQuantity(synthMemory)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --synth-memory: %w", err)
+		}
+		limits.Memory = memory.Value()
+	}
+
+	return limits, nil
+}
+
+// synthCacheConfig returns the dependency cache of in-process syntheses, or nil if it is disabled.
+func synthCacheConfig() (*synthesizer.Cache, error) {
+	if synthCacheDir == "" {
+		return nil, nil
+	}
+
+	maxSize, err := resource.ParseQuantity(synthCacheMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --synth-cache-max-size: %w", err)
+	}
+
+	return synthesizer.NewCache(synthCacheDir, maxSize.Value())
+}
+
+// synthJobConfig returns the configuration of the synth Jobs, or nil for the in-process synth backend.
+func synthJobConfig(restConfig *rest.Config) (*synthesizer.JobConfig, error) {
+	switch synthBackend {
+	case synthBackendInProcess:
+		return nil, nil
+	case synthBackendJob:
+	default:
+		return nil, fmt.Errorf("unknown synth backend %q", synthBackend)
+	}
+
+	if synthJobImage == "" {
+		return nil, fmt.Errorf("--synth-job-image is required for the %s synth backend", synthBackendJob)
+	}
+
+	cpu, err := resource.ParseQuantity(synthJobCPU)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --synth-job-cpu: %w", err)
+	}
+	memory, err := resource.ParseQuantity(synthJobMemory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --synth-job-memory: %w", err)
+	}
+
+	for _, cidr := range synthJobExcludedCIDRs {
+		if _, _, err = net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("invalid --synth-job-excluded-cidrs: %w", err)
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := corev1.ResourceList{corev1.ResourceCPU: cpu, corev1.ResourceMemory: memory}
+
+	return &synthesizer.JobConfig{
+		Clientset:     clientset,
+		Image:         synthJobImage,
+		Resources:     corev1.ResourceRequirements{Requests: limits, Limits: limits},
+		Timeout:       synthJobTimeout,
+		PollInterval:  2 * time.Second,
+		ExcludedCIDRs: synthJobExcludedCIDRs,
+	}, nil
+}
+
+// runSynthJob runs the synth subcommand in a synth Job and returns the exit code.
+func runSynthJob(args []string) int {
+	fs := pflag.NewFlagSet("synth", pflag.ExitOnError)
+	clone := fs.Bool("clone", false, "Clone the repository into the work dir instead of synthesizing the app.")
+	requestFile := fs.String("request", synthesizer.JobRequestFile, "File holding the synth request.")
+	registriesFile := fs.String("registries", synthesizer.JobRegistriesFile, "File holding the registries of the synth request, read when cloning.")
+	gitDir := fs.String("git-dir", synthesizer.JobGitDir, "Directory holding the Git credentials and known_hosts, read when cloning.")
+	workDir := fs.String("work-dir", synthesizer.JobWorkDir, "Directory the repository is cloned into.")
+	_ = fs.Parse(args)
+
+	ctx := ctrl.SetupSignalHandler()
+	if *clone {
+		logger := klog.Background().WithName("clone")
+		if err := synthesizer.CloneJob(ctx, *requestFile, *registriesFile, *gitDir, *workDir, logger); err != nil {
+			logger.Error(err, "clone failed")
+
+			return 1
+		}
+
+		return 0
+	}
+
+	// Logs go to stderr, the manifests to stdout.
+	logger := klog.Background().WithName("synth")
+	if err := synthesizer.RunJob(ctx, *requestFile, *workDir, os.Stdout, logger); err != nil {
+		logger.Error(err, "synthesis failed")
+
+		return 1
+	}
+
+	return 0
+}